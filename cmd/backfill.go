@@ -0,0 +1,55 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/agent"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var backfillOpts agent.BackfillOptions
+
+// BackfillCmd processes existing log files from start to EOF and exits.
+var BackfillCmd = &cobra.Command{
+	Use:   "backfill [flags] [file...]",
+	Short: "Process existing log files or rotated archives and exit",
+	Long: `Run a log config over existing files from start to EOF and exit.
+
+Files may be plain, gzip, bzip2 or zstd compressed (e.g. rotated archives). If no
+files are given the log config log_file is processed. Metrics carry the event
+time extracted using the log config 'timestamp' and are either sent to the
+configured destination or written to a local JSON or CSV report bucketed by
+event time.
+
+The timestamp max_age is not applied when backfilling.
+
+Use --unmatched to see which lines the log config rules do not match, as a
+sample of lines and the most common line patterns (digits and hex masked).
+
+Example:
+
+  backfill --log-id apache --output report.csv /var/log/apache2/access.log.*.gz
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		backfillOpts.Files = args
+		if err := agent.Backfill(backfillOpts); err != nil {
+			log.Fatal().Err(err).Msg("backfill")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(BackfillCmd)
+
+	BackfillCmd.Flags().StringVar(&backfillOpts.LogID, "log-id", "", "Log config id to use (optional if only one log config)")
+	BackfillCmd.Flags().StringVarP(&backfillOpts.Output, "output", "o", "", "Write a report to file ('-' for stdout) instead of sending metrics to the destination")
+	BackfillCmd.Flags().StringVar(&backfillOpts.Format, "format", "", "Report format [json|csv] (default based on output extension, otherwise json)")
+	BackfillCmd.Flags().DurationVar(&backfillOpts.Bucket, "bucket", time.Minute, "Report time bucket size")
+	BackfillCmd.Flags().IntVar(&backfillOpts.Unmatched, "unmatched", 0, "Report the N most common patterns, and a sample, of lines not matching any rule to stderr (0 disables)")
+}
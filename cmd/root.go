@@ -134,12 +134,94 @@ func init() {
 			description = "Log configuration directory"
 		)
 
-		RootCmd.Flags().StringP(longOpt, shortOpt, defaults.LogConfPath, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().StringP(longOpt, shortOpt, defaults.LogConfPath, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaults.LogConfPath)
 	}
 
+	{
+		const (
+			key         = config.KeyStateDir
+			longOpt     = "state-dir"
+			envVar      = release.ENVPREFIX + "_STATE_DIR"
+			description = "Directory for log offset checkpoints, enables catch-up after restart (disabled if empty)"
+		)
+
+		RootCmd.PersistentFlags().String(longOpt, "", desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
+		bindEnvError(key, viper.BindEnv(key, envVar))
+	}
+
+	{
+		const (
+			key         = config.KeyHealthThreshold
+			longOpt     = "health-threshold"
+			envVar      = release.ENVPREFIX + "_HEALTH_THRESHOLD"
+			description = "How long a watcher may be down, or the destination failing, before /healthz reports unhealthy"
+		)
+
+		RootCmd.PersistentFlags().String(longOpt, defaults.HealthThreshold, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
+		bindEnvError(key, viper.BindEnv(key, envVar))
+		viper.SetDefault(key, defaults.HealthThreshold)
+	}
+
+	{
+		const (
+			key         = config.KeyQueueSize
+			longOpt     = "queue-size"
+			envVar      = release.ENVPREFIX + "_QUEUE_SIZE"
+			description = "Capacity of each log watcher queue (lines, metrics)"
+		)
+
+		RootCmd.PersistentFlags().Int(longOpt, defaults.QueueSize, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
+		bindEnvError(key, viper.BindEnv(key, envVar))
+		viper.SetDefault(key, defaults.QueueSize)
+	}
+
+	{
+		const (
+			key         = config.KeyQueuePolicy
+			longOpt     = "queue-policy"
+			envVar      = release.ENVPREFIX + "_QUEUE_POLICY"
+			description = "When a log watcher queue is full (block|drop-newest|drop-oldest)"
+		)
+
+		RootCmd.PersistentFlags().String(longOpt, defaults.QueuePolicy, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
+		bindEnvError(key, viper.BindEnv(key, envVar))
+		viper.SetDefault(key, defaults.QueuePolicy)
+	}
+
+	{
+		const (
+			key         = config.KeyHistogramInterval
+			longOpt     = "histogram-interval"
+			envVar      = release.ENVPREFIX + "_HISTOGRAM_INTERVAL"
+			description = "Aggregate histograms for statsd and log destinations, sending quantiles every interval (e.g. 10s, disabled if empty)"
+		)
+
+		RootCmd.PersistentFlags().String(longOpt, "", desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
+		bindEnvError(key, viper.BindEnv(key, envVar))
+	}
+
+	{
+		const (
+			key         = config.KeyHistogramQuantiles
+			longOpt     = "histogram-quantiles"
+			envVar      = release.ENVPREFIX + "_HISTOGRAM_QUANTILES"
+			description = "Quantiles sent for aggregated histograms"
+		)
+
+		RootCmd.PersistentFlags().String(longOpt, defaults.HistogramQuantiles, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
+		bindEnvError(key, viper.BindEnv(key, envVar))
+		viper.SetDefault(key, defaults.HistogramQuantiles)
+	}
+
 	//
 	// Destination for metrics
 	//
@@ -151,8 +233,8 @@ func init() {
 			description = "Destination[agent|check|log|statsd] type for metrics"
 		)
 
-		RootCmd.Flags().String(longOpt, defaults.DestinationType, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, defaults.DestinationType, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaults.DestinationType)
 	}
@@ -164,8 +246,8 @@ func init() {
 			description = "Destination[statsd|agent] metric group ID"
 		)
 
-		RootCmd.Flags().String(longOpt, release.NAME, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, release.NAME, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 	}
 	{
@@ -176,8 +258,8 @@ func init() {
 			description = "Destination[check] Check ID (not check bundle id)"
 		)
 
-		RootCmd.Flags().String(longOpt, "", desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, "", desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 	}
 	{
@@ -188,8 +270,8 @@ func init() {
 			description = "Destination[check] Check Submission URL"
 		)
 
-		RootCmd.Flags().String(longOpt, "", desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, "", desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 	}
 	{
@@ -200,8 +282,8 @@ func init() {
 			description = "Destination[agent|statsd] port (agent=2609, statsd=8125)"
 		)
 
-		RootCmd.Flags().String(longOpt, "", desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, "", desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 	}
 	{
@@ -212,8 +294,8 @@ func init() {
 			description = "Destination[check] Check Instance ID"
 		)
 
-		RootCmd.Flags().String(longOpt, "", desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, "", desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 	}
 	{
@@ -224,8 +306,8 @@ func init() {
 			description = "Destination[check] Check target (default hostname)"
 		)
 
-		RootCmd.Flags().String(longOpt, "", desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, "", desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 	}
 	{
@@ -236,8 +318,8 @@ func init() {
 			description = "Destination[check] Check search tag"
 		)
 
-		RootCmd.Flags().String(longOpt, "", desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, "", desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 	}
 	{
@@ -248,8 +330,8 @@ func init() {
 			description = "Destination[statsd] Prefix prepended to every metric sent to StatsD"
 		)
 
-		RootCmd.Flags().String(longOpt, defaults.StatsdPrefix, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, defaults.StatsdPrefix, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaults.StatsdPrefix)
 	}
@@ -261,8 +343,8 @@ func init() {
 			description = "Destination[agent] Interval for metric submission to agent"
 		)
 
-		RootCmd.Flags().String(longOpt, defaults.AgentInterval, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, defaults.AgentInterval, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaults.AgentInterval)
 	}
@@ -278,8 +360,8 @@ func init() {
 			envVar       = release.ENVPREFIX + "_API_KEY"
 			description  = "Circonus API Token key or 'cosi' to use COSI config"
 		)
-		RootCmd.Flags().String(longOpt, defaultValue, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, defaultValue, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 	}
 
@@ -291,8 +373,8 @@ func init() {
 			description = "Circonus API Token app"
 		)
 
-		RootCmd.Flags().String(longOpt, defaults.APIApp, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, defaults.APIApp, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaults.APIApp)
 	}
@@ -305,8 +387,8 @@ func init() {
 			description = "Circonus API URL"
 		)
 
-		RootCmd.Flags().String(longOpt, defaults.APIURL, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, defaults.APIURL, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaults.APIURL)
 	}
@@ -320,8 +402,8 @@ func init() {
 			description  = "Circonus API CA certificate file"
 		)
 
-		RootCmd.Flags().String(longOpt, defaultValue, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, defaultValue, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 	}
 
@@ -336,8 +418,8 @@ func init() {
 			description = "Enable debug messages"
 		)
 
-		RootCmd.Flags().BoolP(longOpt, shortOpt, defaults.Debug, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().BoolP(longOpt, shortOpt, defaults.Debug, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaults.Debug)
 	}
@@ -351,8 +433,8 @@ func init() {
 			description  = "Enable CGM & API debug messages"
 		)
 
-		RootCmd.Flags().Bool(longOpt, defaultValue, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().Bool(longOpt, defaultValue, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
@@ -366,8 +448,8 @@ func init() {
 			description  = "Enable log tailing messages"
 		)
 
-		RootCmd.Flags().Bool(longOpt, defaultValue, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().Bool(longOpt, defaultValue, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
@@ -381,8 +463,8 @@ func init() {
 			description  = "Enable metric rule evaluation tracing debug messages"
 		)
 
-		RootCmd.Flags().Bool(longOpt, defaultValue, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().Bool(longOpt, defaultValue, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
@@ -409,8 +491,8 @@ func init() {
 			description = "Log level [(panic|fatal|error|warn|info|debug|disabled)]"
 		)
 
-		RootCmd.Flags().String(longOpt, defaults.LogLevel, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().String(longOpt, defaults.LogLevel, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaults.LogLevel)
 	}
@@ -423,8 +505,8 @@ func init() {
 			description = "Output formatted/colored log lines"
 		)
 
-		RootCmd.Flags().Bool(longOpt, defaults.LogPretty, desc(description, envVar))
-		bindFlagError(key, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		RootCmd.PersistentFlags().Bool(longOpt, defaults.LogPretty, desc(description, envVar))
+		bindFlagError(key, viper.BindPFlag(key, RootCmd.PersistentFlags().Lookup(longOpt)))
 		bindEnvError(key, viper.BindEnv(key, envVar))
 		viper.SetDefault(key, defaults.LogPretty)
 	}
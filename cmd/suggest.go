@@ -0,0 +1,123 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/suggest"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var suggestOpts struct {
+	id      string
+	logFile string
+	format  string
+	lines   int
+}
+
+// SuggestCmd proposes a rule match regex and starter log config from sample lines.
+var SuggestCmd = &cobra.Command{
+	Use:   "suggest [flags] [file...]",
+	Short: "Suggest a rule match regex and starter log config from sample log lines",
+	Long: `Infer the fields (ip, timestamp, number, duration, path, quoted string) in
+sample log lines, read from the files given or stdin, and propose a match
+regular expression with named subexpressions and a starter log config.
+
+Words which are the same in every sample line are kept as literals, use a
+handful of representative lines. Lines with a different structure to the
+majority of the samples are skipped. The first duration field is used as the
+Value of a timing metric, otherwise matching lines are counted. The log config
+is written to stdout, the fields found to stderr.
+
+Example:
+
+  tail -n 20 /var/log/app.log | circonus-logwatch suggest --id app --log-file /var/log/app.log > /opt/circonus/etc/log.d/app.yaml
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		lines, err := readSamples(args, suggestOpts.lines)
+		if err != nil {
+			log.Fatal().Err(err).Msg("reading sample lines")
+		}
+
+		logFile := suggestOpts.logFile
+		if logFile == "" {
+			logFile = "/path/to/log"
+			if len(args) > 0 {
+				if abs, err := filepath.Abs(args[0]); err == nil {
+					logFile = abs
+				}
+			}
+		}
+
+		s, err := suggest.Suggest(lines, suggestOpts.id, logFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("suggest")
+		}
+
+		writeFields(os.Stderr, s)
+
+		if err := s.Encode(os.Stdout, suggestOpts.format); err != nil {
+			log.Fatal().Err(err).Msg("writing log config")
+		}
+	},
+}
+
+// readSamples reads up to max lines from the files, or stdin if none.
+func readSamples(files []string, max int) ([]string, error) {
+	var readers []io.Reader
+	if len(files) == 0 {
+		readers = append(readers, os.Stdin)
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(io.MultiReader(readers...))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() && len(lines) < max {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+func writeFields(w io.Writer, s *suggest.Suggestion) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "match:\t%s\n\nfield\ttype\texample\n", s.Match)
+	for _, f := range s.Fields {
+		typ := f.Type
+		if f.Layout != "" {
+			typ += " (" + f.Layout + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Name, typ, f.Example)
+	}
+	tw.Flush()
+	if len(s.Skipped) > 0 {
+		fmt.Fprintf(w, "\nskipped %d line(s) with a different structure, e.g.\n  %s\n", len(s.Skipped), s.Skipped[0])
+	}
+	fmt.Fprintln(w)
+}
+
+func init() {
+	RootCmd.AddCommand(SuggestCmd)
+
+	SuggestCmd.Flags().StringVar(&suggestOpts.id, "id", "", "Log config id (default based on log file name)")
+	SuggestCmd.Flags().StringVar(&suggestOpts.logFile, "log-file", "", "Log config log_file (default first file given)")
+	SuggestCmd.Flags().StringVar(&suggestOpts.format, "format", suggest.FormatYAML, "Log config format [yaml|json|toml]")
+	SuggestCmd.Flags().IntVar(&suggestOpts.lines, "lines", 50, "Maximum number of sample lines to read")
+}
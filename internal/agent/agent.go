@@ -8,12 +8,12 @@ package agent
 import (
 	"context"
 	"errors"
-	"expvar"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"time"
 
 	"github.com/circonus-labs/circonus-logwatch/internal/config"
@@ -23,7 +23,6 @@ import (
 	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
 	"github.com/circonus-labs/circonus-logwatch/internal/metrics/statsd"
 	"github.com/circonus-labs/circonus-logwatch/internal/release"
-	"github.com/circonus-labs/circonus-logwatch/internal/watcher"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"golang.org/x/sync/errgroup"
@@ -37,11 +36,11 @@ type Agent struct {
 	groupCancel context.CancelFunc
 	signalCh    chan os.Signal
 	svrHTTP     *http.Server
-	watchers    []*watcher.Watcher
-}
-
-func init() {
-	http.Handle("/stats", expvar.Handler())
+	supervisors []*supervisor
+	// healthThreshold is how long a watcher may be down, or the
+	// destination failing, before the agent reports unhealthy
+	healthThreshold time.Duration
+	started         int32 // set once the destination and watchers are started
 }
 
 // New returns a new agent instance.
@@ -63,34 +62,11 @@ func New() (*Agent, error) {
 		return nil, fmt.Errorf("config validate: %w", err)
 	}
 
-	dest := viper.GetString(config.KeyDestType)
-	switch dest {
-	case "agent":
-		fallthrough
-	case "check":
-		d, err := circonus.New()
-		if err != nil {
-			return nil, err
-		}
-		a.destClient = d
-
-	case "statsd":
-		d, err := statsd.New()
-		if err != nil {
-			return nil, err
-		}
-		a.destClient = d
-
-	case "log":
-		d, err := logonly.New()
-		if err != nil {
-			return nil, err
-		}
-		a.destClient = d
-
-	default:
-		return nil, fmt.Errorf("unknown metric destination (%s)", dest)
+	d, err := newDestination(viper.GetString(config.KeyDestType))
+	if err != nil {
+		return nil, err
 	}
+	a.destClient = d
 
 	cfgs, err := configs.Load()
 	if err != nil {
@@ -100,18 +76,20 @@ func New() (*Agent, error) {
 		return nil, err
 	}
 
-	a.watchers = make([]*watcher.Watcher, len(cfgs))
+	a.healthThreshold, err = time.ParseDuration(viper.GetString(config.KeyHealthThreshold))
+	if err != nil {
+		return nil, fmt.Errorf("parsing health threshold: %w", err)
+	}
+
+	a.supervisors = make([]*supervisor, len(cfgs))
 	for idx, cfg := range cfgs {
-		w, err := watcher.New(a.groupCtx, a.destClient, cfg)
-		if err != nil {
-			log.Error().Err(err).Str("id", cfg.ID).Msg("adding watcher, log will NOT be processed")
-		}
-		a.watchers[idx] = w
+		a.supervisors[idx] = newSupervisor(a.groupCtx, a.destClient, cfg)
 	}
 
 	a.svrHTTP = &http.Server{
 		Addr:              net.JoinHostPort("localhost", viper.GetString(config.KeyAppStatPort)),
 		ReadHeaderTimeout: 5 * time.Second,
+		Handler:           a.newMux(),
 	}
 	a.svrHTTP.SetKeepAlivesEnabled(false)
 
@@ -120,13 +98,32 @@ func New() (*Agent, error) {
 	return &a, nil
 }
 
+// newDestination creates the metric destination of the given type.
+func newDestination(dest string) (metrics.Destination, error) {
+	switch dest {
+	case "agent", "check":
+		return circonus.New()
+	case "statsd":
+		return statsd.New()
+	case "log":
+		return logonly.New()
+	default:
+		return nil, fmt.Errorf("unknown metric destination (%s)", dest)
+	}
+}
+
 // Start the agent.
 func (a *Agent) Start() error {
+	if err := a.destClient.Start(); err != nil {
+		return fmt.Errorf("starting destination: %w", err)
+	}
+
 	a.group.Go(a.handleSignals)
-	for _, w := range a.watchers {
-		a.group.Go(w.Start)
+	for _, s := range a.supervisors {
+		a.group.Go(s.run)
 	}
 	a.group.Go(a.serveMetrics)
+	atomic.StoreInt32(&a.started, 1)
 
 	log.Debug().
 		Int("pid", os.Getpid()).
@@ -146,6 +143,10 @@ func (a *Agent) Stop() {
 	a.stopSignalHandler()
 	a.groupCancel()
 
+	if err := a.destClient.Stop(); err != nil {
+		log.Warn().Err(err).Msg("stopping destination")
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	err := a.svrHTTP.Shutdown(ctx)
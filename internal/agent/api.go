@@ -0,0 +1,163 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package agent
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/watcher"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	apiLogsPath = "/api/v1/logs"
+	// unmatchedTop is the default number of unmatched patterns returned
+	unmatchedTop = 20
+)
+
+// newMux returns the handler for the stats listener.
+func (a *Agent) newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/stats", expvar.Handler())
+	mux.HandleFunc(apiLogsPath, a.handleLogs)
+	mux.HandleFunc(apiLogsPath+"/", a.handleLog)
+	mux.HandleFunc("/healthz", a.handleHealth)
+	mux.HandleFunc("/readyz", a.handleReady)
+	return mux
+}
+
+// handleLogs returns the status of all logs.
+func (a *Agent) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	logs := make([]watcher.LogStatus, len(a.supervisors))
+	for i, s := range a.supervisors {
+		logs[i] = s.status()
+	}
+	writeJSON(w, logs)
+}
+
+// handleLog returns the status of a single log, /api/v1/logs/{id}, its
+// unmatched lines, /api/v1/logs/{id}/unmatched, or streams live trace
+// events for it, /api/v1/logs/{id}/trace.
+func (a *Agent) handleLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	id, action := strings.TrimPrefix(r.URL.Path, apiLogsPath+"/"), ""
+	if i := strings.Index(id, "/"); i >= 0 {
+		id, action = id[:i], id[i+1:]
+	}
+	var s *supervisor
+	for _, sup := range a.supervisors {
+		if sup.cfg.ID == id {
+			s = sup
+			break
+		}
+	}
+	if s == nil {
+		http.Error(w, "log ("+id+") not found", http.StatusNotFound)
+		return
+	}
+	switch action {
+	case "":
+		writeJSON(w, s.status())
+	case "unmatched":
+		top := unmatchedTop
+		if v := r.URL.Query().Get("top"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid top ("+v+")", http.StatusBadRequest)
+				return
+			}
+			top = n
+		}
+		writeJSON(w, s.unmatched(top))
+	case "trace":
+		a.handleTrace(w, r, s)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleTrace streams live trace events for a log as server-sent events
+// until the client disconnects. Query parameters: rule (id, default all),
+// rate (max events/second, default 10) and sample (1 in N events, default 1).
+func (a *Agent) handleTrace(w http.ResponseWriter, r *http.Request, s *supervisor) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	opts := watcher.TraceOptions{Rule: -1}
+	q := r.URL.Query()
+	if v := q.Get("rule"); v != "" {
+		rule, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid rule ("+v+")", http.StatusBadRequest)
+			return
+		}
+		opts.Rule = rule
+	}
+	if v := q.Get("rate"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 {
+			http.Error(w, "invalid rate ("+v+")", http.StatusBadRequest)
+			return
+		}
+		opts.Rate = rate
+	}
+	if v := q.Get("sample"); v != "" {
+		sample, err := strconv.Atoi(v)
+		if err != nil || sample <= 0 {
+			http.Error(w, "invalid sample ("+v+")", http.StatusBadRequest)
+			return
+		}
+		opts.Sample = sample
+	}
+
+	events, err := s.trace(r.Context(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for ev := range events {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			log.Warn().Err(err).Msg("encoding trace event")
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		log.Warn().Err(err).Msg("writing api response")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/watcher"
+	"github.com/rs/zerolog"
+)
+
+func TestAPI(t *testing.T) {
+	t.Log("Testing status api")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	a := &Agent{}
+	for _, id := range []string{"api_one", "api_two"} {
+		s := newSupervisor(context.Background(), nil, &configs.Config{ID: id, LogFile: "/tmp/" + id + ".log"})
+		a.supervisors = append(a.supervisors, s)
+	}
+	a.supervisors[1].current = &fakeRunner{}
+	a.supervisors[1].setState(stateRunning)
+	mux := a.newMux()
+
+	t.Log("all logs")
+	{
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		var logs []watcher.LogStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &logs); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if len(logs) != 2 {
+			t.Fatalf("expected 2 logs, got %d", len(logs))
+		}
+		if logs[0].ID != "api_one" || logs[0].State != stateStarting {
+			t.Fatalf("unexpected status %#v", logs[0])
+		}
+		if logs[1].ID != "fake" || logs[1].State != stateRunning {
+			t.Fatalf("unexpected status %#v", logs[1])
+		}
+	}
+
+	t.Log("single log")
+	{
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/api_one", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		var st watcher.LogStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if st.ID != "api_one" || st.File != "/tmp/api_one.log" {
+			t.Fatalf("unexpected status %#v", st)
+		}
+	}
+
+	t.Log("unknown log")
+	{
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/missing", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", rec.Code)
+		}
+	}
+
+	t.Log("unmatched")
+	{
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/api_two/unmatched?top=5", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		var r watcher.UnmatchedReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if r.Total != 5 {
+			t.Fatalf("expected top 5 passed to watcher, got %d", r.Total)
+		}
+
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/api_one/unmatched", nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"samples": []`) {
+			t.Fatalf("expected empty report, got %d %s", rec.Code, rec.Body.String())
+		}
+
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/api_two/unmatched?top=x", nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", rec.Code)
+		}
+	}
+
+	t.Log("trace")
+	{
+		events := make(chan watcher.TraceEvent, 2)
+		events <- watcher.TraceEvent{Type: watcher.TraceLine, Line: "line one"}
+		close(events)
+		a.supervisors[1].current = &fakeRunner{events: events}
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/api_two/trace?rate=5&sample=1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("expected event stream, got %s", ct)
+		}
+		body := rec.Body.String()
+		if !strings.HasPrefix(body, "event: line\ndata: {") || !strings.Contains(body, `"line":"line one"`) {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+
+	t.Log("trace, invalid options")
+	{
+		for _, q := range []string{"rule=x", "rate=0", "sample=-1"} {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/api_two/trace?"+q, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400 for %s, got %d", q, rec.Code)
+			}
+		}
+	}
+
+	t.Log("trace, log not running")
+	{
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/api_one/trace", nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d", rec.Code)
+		}
+	}
+
+	t.Log("invalid method")
+	{
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/logs", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("expected 405, got %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/report"
+	"github.com/circonus-labs/circonus-logwatch/internal/watcher"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// BackfillOptions defines a backfill run.
+type BackfillOptions struct {
+	LogID  string        // id of the log config to use, optional if there is only one
+	Output string        // report file ('-' for stdout), if empty metrics are sent to the configured destination
+	Format string        // report format (json|csv), default based on Output extension
+	Files  []string      // files to process, default is the log config log_file
+	Bucket time.Duration // report time bucket size
+	// Unmatched is the number of unmatched line patterns to report, 0 disables the report
+	Unmatched int
+}
+
+// Backfill runs a log config over existing files from start to EOF,
+// sending the metrics to the configured destination or writing a report.
+func Backfill(opts BackfillOptions) error {
+	cfgs, err := configs.Load()
+	if err != nil {
+		return err
+	}
+	cfg, err := selectLogConfig(cfgs, opts.LogID)
+	if err != nil {
+		return err
+	}
+	if cfg.Timestamp == nil {
+		log.Warn().Str("id", cfg.ID).Msg("log config has no timestamp, metrics will not be bucketed by event time")
+	}
+
+	var dest metrics.Destination
+	if opts.Output != "" {
+		format := opts.Format
+		if format == "" {
+			format = report.FormatJSON
+			if strings.EqualFold(filepath.Ext(opts.Output), ".csv") {
+				format = report.FormatCSV
+			}
+		}
+		var w io.Writer = os.Stdout
+		if opts.Output != "-" {
+			f, err := os.Create(opts.Output)
+			if err != nil {
+				return fmt.Errorf("creating report: %w", err)
+			}
+			defer f.Close()
+			w = f
+		}
+		r, err := report.New(w, format, opts.Bucket)
+		if err != nil {
+			return err
+		}
+		dest = r
+	} else {
+		if err := config.Validate(); err != nil {
+			return fmt.Errorf("config validate: %w", err)
+		}
+		destType := viper.GetString(config.KeyDestType)
+		d, err := newDestination(destType)
+		if err != nil {
+			return err
+		}
+		if _, ok := d.(metrics.TimestampDestination); !ok {
+			log.Warn().Str("dest", destType).Msg("destination does not support timestamps, metrics will be sent with the current time")
+		}
+		dest = d
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	defer signal.Stop(sigCh)
+	go func() {
+		select {
+		case <-sigCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	w, err := watcher.New(ctx, dest, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := dest.Start(); err != nil {
+		return fmt.Errorf("starting destination: %w", err)
+	}
+
+	berr := w.Backfill(opts.Files)
+
+	if opts.Unmatched > 0 {
+		writeUnmatched(os.Stderr, w.Unmatched(opts.Unmatched))
+	}
+
+	if err := dest.Stop(); err != nil {
+		return fmt.Errorf("stopping destination: %w", err)
+	}
+
+	return berr
+}
+
+// writeUnmatched writes the unmatched line report as text.
+func writeUnmatched(out io.Writer, r watcher.UnmatchedReport) {
+	pct := 0.0
+	if r.Lines > 0 {
+		pct = float64(r.Total) / float64(r.Lines) * 100
+	}
+	fmt.Fprintf(out, "\nunmatched lines: %d of %d (%.1f%%)\n", r.Total, r.Lines, pct)
+	if r.Total == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "\ntop patterns:\n%10s  %s\n", "count", "pattern")
+	for _, p := range r.Patterns {
+		fmt.Fprintf(out, "%10d  %s\n", p.Count, p.Pattern)
+	}
+	if r.Other > 0 {
+		fmt.Fprintf(out, "%10d  (other, pattern limit reached)\n", r.Other)
+	}
+
+	fmt.Fprintf(out, "\nsample:\n")
+	for _, line := range r.Samples {
+		fmt.Fprintf(out, "  %s\n", line)
+	}
+}
+
+// selectLogConfig returns the log config with the given id, or the only
+// log config if id is empty.
+func selectLogConfig(cfgs []*configs.Config, id string) (*configs.Config, error) {
+	if len(cfgs) == 0 {
+		return nil, errors.New("no valid log configs")
+	}
+	if id == "" {
+		if len(cfgs) == 1 {
+			return cfgs[0], nil
+		}
+		ids := make([]string, len(cfgs))
+		for i, cfg := range cfgs {
+			ids[i] = cfg.ID
+		}
+		return nil, fmt.Errorf("log id required, one of (%s)", strings.Join(ids, ", "))
+	}
+	for _, cfg := range cfgs {
+		if cfg.ID == id {
+			return cfg, nil
+		}
+	}
+	return nil, fmt.Errorf("log config (%s) not found", id)
+}
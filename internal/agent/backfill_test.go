@@ -0,0 +1,151 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package agent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/watcher"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestSelectLogConfig(t *testing.T) {
+	t.Log("Testing selectLogConfig")
+
+	cfgs := []*configs.Config{{ID: "foo"}, {ID: "bar"}}
+
+	t.Log("none")
+	{
+		if _, err := selectLogConfig(nil, ""); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("only")
+	{
+		cfg, err := selectLogConfig(cfgs[:1], "")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if cfg.ID != "foo" {
+			t.Fatalf("expected foo, got %s", cfg.ID)
+		}
+	}
+
+	t.Log("ambiguous")
+	{
+		_, err := selectLogConfig(cfgs, "")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), "foo, bar") {
+			t.Fatalf("expected ids in error, got %s", err)
+		}
+	}
+
+	t.Log("by id")
+	{
+		cfg, err := selectLogConfig(cfgs, "bar")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if cfg.ID != "bar" {
+			t.Fatalf("expected bar, got %s", cfg.ID)
+		}
+	}
+
+	t.Log("not found")
+	{
+		if _, err := selectLogConfig(cfgs, "baz"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	t.Log("Testing Backfill")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyLogConfDir, "testdata/")
+	defer viper.Reset()
+
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "test.log")
+	if err := ioutil.WriteFile(logFile, []byte("test line\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	t.Log("csv report")
+	{
+		out := filepath.Join(dir, "report.csv")
+		err := Backfill(BackfillOptions{
+			Output: out,
+			Files:  []string{logFile},
+			Bucket: time.Minute,
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		data, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if !strings.HasPrefix(string(data), "time,name,type,tags,value") {
+			t.Fatalf("expected csv report, got %s", string(data))
+		}
+	}
+
+	t.Log("invalid format")
+	{
+		err := Backfill(BackfillOptions{
+			Output: filepath.Join(dir, "report.json"),
+			Format: "xml",
+			Files:  []string{logFile},
+			Bucket: time.Minute,
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestWriteUnmatched(t *testing.T) {
+	t.Log("Testing writeUnmatched")
+
+	t.Log("none unmatched")
+	{
+		var buf bytes.Buffer
+		writeUnmatched(&buf, watcher.UnmatchedReport{Lines: 10})
+		if got := buf.String(); got != "\nunmatched lines: 0 of 10 (0.0%)\n" {
+			t.Fatalf("unexpected report %q", got)
+		}
+	}
+
+	t.Log("unmatched")
+	{
+		var buf bytes.Buffer
+		writeUnmatched(&buf, watcher.UnmatchedReport{
+			Lines:    8,
+			Total:    2,
+			Samples:  []string{"nomatch 1"},
+			Patterns: []watcher.UnmatchedPattern{{Pattern: "nomatch <n>", Count: 2}},
+		})
+		for _, s := range []string{"unmatched lines: 2 of 8 (25.0%)", "         2  nomatch <n>", "  nomatch 1"} {
+			if !strings.Contains(buf.String(), s) {
+				t.Fatalf("expected %q in %q", s, buf.String())
+			}
+		}
+	}
+}
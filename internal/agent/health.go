@@ -0,0 +1,71 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics"
+)
+
+// handleHealth reports whether the agent is healthy, /healthz. It is
+// unhealthy if a watcher has been down, or the destination failing,
+// for longer than the health threshold.
+func (a *Agent) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeCheck(w, a.healthProblems())
+}
+
+// handleReady reports whether the agent is ready, /readyz. It is ready
+// once the destination is started and every watcher is tailing its log.
+func (a *Agent) handleReady(w http.ResponseWriter, r *http.Request) {
+	writeCheck(w, a.readyProblems())
+}
+
+func (a *Agent) healthProblems() []string {
+	var problems []string
+	for _, s := range a.supervisors {
+		if d := s.down(); d > a.healthThreshold {
+			problems = append(problems, fmt.Sprintf("log %s: %s for %s", s.cfg.ID, s.status().State, d.Truncate(time.Second)))
+		}
+	}
+	if hd, ok := a.destClient.(metrics.HealthDestination); ok {
+		if since, err := hd.Health(); err != nil && time.Since(since) > a.healthThreshold {
+			problems = append(problems, fmt.Sprintf("destination: failing for %s: %s", time.Since(since).Truncate(time.Second), err))
+		}
+	}
+	return problems
+}
+
+func (a *Agent) readyProblems() []string {
+	if atomic.LoadInt32(&a.started) == 0 {
+		return []string{"destination: not started"}
+	}
+	var problems []string
+	for _, s := range a.supervisors {
+		st := s.status()
+		if st.State != stateRunning || !st.Tailing {
+			problems = append(problems, fmt.Sprintf("log %s: not tailing (%s)", s.cfg.ID, st.State))
+		}
+	}
+	return problems
+}
+
+// writeCheck responds 200 "ok", or 503 with one problem per line.
+func writeCheck(w http.ResponseWriter, problems []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if len(problems) == 0 {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintln(w, strings.Join(problems, "\n"))
+}
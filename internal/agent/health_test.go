@@ -0,0 +1,122 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics"
+	"github.com/rs/zerolog"
+)
+
+type fakeDest struct {
+	metrics.Destination
+	since time.Time
+	err   error
+}
+
+func (f *fakeDest) Health() (time.Time, error) { return f.since, f.err }
+
+func check(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestHealth(t *testing.T) {
+	t.Log("Testing /healthz and /readyz")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dest := &fakeDest{}
+	a := &Agent{destClient: dest, healthThreshold: time.Minute}
+	for _, id := range []string{"health_one", "health_two"} {
+		s := newSupervisor(context.Background(), nil, &configs.Config{ID: id})
+		s.current = &fakeRunner{tailing: true}
+		s.started = time.Now()
+		s.setState(stateRunning)
+		a.supervisors = append(a.supervisors, s)
+	}
+	mux := a.newMux()
+
+	t.Log("not started")
+	{
+		if code, body := check(t, mux, "/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "not started") {
+			t.Fatalf("expected 503, got %d %q", code, body)
+		}
+	}
+
+	a.started = 1
+
+	t.Log("ready and healthy")
+	{
+		if code, body := check(t, mux, "/readyz"); code != http.StatusOK || body != "ok\n" {
+			t.Fatalf("expected 200, got %d %q", code, body)
+		}
+		if code, body := check(t, mux, "/healthz"); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %q", code, body)
+		}
+	}
+
+	t.Log("watcher not tailing")
+	{
+		a.supervisors[1].current = &fakeRunner{}
+		code, body := check(t, mux, "/readyz")
+		if code != http.StatusServiceUnavailable || !strings.Contains(body, "log health_two: not tailing") {
+			t.Fatalf("expected 503, got %d %q", code, body)
+		}
+	}
+
+	t.Log("watcher backing off, within threshold")
+	{
+		a.supervisors[0].setState(stateBackoff)
+		if code, body := check(t, mux, "/healthz"); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %q", code, body)
+		}
+	}
+
+	t.Log("watcher backing off, past threshold")
+	{
+		a.supervisors[0].downSince = time.Now().Add(-2 * time.Minute)
+		code, body := check(t, mux, "/healthz")
+		if code != http.StatusServiceUnavailable || !strings.Contains(body, "log health_one: backing_off for 2m0s") {
+			t.Fatalf("expected 503, got %d %q", code, body)
+		}
+	}
+
+	t.Log("watcher restarted, not running long enough")
+	{
+		a.supervisors[0].setState(stateRunning)
+		if code, _ := check(t, mux, "/healthz"); code != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %d", code)
+		}
+		a.supervisors[0].started = time.Now().Add(-backoffReset)
+		if code, body := check(t, mux, "/healthz"); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %q", code, body)
+		}
+	}
+
+	t.Log("destination failing")
+	{
+		dest.since, dest.err = time.Now(), errors.New("connection refused")
+		if code, body := check(t, mux, "/healthz"); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %q", code, body)
+		}
+		dest.since = time.Now().Add(-5 * time.Minute)
+		code, body := check(t, mux, "/healthz")
+		if code != http.StatusServiceUnavailable || !strings.Contains(body, "destination: failing for 5m0s: connection refused") {
+			t.Fatalf("expected 503, got %d %q", code, body)
+		}
+	}
+}
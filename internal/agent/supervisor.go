@@ -0,0 +1,197 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics"
+	"github.com/circonus-labs/circonus-logwatch/internal/watcher"
+	"github.com/maier/go-appstats"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Watcher states reported in the <id>_state app stat.
+const (
+	stateStarting = "starting"
+	stateRunning  = "running"
+	stateBackoff  = "backing_off"
+	stateFailed   = "failed"
+	stateStopped  = "stopped"
+)
+
+const (
+	backoffMin = time.Second
+	backoffMax = 5 * time.Minute
+	// backoffReset is how long a watcher must run before its backoff is reset.
+	backoffReset = time.Minute
+)
+
+// runner is the part of a watcher used by the supervisor.
+type runner interface {
+	Start() error
+	Status() watcher.LogStatus
+	Trace(context.Context, watcher.TraceOptions) (<-chan watcher.TraceEvent, error)
+	Unmatched(top int) watcher.UnmatchedReport
+}
+
+// supervisor runs the watcher for a single log, restarting it with
+// exponential backoff when it stops, so that one failing log does not
+// stop the others.
+type supervisor struct {
+	ctx          context.Context
+	dest         metrics.Destination
+	cfg          *configs.Config
+	newWatcher   func(context.Context, metrics.Destination, *configs.Config) (runner, error)
+	statState    string
+	statRestarts string
+	logger       zerolog.Logger
+	current      runner
+	state        string
+	started      time.Time // when the current watcher was started
+	downSince    time.Time // when the watcher last started failing, zero if it has not
+	backoffMin   time.Duration
+	backoffMax   time.Duration
+	sync.Mutex
+}
+
+func newSupervisor(ctx context.Context, dest metrics.Destination, cfg *configs.Config) *supervisor {
+	s := &supervisor{
+		ctx:          ctx,
+		dest:         dest,
+		cfg:          cfg,
+		logger:       log.With().Str("pkg", "supervisor").Str("log_id", cfg.ID).Logger(),
+		statState:    cfg.ID + "_state",
+		statRestarts: cfg.ID + "_restarts",
+		backoffMin:   backoffMin,
+		backoffMax:   backoffMax,
+		newWatcher: func(ctx context.Context, dest metrics.Destination, cfg *configs.Config) (runner, error) {
+			return watcher.New(ctx, dest, cfg)
+		},
+	}
+
+	_ = appstats.NewString(s.statState)
+	_ = appstats.NewInt(s.statRestarts)
+	s.setState(stateStarting)
+
+	return s
+}
+
+// run supervises the watcher until the context is done. It always
+// returns nil so the agent errgroup is not cancelled by a single log.
+func (s *supervisor) run() error {
+	backoff := s.backoffMin
+	for {
+		w, err := s.newWatcher(s.ctx, s.dest, s.cfg)
+		if err != nil {
+			s.setState(stateFailed)
+			s.logger.Error().Err(err).Msg("creating watcher, log will NOT be processed")
+			return nil
+		}
+
+		started := time.Now()
+		s.Lock()
+		s.current = w
+		s.started = started
+		s.Unlock()
+
+		s.setState(stateRunning)
+		err = w.Start()
+		if s.ctx.Err() != nil {
+			s.setState(stateStopped)
+			return nil
+		}
+
+		if time.Since(started) >= backoffReset {
+			backoff = s.backoffMin
+		}
+
+		_ = appstats.IncrementInt(s.statRestarts)
+		s.setState(stateBackoff)
+		s.logger.Warn().Err(err).Str("backoff", backoff.String()).Msg("watcher stopped, restarting")
+
+		select {
+		case <-s.ctx.Done():
+			s.setState(stateStopped)
+			return nil
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.backoffMax {
+			backoff = s.backoffMax
+		}
+	}
+}
+
+func (s *supervisor) setState(state string) {
+	s.Lock()
+	s.state = state
+	if (state == stateBackoff || state == stateFailed) &&
+		(s.downSince.IsZero() || time.Since(s.started) >= backoffReset) {
+		s.downSince = time.Now()
+	}
+	s.Unlock()
+	_ = appstats.SetString(s.statState, state)
+}
+
+// status returns the runtime state of the current watcher.
+func (s *supervisor) status() watcher.LogStatus {
+	s.Lock()
+	w, state := s.current, s.state
+	s.Unlock()
+
+	st := watcher.LogStatus{ID: s.cfg.ID, File: s.cfg.LogFile}
+	if w != nil {
+		st = w.Status()
+	}
+	st.State = state
+	return st
+}
+
+// down returns how long the watcher has been failing, i.e. failed, backing
+// off or restarted and not yet running long enough to reset the backoff.
+func (s *supervisor) down() time.Duration {
+	s.Lock()
+	defer s.Unlock()
+	switch {
+	case s.downSince.IsZero(), s.state == stateStopped:
+		return 0
+	case s.state == stateRunning && time.Since(s.started) >= backoffReset:
+		return 0
+	}
+	return time.Since(s.downSince)
+}
+
+// unmatched returns the unmatched line report of the current watcher.
+func (s *supervisor) unmatched(top int) watcher.UnmatchedReport {
+	s.Lock()
+	w := s.current
+	s.Unlock()
+
+	if w == nil {
+		return watcher.UnmatchedReport{Samples: []string{}, Patterns: []watcher.UnmatchedPattern{}}
+	}
+	return w.Unmatched(top)
+}
+
+// trace subscribes to live trace events from the current watcher. The
+// events channel is closed if the watcher is restarted.
+func (s *supervisor) trace(ctx context.Context, opts watcher.TraceOptions) (<-chan watcher.TraceEvent, error) {
+	s.Lock()
+	w, state := s.current, s.state
+	s.Unlock()
+
+	if w == nil || state != stateRunning {
+		return nil, errors.New("log is not running (" + state + ")")
+	}
+	return w.Trace(ctx, opts)
+}
@@ -0,0 +1,120 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics"
+	"github.com/circonus-labs/circonus-logwatch/internal/watcher"
+	"github.com/rs/zerolog"
+)
+
+type fakeRunner struct {
+	fn      func() error
+	events  chan watcher.TraceEvent
+	tailing bool
+}
+
+func (f *fakeRunner) Start() error { return f.fn() }
+
+func (f *fakeRunner) Status() watcher.LogStatus {
+	return watcher.LogStatus{ID: "fake", Tailing: f.tailing}
+}
+
+func (f *fakeRunner) Unmatched(top int) watcher.UnmatchedReport {
+	return watcher.UnmatchedReport{Total: uint64(top)}
+}
+
+func (f *fakeRunner) Trace(context.Context, watcher.TraceOptions) (<-chan watcher.TraceEvent, error) {
+	if f.events == nil {
+		return nil, errors.New("invalid rule id")
+	}
+	return f.events, nil
+}
+
+func statValue(name string) string {
+	v := expvar.Get("stats")
+	if v == nil {
+		return ""
+	}
+	m, ok := v.(*expvar.Map)
+	if !ok {
+		return ""
+	}
+	sv := m.Get(name)
+	if sv == nil {
+		return ""
+	}
+	return sv.String()
+}
+
+func TestSupervisor(t *testing.T) {
+	t.Log("Testing supervisor")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("new watcher fails")
+	{
+		s := newSupervisor(context.Background(), nil, &configs.Config{ID: "sup_failed"})
+		s.newWatcher = func(context.Context, metrics.Destination, *configs.Config) (runner, error) {
+			return nil, errors.New("invalid")
+		}
+		if err := s.run(); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if v := statValue(s.statState); v != `"`+stateFailed+`"` {
+			t.Fatalf("expected state %s, got %s", stateFailed, v)
+		}
+	}
+
+	t.Log("restart with backoff")
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var starts int32
+		s := newSupervisor(ctx, nil, &configs.Config{ID: "sup_restart"})
+		s.backoffMin = time.Millisecond
+		s.backoffMax = 4 * time.Millisecond
+		s.newWatcher = func(context.Context, metrics.Destination, *configs.Config) (runner, error) {
+			return &fakeRunner{fn: func() error {
+				if atomic.AddInt32(&starts, 1) == 5 {
+					cancel()
+				}
+				return errors.New("tail error")
+			}}, nil
+		}
+
+		done := make(chan error)
+		go func() { done <- s.run() }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("supervisor did not stop")
+		}
+
+		if n := atomic.LoadInt32(&starts); n != 5 {
+			t.Fatalf("expected 5 starts, got %d", n)
+		}
+		if v := statValue(s.statRestarts); v != "4" {
+			t.Fatalf("expected 4 restarts, got %s", v)
+		}
+		if v := statValue(s.statState); v != `"`+stateStopped+`"` {
+			t.Fatalf("expected state %s, got %s", stateStopped, v)
+		}
+	}
+}
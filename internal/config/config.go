@@ -16,7 +16,9 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/circonus-labs/circonus-logwatch/internal/config/defaults"
 	"github.com/circonus-labs/circonus-logwatch/internal/release"
@@ -59,17 +61,28 @@ type Destination struct {
 	Config DestConfig `json:"config" yaml:"config" toml:"config"`
 }
 
+// Histogram defines the running config.histogram structure.
+type Histogram struct {
+	Interval  string `json:"interval" yaml:"interval" toml:"interval"`
+	Quantiles string `json:"quantiles" yaml:"quantiles" toml:"quantiles"`
+}
+
 // Config defines the running config structure.
 type Config struct {
-	Destination Destination `json:"destination" yaml:"destination" toml:"destination"`
-	API         API         `json:"api" yaml:"api" toml:"api"`
-	LogConfDir  string      `mapstructure:"log_conf_dir" json:"log_conf_dir" yaml:"log_conf_dir" toml:"log_conf_dir"`
-	AppStatPort string      `mapstructure:"app_stat_port" json:"app_stat_port" yaml:"app_stat_port" toml:"app_stat_port"`
-	Log         Log         `json:"log" yaml:"log" toml:"log"`
-	DebugCGM    bool        `mapstructure:"debug_cgm" json:"debug_cgm" yaml:"debug_cgm" toml:"debug_cgm"`
-	DebugTail   bool        `mapstructure:"debug_tail" json:"debug_tail" yaml:"debug_tail" toml:"debug_tail"`
-	DebugMetric bool        `mapstructure:"debug_metric" json:"debug_metric" yaml:"debug_metric" toml:"debug_metric"`
-	Debug       bool        `json:"debug" yaml:"debug" toml:"debug"`
+	Destination     Destination `json:"destination" yaml:"destination" toml:"destination"`
+	API             API         `json:"api" yaml:"api" toml:"api"`
+	LogConfDir      string      `mapstructure:"log_conf_dir" json:"log_conf_dir" yaml:"log_conf_dir" toml:"log_conf_dir"`
+	StateDir        string      `mapstructure:"state_dir" json:"state_dir" yaml:"state_dir" toml:"state_dir"`
+	AppStatPort     string      `mapstructure:"app_stat_port" json:"app_stat_port" yaml:"app_stat_port" toml:"app_stat_port"`
+	HealthThreshold string      `mapstructure:"health_threshold" json:"health_threshold" yaml:"health_threshold" toml:"health_threshold"`
+	QueuePolicy     string      `mapstructure:"queue_policy" json:"queue_policy" yaml:"queue_policy" toml:"queue_policy"`
+	QueueSize       int         `mapstructure:"queue_size" json:"queue_size" yaml:"queue_size" toml:"queue_size"`
+	Log             Log         `json:"log" yaml:"log" toml:"log"`
+	Histogram       Histogram   `json:"histogram" yaml:"histogram" toml:"histogram"`
+	DebugCGM        bool        `mapstructure:"debug_cgm" json:"debug_cgm" yaml:"debug_cgm" toml:"debug_cgm"`
+	DebugTail       bool        `mapstructure:"debug_tail" json:"debug_tail" yaml:"debug_tail" toml:"debug_tail"`
+	DebugMetric     bool        `mapstructure:"debug_metric" json:"debug_metric" yaml:"debug_metric" toml:"debug_metric"`
+	Debug           bool        `json:"debug" yaml:"debug" toml:"debug"`
 }
 
 // NOTE: adding a Key* MUST be reflected in the Config structures above.
@@ -101,9 +114,29 @@ const (
 	// KeyAppStatPort on which to expose runtime stats (expvar).
 	KeyAppStatPort = "app_stat_port"
 
+	// KeyHealthThreshold how long a watcher may be down, or the destination
+	// failing, before /healthz reports unhealthy.
+	KeyHealthThreshold = "health_threshold"
+
+	// KeyQueuePolicy what to do when a watcher queue is full (block|drop-newest|drop-oldest).
+	KeyQueuePolicy = "queue_policy"
+
+	// KeyQueueSize capacity of each watcher queue (lines, metrics).
+	KeyQueueSize = "queue_size"
+
+	// KeyHistogramInterval how often histograms aggregated locally (statsd and
+	// log destinations) are sent, disabled if empty.
+	KeyHistogramInterval = "histogram.interval"
+
+	// KeyHistogramQuantiles quantiles sent for histograms aggregated locally.
+	KeyHistogramQuantiles = "histogram.quantiles"
+
 	// KeyLogConfDir log configuration directory.
 	KeyLogConfDir = "log_conf_dir"
 
+	// KeyStateDir directory for log offset checkpoints (disabled if empty).
+	KeyStateDir = "state_dir"
+
 	// KeyLogLevel logging level (panic, fatal, error, warn, info, debug, disabled).
 	KeyLogLevel = "log.level"
 
@@ -153,6 +186,13 @@ const (
 	cosiName = "cosi"
 )
 
+// Queue policies, what a watcher does when one of its queues is full.
+const (
+	QueueBlock      = "block"       // wait for space, reading the log falls behind
+	QueueDropNewest = "drop-newest" // drop the item being queued
+	QueueDropOldest = "drop-oldest" // drop the oldest queued item to make space
+)
+
 var (
 	cosiCfgFile = filepath.Join(defaults.BasePath, "..", cosiName, "etc", "cosi.json")
 )
@@ -164,6 +204,22 @@ func Validate() error {
 		return err
 	}
 
+	if err := stateDir(); err != nil {
+		return err
+	}
+
+	if err := healthThreshold(); err != nil {
+		return err
+	}
+
+	if err := queue(); err != nil {
+		return err
+	}
+
+	if err := histogram(); err != nil {
+		return err
+	}
+
 	if err := destConf(); err != nil {
 		return err
 	}
@@ -353,6 +409,117 @@ func logConfDir() error {
 	return nil
 }
 
+// stateDir verifies the checkpoint directory, if one is configured.
+func stateDir() error {
+	errMsg := "invalid state directory"
+	dir := viper.GetString(KeyStateDir)
+
+	if dir == "" {
+		return nil // checkpoints disabled
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf(errMsg+": %w", err)
+	}
+
+	dir = absDir
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf(errMsg+": %w", err)
+	}
+
+	if !fi.Mode().IsDir() {
+		return fmt.Errorf(errMsg+" (%s) not a directory", dir)
+	}
+
+	viper.Set(KeyStateDir, dir)
+
+	return nil
+}
+
+// healthThreshold verifies the health threshold is a positive duration.
+func healthThreshold() error {
+	v := viper.GetString(KeyHealthThreshold)
+	if v == "" {
+		viper.Set(KeyHealthThreshold, defaults.HealthThreshold)
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("invalid health threshold: %w", err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("invalid health threshold (%s), must be greater than zero", v)
+	}
+	return nil
+}
+
+// queue verifies the queue size and policy.
+func queue() error {
+	if !viper.IsSet(KeyQueueSize) {
+		viper.Set(KeyQueueSize, defaults.QueueSize)
+	}
+	if size := viper.GetInt(KeyQueueSize); size <= 0 {
+		return fmt.Errorf("invalid queue size (%d), must be greater than zero", size)
+	}
+	if viper.GetString(KeyQueuePolicy) == "" {
+		viper.Set(KeyQueuePolicy, defaults.QueuePolicy)
+	}
+	return ValidQueuePolicy(viper.GetString(KeyQueuePolicy))
+}
+
+// ValidQueuePolicy returns an error if policy is not a queue policy.
+func ValidQueuePolicy(policy string) error {
+	switch policy {
+	case QueueBlock, QueueDropNewest, QueueDropOldest:
+		return nil
+	}
+	return fmt.Errorf("invalid queue policy (%s), must be %s, %s or %s", policy, QueueBlock, QueueDropNewest, QueueDropOldest)
+}
+
+// histogram verifies the local histogram interval and quantiles.
+func histogram() error {
+	if v := viper.GetString(KeyHistogramInterval); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid histogram interval: %w", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("invalid histogram interval (%s), must be >= 0", v)
+		}
+	}
+	if viper.GetString(KeyHistogramQuantiles) == "" {
+		viper.Set(KeyHistogramQuantiles, defaults.HistogramQuantiles)
+	}
+	_, err := ParseQuantiles(viper.GetString(KeyHistogramQuantiles))
+	return err
+}
+
+// ParseQuantiles parses a comma separated list of quantiles (0-1).
+func ParseQuantiles(list string) ([]float64, error) {
+	var qs []float64
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		q, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid histogram quantile (%s): %w", s, err)
+		}
+		if q < 0 || q > 1 {
+			return nil, fmt.Errorf("invalid histogram quantile (%s), must be between 0 and 1", s)
+		}
+		qs = append(qs, q)
+	}
+	if len(qs) == 0 {
+		return nil, errors.New("invalid histogram quantiles, none given")
+	}
+	return qs, nil
+}
+
 // testPort is used to verify agent|statsd port.
 func testPort(network, address string) error {
 	c, err := net.Dial(network, address)
@@ -279,6 +279,90 @@ func TestLogConfDir(t *testing.T) {
 	}
 }
 
+func TestStateDir(t *testing.T) {
+	t.Log("Testing stateDir")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("disabled")
+	{
+		viper.Set(KeyStateDir, "")
+		if err := stateDir(); err != nil {
+			t.Fatalf("Expected NO error, got (%s)", err)
+		}
+	}
+
+	t.Log("Invalid directory (not a dir)")
+	{
+		viper.Set(KeyStateDir, filepath.Join("testdata", "not_a_dir"))
+		err := stateDir()
+		if err == nil {
+			t.Fatalf("Expected error")
+		}
+		sfx := "internal/config/testdata/not_a_dir) not a directory"
+		if !strings.HasSuffix(err.Error(), sfx) {
+			t.Errorf("Expected (%s) got (%s)", sfx, err)
+		}
+	}
+
+	t.Log("Valid directory")
+	{
+		viper.Set(KeyStateDir, "testdata")
+		if err := stateDir(); err != nil {
+			t.Fatalf("Expected NO error, got (%s)", err)
+		}
+		dir := viper.GetString(KeyStateDir)
+		sfx := "internal/config/testdata"
+		if !strings.HasSuffix(dir, sfx) {
+			t.Errorf("Expected (%s), got '%s'", sfx, dir)
+		}
+	}
+
+	viper.Reset()
+}
+
+func TestQueue(t *testing.T) {
+	t.Log("Testing queue")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("defaults")
+	{
+		viper.Reset()
+		if err := queue(); err != nil {
+			t.Fatalf("Expected NO error, got (%s)", err)
+		}
+		if viper.GetInt(KeyQueueSize) != defaults.QueueSize || viper.GetString(KeyQueuePolicy) != defaults.QueuePolicy {
+			t.Fatalf("Expected defaults, got %d %s", viper.GetInt(KeyQueueSize), viper.GetString(KeyQueuePolicy))
+		}
+	}
+
+	t.Log("invalid size")
+	{
+		viper.Set(KeyQueueSize, -1)
+		if err := queue(); err == nil {
+			t.Fatal("Expected error")
+		}
+	}
+
+	t.Log("invalid policy")
+	{
+		viper.Set(KeyQueueSize, 10)
+		viper.Set(KeyQueuePolicy, "drop-all")
+		if err := queue(); err == nil {
+			t.Fatal("Expected error")
+		}
+	}
+
+	t.Log("valid")
+	{
+		viper.Set(KeyQueuePolicy, QueueDropOldest)
+		if err := queue(); err != nil {
+			t.Fatalf("Expected NO error, got (%s)", err)
+		}
+	}
+
+	viper.Reset()
+}
+
 func TestApiConf(t *testing.T) {
 	t.Log("Testing apiConf")
 	zerolog.SetGlobalLevel(zerolog.Disabled)
@@ -560,3 +644,55 @@ func TestLoadCosiConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestHistogram(t *testing.T) {
+	t.Log("Testing histogram")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer viper.Reset()
+
+	t.Log("defaults")
+	{
+		viper.Reset()
+		if err := histogram(); err != nil {
+			t.Fatalf("Expected NO error, got (%s)", err)
+		}
+		if viper.GetString(KeyHistogramQuantiles) != defaults.HistogramQuantiles {
+			t.Fatalf("Expected default quantiles, got %s", viper.GetString(KeyHistogramQuantiles))
+		}
+	}
+
+	t.Log("invalid interval")
+	{
+		viper.Set(KeyHistogramInterval, "often")
+		if err := histogram(); err == nil {
+			t.Fatal("Expected error")
+		}
+		viper.Set(KeyHistogramInterval, "-10s")
+		if err := histogram(); err == nil {
+			t.Fatal("Expected error")
+		}
+	}
+
+	t.Log("invalid quantiles")
+	{
+		viper.Set(KeyHistogramInterval, "10s")
+		for _, qs := range []string{"p99", "0.5,1.5", " , "} {
+			viper.Set(KeyHistogramQuantiles, qs)
+			if err := histogram(); err == nil {
+				t.Fatalf("Expected error for %q", qs)
+			}
+		}
+	}
+
+	t.Log("valid")
+	{
+		viper.Set(KeyHistogramQuantiles, "0.5, 0.9,0.999")
+		if err := histogram(); err != nil {
+			t.Fatalf("Expected NO error, got (%s)", err)
+		}
+		qs, err := ParseQuantiles(viper.GetString(KeyHistogramQuantiles))
+		if err != nil || len(qs) != 3 || qs[2] != 0.999 {
+			t.Fatalf("Expected [0.5 0.9 0.999], got %v %v", qs, err)
+		}
+	}
+}
@@ -26,6 +26,19 @@ const (
 	// AppStatPort for accessing runtime metrics (expvar).
 	AppStatPort = "33284"
 
+	// HealthThreshold how long a watcher may be down, or the destination
+	// failing, before reporting unhealthy.
+	HealthThreshold = "5m"
+
+	// QueuePolicy what a watcher does when a queue is full.
+	QueuePolicy = "block"
+
+	// QueueSize capacity of each watcher queue.
+	QueueSize = 1000
+
+	// HistogramQuantiles sent for histograms aggregated locally.
+	HistogramQuantiles = "0.5,0.9,0.99"
+
 	// LogLevel set to info by default.
 	LogLevel = "info"
 
@@ -0,0 +1,337 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Condition is a compiled rule 'where' expression, evaluated against the
+// named subexpressions of a matched line.
+//
+// Supported syntax:
+//
+//	identifiers   named subexpressions from the rule match (e.g. status)
+//	literals      'single' or "double" quoted strings, numbers, true, false
+//	comparison    == != < <= > >=  (numeric when both sides are numbers)
+//	regex         =~ !~            (right side must be a string literal)
+//	logical       && || !  and parentheses for grouping
+//
+// e.g. `status >= 500 && method != 'OPTIONS' && path !~ '^/health'`.
+type Condition struct {
+	root   condNode
+	expr   string
+	Idents []string
+}
+
+// Lookup returns the value of a named subexpression for a matched line.
+type Lookup func(name string) (string, bool)
+
+// NewCondition compiles a condition expression.
+func NewCondition(expr string) (*Condition, error) {
+	toks, err := condLexer.lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &condParser{parser{toks: toks}}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.done(); err != nil {
+		return nil, err
+	}
+	c := &Condition{root: root, expr: expr}
+	c.Idents = condIdents(root, nil)
+	return c, nil
+}
+
+// String returns the source expression.
+func (c *Condition) String() string {
+	return c.expr
+}
+
+// Eval evaluates the condition using lookup to resolve identifiers.
+// Identifiers without a value evaluate as an empty string.
+func (c *Condition) Eval(lookup Lookup) bool {
+	return c.root.eval(lookup).truthy()
+}
+
+//
+// values
+//
+
+type condValue struct {
+	s     string
+	isNum bool
+	n     float64
+}
+
+func strValue(s string) condValue {
+	v := condValue{s: s}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		v.isNum = true
+		v.n = n
+	}
+	return v
+}
+
+func boolValue(b bool) condValue {
+	if b {
+		return condValue{s: "true", isNum: true, n: 1}
+	}
+	return condValue{s: "false", isNum: true, n: 0}
+}
+
+func (v condValue) truthy() bool {
+	if v.isNum {
+		return v.n != 0
+	}
+	return v.s != "" && v.s != "false"
+}
+
+//
+// nodes
+//
+
+type condNode interface {
+	eval(Lookup) condValue
+}
+
+type identNode struct{ name string }
+
+func (n *identNode) eval(lookup Lookup) condValue {
+	v, _ := lookup(n.name)
+	return strValue(v)
+}
+
+type literalNode struct{ val condValue }
+
+func (n *literalNode) eval(Lookup) condValue { return n.val }
+
+type notNode struct{ expr condNode }
+
+func (n *notNode) eval(lookup Lookup) condValue { return boolValue(!n.expr.eval(lookup).truthy()) }
+
+type logicNode struct {
+	left  condNode
+	right condNode
+	and   bool
+}
+
+func (n *logicNode) eval(lookup Lookup) condValue {
+	l := n.left.eval(lookup).truthy()
+	if n.and {
+		return boolValue(l && n.right.eval(lookup).truthy())
+	}
+	return boolValue(l || n.right.eval(lookup).truthy())
+}
+
+type compareNode struct {
+	left  condNode
+	right condNode
+	op    string
+}
+
+func (n *compareNode) eval(lookup Lookup) condValue {
+	l := n.left.eval(lookup)
+	r := n.right.eval(lookup)
+	if l.isNum && r.isNum {
+		switch n.op {
+		case "==":
+			return boolValue(l.n == r.n)
+		case "!=":
+			return boolValue(l.n != r.n)
+		case "<":
+			return boolValue(l.n < r.n)
+		case "<=":
+			return boolValue(l.n <= r.n)
+		case ">":
+			return boolValue(l.n > r.n)
+		case ">=":
+			return boolValue(l.n >= r.n)
+		}
+	}
+	switch n.op {
+	case "==":
+		return boolValue(l.s == r.s)
+	case "!=":
+		return boolValue(l.s != r.s)
+	case "<":
+		return boolValue(l.s < r.s)
+	case "<=":
+		return boolValue(l.s <= r.s)
+	case ">":
+		return boolValue(l.s > r.s)
+	case ">=":
+		return boolValue(l.s >= r.s)
+	}
+	return boolValue(false)
+}
+
+type regexNode struct {
+	left   condNode
+	re     *regexp.Regexp
+	negate bool
+}
+
+func (n *regexNode) eval(lookup Lookup) condValue {
+	return boolValue(n.re.MatchString(n.left.eval(lookup).s) != n.negate)
+}
+
+func condIdents(node condNode, idents []string) []string {
+	switch n := node.(type) {
+	case *identNode:
+		for _, id := range idents {
+			if id == n.name {
+				return idents
+			}
+		}
+		return append(idents, n.name)
+	case *notNode:
+		return condIdents(n.expr, idents)
+	case *logicNode:
+		return condIdents(n.right, condIdents(n.left, idents))
+	case *compareNode:
+		return condIdents(n.right, condIdents(n.left, idents))
+	case *regexNode:
+		return condIdents(n.left, idents)
+	}
+	return idents
+}
+
+//
+// parser
+//
+
+var condLexer = &lexer{
+	ops:           []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!"},
+	signedNumbers: true,
+}
+
+type condParser struct {
+	parser
+}
+
+func (p *condParser) parseOr() (condNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{left: left, right: right}
+	}
+}
+
+func (p *condParser) parseAnd() (condNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{left: left, right: right, and: true}
+	}
+}
+
+func (p *condParser) parseUnary() (condNode, error) {
+	if _, ok := p.accept("!"); ok {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{expr: expr}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *condParser) parseCompare() (condNode, error) {
+	t := p.peek()
+	if t != nil && t.kind == tokLParen {
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	t = p.peek()
+	if t == nil || t.kind != tokOp {
+		return left, nil
+	}
+
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &compareNode{left: left, right: right, op: t.text}, nil
+	case "=~", "!~":
+		p.pos++
+		rt := p.peek()
+		if rt == nil || rt.kind != tokString {
+			return nil, fmt.Errorf("%s requires a quoted regular expression at offset %d", t.text, t.pos)
+		}
+		p.pos++
+		re, err := regexp.Compile(rt.text)
+		if err != nil {
+			return nil, fmt.Errorf("regex at offset %d: %w", rt.pos, err)
+		}
+		return &regexNode{left: left, re: re, negate: t.text == "!~"}, nil
+	}
+
+	return left, nil
+}
+
+func (p *condParser) parseOperand() (condNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, errors.New("unexpected end of expression")
+	}
+	p.pos++
+	switch t.kind {
+	case tokString:
+		return &literalNode{val: condValue{s: t.text}}, nil
+	case tokNumber:
+		return &literalNode{val: strValue(t.text)}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{val: boolValue(true)}, nil
+		case "false":
+			return &literalNode{val: boolValue(false)}, nil
+		}
+		return &identNode{name: t.text}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
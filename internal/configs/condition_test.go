@@ -0,0 +1,96 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"testing"
+)
+
+func TestNewCondition(t *testing.T) {
+	t.Log("Testing NewCondition")
+
+	invalid := []string{
+		"",
+		"status >=",
+		"(status > 1",
+		"status > 1)",
+		"status =~ path",
+		"path =~ '[a-'",
+		"method == 'GET",
+		"status # 1",
+		"status > 1 &&",
+	}
+
+	for _, expr := range invalid {
+		t.Logf("invalid %q", expr)
+		if _, err := NewCondition(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+
+	t.Log("idents")
+	{
+		c, err := NewCondition("status >= 500 && (method != 'OPTIONS' || status == 503) && !path")
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if len(c.Idents) != 3 {
+			t.Fatalf("expected 3 idents, got %v", c.Idents)
+		}
+	}
+}
+
+func TestConditionEval(t *testing.T) {
+	t.Log("Testing Condition.Eval")
+
+	matches := map[string]string{
+		"status": "503",
+		"method": "GET",
+		"path":   "/api/users",
+		"bytes":  "1.5",
+		"empty":  "",
+	}
+
+	tests := []struct {
+		expr   string
+		expect bool
+	}{
+		{"status >= 500", true},
+		{"status >= 500 && method != 'OPTIONS'", true},
+		{"status < 500", false},
+		{"status == 503", true},
+		{"status == '503'", true},
+		{"bytes > 1.25", true},
+		{"bytes <= -1", false},
+		{"method == \"GET\"", true},
+		{"method != 'GET' || status == 503", true},
+		{"!(status >= 500)", false},
+		{"path =~ '^/api/'", true},
+		{"path !~ '^/health'", true},
+		{"path =~ '^/health'", false},
+		{"empty", false},
+		{"!empty", true},
+		{"method", true},
+		{"missing == ''", true},
+		{"true && !false", true},
+		{"status >= 500 && method == 'POST' || path =~ 'users$'", true},
+		{"status >= 500 && (method == 'POST' || path =~ 'health')", false},
+	}
+
+	lookup := func(name string) (string, bool) {
+		v, ok := matches[name]
+		return v, ok
+	}
+	for _, test := range tests {
+		c, err := NewCondition(test.expr)
+		if err != nil {
+			t.Fatalf("%q: expected no error, got (%s)", test.expr, err)
+		}
+		if got := c.Eval(lookup); got != test.expect {
+			t.Fatalf("%q: expected %v got %v", test.expr, test.expect, got)
+		}
+	}
+}
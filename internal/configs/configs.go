@@ -18,6 +18,7 @@ import (
 	"text/template"
 
 	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/config/defaults"
 	"github.com/pelletier/go-toml"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -32,19 +33,50 @@ type Metric struct {
 	Tagger     *template.Template
 	Type       string `json:"type" yaml:"type" toml:"type"`
 	ValueKey   string
-	Match      string `json:"match" yaml:"match" toml:"match"`
-	Name       string `json:"name" yaml:"name" toml:"name"`
-	Tags       string `json:"tags" toml:"tags" yaml:"tags"`
+	Match      string     `json:"match" yaml:"match" toml:"match"`
+	Name       string     `json:"name" yaml:"name" toml:"name"`
+	Tags       string     `json:"tags" toml:"tags" yaml:"tags"`
+	Normalize  *Normalize `json:"normalize" yaml:"normalize" toml:"normalize"`
+	Condition  *Condition
+	Where      string   `json:"where" yaml:"where" toml:"where"`
+	Exclude    []string `json:"exclude" yaml:"exclude" toml:"exclude"`
+	Excluders  []*regexp.Regexp
+	Transform  *ValueTransform `json:"value_transform" yaml:"value_transform" toml:"value_transform"`
+	Set        *Set            `json:"set" yaml:"set" toml:"set"`
+	Lookups    []*LookupTable
+	Classify   []*IPClassifier
 	MatchParts []string
+	MaxSeries  int `json:"max_series" yaml:"max_series" toml:"max_series"`
 }
 
 // Config defines a log to watch.
 type Config struct {
-	ID      string    `json:"id" yaml:"id" toml:"id"`
-	LogFile string    `json:"log_file" yaml:"log_file" toml:"log_file"`
-	Metrics []*Metric `json:"metrics" yaml:"metrics" toml:"metrics"`
+	Timestamp         *Timestamp      `json:"timestamp" yaml:"timestamp" toml:"timestamp"`
+	ID                string          `json:"id" yaml:"id" toml:"id"`
+	LogFile           string          `json:"log_file" yaml:"log_file" toml:"log_file"`
+	Watch             string          `json:"watch" yaml:"watch" toml:"watch"`
+	Metrics           []*Metric       `json:"metrics" yaml:"metrics" toml:"metrics"`
+	Derived           []*Derived      `json:"derived" yaml:"derived" toml:"derived"`
+	Lookups           []*LookupTable  `json:"lookups" yaml:"lookups" toml:"lookups"`
+	IPClassify        []*IPClassifier `json:"ip_classify" yaml:"ip_classify" toml:"ip_classify"`
+	Sample            *Sample         `json:"sample" yaml:"sample" toml:"sample"`
+	QueuePolicy       string          `json:"queue_policy" yaml:"queue_policy" toml:"queue_policy"`
+	QueueSize         int             `json:"queue_size" yaml:"queue_size" toml:"queue_size"`
+	Workers           int             `json:"workers" yaml:"workers" toml:"workers"`
+	MaxLinesPerSecond int             `json:"max_lines_per_second" yaml:"max_lines_per_second" toml:"max_lines_per_second"`
+	MaxLineBytes      int             `json:"max_line_bytes" yaml:"max_line_bytes" toml:"max_line_bytes"`
+	LongLines         string          `json:"long_lines" yaml:"long_lines" toml:"long_lines"`
+	Encoding          string          `json:"encoding" yaml:"encoding" toml:"encoding"`
+	InvalidUTF8       string          `json:"invalid_utf8" yaml:"invalid_utf8" toml:"invalid_utf8"`
 }
 
+// File change detection strategies for Config.Watch.
+const (
+	WatchAuto    = "auto"    // inotify on Linux, falling back to polling if inotify fails, polling elsewhere
+	WatchInotify = "inotify" // inotify (fsnotify on other platforms)
+	WatchPoll    = "poll"    // poll the file for changes
+)
+
 // Load reads the log configurations from log config directory.
 func Load() ([]*Config, error) {
 	logger := log.With().Str("pkg", "configs").Logger()
@@ -112,9 +144,91 @@ func Load() ([]*Config, error) {
 			logcfg.ID = strings.ReplaceAll(filepath.Base(logcfg.LogFile), filepath.Ext(logcfg.LogFile), "")
 		}
 
-		if validMetricRules(logcfg.ID, logger, logcfg.Metrics) {
-			cfgs = append(cfgs, &logcfg)
+		if logcfg.Timestamp != nil {
+			if err := logcfg.Timestamp.init(); err != nil {
+				logger.Warn().
+					Err(err).
+					Str("log_id", logcfg.ID).
+					Msg("invalid timestamp settings, skipping config")
+				continue
+			}
+		}
+
+		switch strings.ToLower(logcfg.Watch) {
+		case "", WatchAuto:
+			logcfg.Watch = WatchAuto
+		case WatchInotify, WatchPoll:
+			logcfg.Watch = strings.ToLower(logcfg.Watch)
+		default:
+			logger.Warn().
+				Str("log_id", logcfg.ID).
+				Str("watch", logcfg.Watch).
+				Msg("invalid watch, must be auto, inotify or poll, skipping config")
+			continue
+		}
+
+		if logcfg.Workers < 0 {
+			logger.Warn().
+				Str("log_id", logcfg.ID).
+				Int("workers", logcfg.Workers).
+				Msg("invalid workers, must be >= 0, skipping config")
+			continue
+		}
+		if logcfg.Workers == 0 {
+			logcfg.Workers = 1
+		}
+
+		if err := queueSettings(&logcfg); err != nil {
+			logger.Warn().
+				Err(err).
+				Str("log_id", logcfg.ID).
+				Msg("invalid queue settings, skipping config")
+			continue
+		}
+
+		if logcfg.MaxLinesPerSecond < 0 {
+			logger.Warn().
+				Str("log_id", logcfg.ID).
+				Int("max_lines_per_second", logcfg.MaxLinesPerSecond).
+				Msg("invalid max_lines_per_second, must be >= 0, skipping config")
+			continue
+		}
+
+		if err := inputSettings(&logcfg); err != nil {
+			logger.Warn().
+				Err(err).
+				Str("log_id", logcfg.ID).
+				Msg("invalid line settings, skipping config")
+			continue
+		}
+
+		if !validMetricRules(logcfg.ID, logger, logcfg.Metrics) {
+			continue
+		}
+
+		if logcfg.Sample != nil {
+			if err := logcfg.Sample.init(logcfg.Metrics); err != nil {
+				logger.Warn().
+					Err(err).
+					Str("log_id", logcfg.ID).
+					Msg("invalid sample settings, skipping config")
+				continue
+			}
+		}
+
+		if !validLookups(logcfg.ID, logger, logcfg.Lookups, logcfg.Metrics) {
+			continue
 		}
+
+		if !validIPClassify(logcfg.ID, logger, logcfg.IPClassify, logcfg.Metrics) {
+			continue
+		}
+
+		if !validDerived(logcfg.ID, logger, logcfg.Derived, logcfg.Metrics) {
+			continue
+		}
+
+		cfgs = append(cfgs, &logcfg)
 	}
 
 	if len(cfgs) == 0 {
@@ -124,6 +238,27 @@ func Load() ([]*Config, error) {
 	return cfgs, nil
 }
 
+// queueSettings applies the default queue size and policy, from the
+// agent config, and verifies them.
+func queueSettings(logcfg *Config) error {
+	if logcfg.QueueSize == 0 {
+		logcfg.QueueSize = viper.GetInt(config.KeyQueueSize)
+		if logcfg.QueueSize == 0 {
+			logcfg.QueueSize = defaults.QueueSize
+		}
+	}
+	if logcfg.QueueSize < 0 {
+		return fmt.Errorf("invalid queue_size (%d), must be greater than zero", logcfg.QueueSize)
+	}
+	if logcfg.QueuePolicy == "" {
+		logcfg.QueuePolicy = viper.GetString(config.KeyQueuePolicy)
+		if logcfg.QueuePolicy == "" {
+			logcfg.QueuePolicy = defaults.QueuePolicy
+		}
+	}
+	return config.ValidQueuePolicy(logcfg.QueuePolicy)
+}
+
 func validMetricRules(logID string, logger zerolog.Logger, rules []*Metric) bool {
 	for ruleID, rule := range rules {
 		if rule.Match == "" {
@@ -187,8 +322,104 @@ func validMetricRules(logID string, logger zerolog.Logger, rules []*Metric) bool
 			}
 		}
 
+		rule.Excluders = make([]*regexp.Regexp, 0, len(rule.Exclude))
+		for _, exclude := range rule.Exclude {
+			excluder, err := regexp.Compile(exclude)
+			if err != nil {
+				logger.Warn().
+					Err(err).
+					Str("log_id", logID).
+					Int("rule_id", ruleID).
+					Str("exclude", exclude).
+					Msg("rule exclude compile failed, skipping config")
+				return false
+			}
+			rule.Excluders = append(rule.Excluders, excluder)
+		}
+
+		if rule.Where != "" {
+			cond, err := NewCondition(rule.Where)
+			if err != nil {
+				logger.Warn().
+					Err(err).
+					Str("log_id", logID).
+					Int("rule_id", ruleID).
+					Str("where", rule.Where).
+					Msg("rule where parse failed, skipping config")
+				return false
+			}
+			for _, ident := range cond.Idents {
+				if !hasMatchPart(rule.MatchParts, ident) {
+					logger.Warn().
+						Str("log_id", logID).
+						Int("rule_id", ruleID).
+						Str("where", rule.Where).
+						Str("ident", ident).
+						Msg("rule where references unknown named subexpression, skipping config")
+					return false
+				}
+			}
+			rule.Condition = cond
+		}
+
+		if rule.Transform != nil {
+			if rule.ValueKey == "" {
+				logger.Warn().
+					Str("log_id", logID).
+					Int("rule_id", ruleID).
+					Msg("'value_transform' requires a subexpression named 'Value', skipping config")
+				return false
+			}
+			if err := rule.Transform.init(); err != nil {
+				logger.Warn().
+					Err(err).
+					Str("log_id", logID).
+					Int("rule_id", ruleID).
+					Msg("invalid value_transform settings, skipping config")
+				return false
+			}
+		}
+
+		if rule.Set != nil {
+			if rule.Type != "s" {
+				logger.Warn().
+					Str("log_id", logID).
+					Int("rule_id", ruleID).
+					Msg("'set' requires type 's', skipping config")
+				return false
+			}
+			if err := rule.Set.init(); err != nil {
+				logger.Warn().
+					Err(err).
+					Str("log_id", logID).
+					Int("rule_id", ruleID).
+					Msg("invalid set settings, skipping config")
+				return false
+			}
+		}
+
+		if rule.MaxSeries < 0 {
+			logger.Warn().
+				Str("log_id", logID).
+				Int("rule_id", ruleID).
+				Int("max_series", rule.MaxSeries).
+				Msg("invalid metric rule, 'max_series' must be >= 0, skipping config")
+			return false
+		}
+
+		if rule.Normalize != nil {
+			if err := rule.Normalize.init(rule.MatchParts); err != nil {
+				logger.Warn().
+					Err(err).
+					Str("log_id", logID).
+					Int("rule_id", ruleID).
+					Msg("invalid normalize settings, skipping config")
+				return false
+			}
+		}
+
 		// name contains template interpolation code
-		if strings.Contains(rule.Name, "{{.") {
+		if strings.Contains(rule.Name, "{{") {
 			if len(rule.MatchParts) < 2 {
 				logger.Warn().
 					Str("log_id", logID).
@@ -199,7 +430,7 @@ func validMetricRules(logID string, logger zerolog.Logger, rules []*Metric) bool
 				return false
 			}
 			templateID := fmt.Sprintf("%s:M%d-name", logID, ruleID)
-			namer, err := template.New(templateID).Parse(rule.Name)
+			namer, err := newTemplate(templateID, rule.Name)
 			if err != nil {
 				logger.Warn().
 					Err(err).
@@ -221,7 +452,7 @@ func validMetricRules(logID string, logger zerolog.Logger, rules []*Metric) bool
 		}
 
 		// tags contains template interpolation code
-		if strings.Contains(rule.Tags, "{{.") {
+		if strings.Contains(rule.Tags, "{{") {
 			if len(rule.MatchParts) < 2 {
 				logger.Warn().
 					Str("log_id", logID).
@@ -232,7 +463,7 @@ func validMetricRules(logID string, logger zerolog.Logger, rules []*Metric) bool
 				return false
 			}
 			templateID := fmt.Sprintf("%s:M%d-tags", logID, ruleID)
-			tagger, err := template.New(templateID).Parse(rule.Tags)
+			tagger, err := newTemplate(templateID, rule.Tags)
 			if err != nil {
 				logger.Warn().
 					Err(err).
@@ -258,6 +489,96 @@ func validMetricRules(logID string, logger zerolog.Logger, rules []*Metric) bool
 	return true
 }
 
+func validLookups(logID string, logger zerolog.Logger, lookups []*LookupTable, rules []*Metric) bool {
+	names := make(map[string]bool, len(lookups))
+	for lookupID, l := range lookups {
+		used, err := l.init(rules)
+		if err != nil {
+			logger.Warn().
+				Err(err).
+				Str("log_id", logID).
+				Int("lookup_id", lookupID).
+				Msg("invalid lookup, skipping config")
+			return false
+		}
+		if names[l.Name] {
+			logger.Warn().
+				Str("log_id", logID).
+				Int("lookup_id", lookupID).
+				Str("name", l.Name).
+				Msg("duplicate lookup name, skipping config")
+			return false
+		}
+		names[l.Name] = true
+		for _, rule := range used {
+			rule.Lookups = append(rule.Lookups, l)
+		}
+	}
+	return true
+}
+
+func validIPClassify(logID string, logger zerolog.Logger, classifiers []*IPClassifier, rules []*Metric) bool {
+	names := make(map[string]bool, len(classifiers))
+	for classifierID, c := range classifiers {
+		used, err := c.init(rules)
+		if err != nil {
+			logger.Warn().
+				Err(err).
+				Str("log_id", logID).
+				Int("ip_classify_id", classifierID).
+				Msg("invalid ip_classify, skipping config")
+			return false
+		}
+		if names[c.Name] {
+			logger.Warn().
+				Str("log_id", logID).
+				Int("ip_classify_id", classifierID).
+				Str("name", c.Name).
+				Msg("duplicate ip_classify name, skipping config")
+			return false
+		}
+		names[c.Name] = true
+		for _, rule := range used {
+			rule.Classify = append(rule.Classify, c)
+		}
+	}
+	return true
+}
+
+func validDerived(logID string, logger zerolog.Logger, derived []*Derived, rules []*Metric) bool {
+	names := make(map[string]bool, len(derived))
+	for derivedID, d := range derived {
+		if err := d.init(rules); err != nil {
+			logger.Warn().
+				Err(err).
+				Str("log_id", logID).
+				Int("derived_id", derivedID).
+				Msg("invalid derived metric, skipping config")
+			return false
+		}
+		if names[d.Name] {
+			logger.Warn().
+				Str("log_id", logID).
+				Int("derived_id", derivedID).
+				Str("name", d.Name).
+				Msg("duplicate derived metric name, skipping config")
+			return false
+		}
+		names[d.Name] = true
+	}
+	return true
+}
+
+// hasMatchPart reports whether name is a named subexpression of the rule match.
+func hasMatchPart(matchParts []string, name string) bool {
+	for _, part := range matchParts {
+		if part != "" && part == name {
+			return true
+		}
+	}
+	return false
+}
+
 // parse reads and parses a log configuration.
 func parse(cfgType, cfgFile string) (Config, error) {
 	var cfg Config
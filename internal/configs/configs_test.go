@@ -62,6 +62,45 @@ func TestLoadConfigs(t *testing.T) {
 			t.Fatal("expected >0 configs")
 		}
 
+		for _, cfg := range cfgs {
+			if cfg.ID == "bad_watch" {
+				t.Fatal("expected config with invalid watch to be skipped")
+			}
+			if cfg.Watch != WatchAuto {
+				t.Fatalf("expected watch %s, got %s", WatchAuto, cfg.Watch)
+			}
+			if cfg.ID == "bad_workers" {
+				t.Fatal("expected config with invalid workers to be skipped")
+			}
+			if cfg.Workers != 1 {
+				t.Fatalf("expected 1 worker, got %d", cfg.Workers)
+			}
+			if cfg.ID == "bad_sample" {
+				t.Fatal("expected config with invalid sample field to be skipped")
+			}
+			if cfg.ID == "bad_ip_classify" {
+				t.Fatal("expected config with ip_classify without networks or mmdb to be skipped")
+			}
+			if cfg.ID == "bad_lookup" {
+				t.Fatal("expected config with missing lookup file to be skipped")
+			}
+			if cfg.ID == "bad_derived" {
+				t.Fatal("expected config with unknown derived rule reference to be skipped")
+			}
+			if cfg.ID == "bad_encoding" {
+				t.Fatal("expected config with invalid encoding to be skipped")
+			}
+			if cfg.Encoding != EncodingUTF8 || cfg.LongLines != LongLinesTruncate || cfg.InvalidUTF8 != InvalidUTF8Pass {
+				t.Fatalf("expected default line settings, got %s %s %s", cfg.Encoding, cfg.LongLines, cfg.InvalidUTF8)
+			}
+			if cfg.ID == "bad_queue" {
+				t.Fatal("expected config with invalid queue policy to be skipped")
+			}
+			if cfg.QueueSize != 1000 || cfg.QueuePolicy != "block" {
+				t.Fatalf("expected default queue settings, got %d %s", cfg.QueueSize, cfg.QueuePolicy)
+			}
+		}
+
 		t.Logf("%#v\n", cfgs[0])
 		for i, m := range cfgs[0].Metrics {
 			t.Logf("\trule: %d = %#v\n", i, m)
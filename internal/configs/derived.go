@@ -0,0 +1,328 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultDerivedInterval = time.Minute
+
+// Derived defines a metric computed from the metrics of other rules in
+// the log config. Each interval the expression is evaluated with every
+// rule name referenced replaced by the rule's total for the interval and
+// the result is sent as a gauge.
+//
+// Supported syntax:
+//
+//	identifiers   rule names (e.g. requests), quote names with other
+//	              characters ('http`5xx')
+//	literals      numbers
+//	arithmetic    + - * /  and parentheses for grouping
+//	rate(expr)    expr per second over the interval
+//
+// e.g. `errors / requests` or `hits / (hits + misses)`.
+//
+// The total of a counter rule is the sum of its increments, for other
+// types it is the number of values.
+type Derived struct {
+	Name     string `json:"name" yaml:"name" toml:"name"`
+	Expr     string `json:"expr" yaml:"expr" toml:"expr"`
+	Tags     string `json:"tags" yaml:"tags" toml:"tags"`
+	Interval string `json:"interval" yaml:"interval" toml:"interval"`
+	Refs     []string
+	root     exprNode
+	interval time.Duration
+}
+
+// init validates the derived metric, references must be to rules with
+// a static name.
+func (d *Derived) init(rules []*Metric) error {
+	if d.Name == "" {
+		return errors.New("invalid derived metric, empty 'name'")
+	}
+	if strings.Contains(d.Tags, "{{") {
+		return fmt.Errorf("derived metric (%s) tags cannot be templates", d.Name)
+	}
+
+	root, err := parseExpr(d.Expr)
+	if err != nil {
+		return fmt.Errorf("derived metric (%s) expr: %w", d.Name, err)
+	}
+	d.root = root
+	d.Refs = exprIdents(root, nil)
+	if len(d.Refs) == 0 {
+		return fmt.Errorf("derived metric (%s) expr references no rules", d.Name)
+	}
+	for _, ref := range d.Refs {
+		found := false
+		for _, rule := range rules {
+			if rule.Namer == nil && rule.Name == ref {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("derived metric (%s) references unknown rule name (%s)", d.Name, ref)
+		}
+	}
+
+	d.interval = defaultDerivedInterval
+	if d.Interval != "" {
+		dur, err := time.ParseDuration(d.Interval)
+		if err != nil {
+			return fmt.Errorf("parsing derived metric (%s) interval: %w", d.Name, err)
+		}
+		if dur < time.Second {
+			return fmt.Errorf("invalid derived metric (%s) interval (%s), must be at least 1s", d.Name, d.Interval)
+		}
+		d.interval = dur
+	}
+
+	return nil
+}
+
+// Period returns the interval the derived metric is computed over.
+func (d *Derived) Period() time.Duration {
+	if d.interval == 0 {
+		return defaultDerivedInterval
+	}
+	return d.interval
+}
+
+// UsesRate reports whether the expression uses rate(), which requires
+// the interval to be the time the lines were processed over.
+func (d *Derived) UsesRate() bool {
+	return exprHasRate(d.root)
+}
+
+// Eval computes the derived metric from the rule totals of an interval
+// lasting seconds. ok is false if the result is not a number, e.g. a
+// ratio with no lines matching the denominator.
+func (d *Derived) Eval(totals map[string]float64, seconds float64) (float64, bool) {
+	if d.root == nil {
+		return 0, false
+	}
+	v := d.root.eval(totals, seconds)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+//
+// nodes
+//
+
+type exprNode interface {
+	eval(totals map[string]float64, seconds float64) float64
+}
+
+type refNode struct{ name string }
+
+func (n *refNode) eval(totals map[string]float64, _ float64) float64 { return totals[n.name] }
+
+type numNode struct{ val float64 }
+
+func (n *numNode) eval(map[string]float64, float64) float64 { return n.val }
+
+type negNode struct{ expr exprNode }
+
+func (n *negNode) eval(totals map[string]float64, seconds float64) float64 {
+	return -n.expr.eval(totals, seconds)
+}
+
+type rateNode struct{ expr exprNode }
+
+func (n *rateNode) eval(totals map[string]float64, seconds float64) float64 {
+	if seconds <= 0 {
+		return math.NaN()
+	}
+	return n.expr.eval(totals, seconds) / seconds
+}
+
+type binaryNode struct {
+	left  exprNode
+	right exprNode
+	op    byte
+}
+
+func (n *binaryNode) eval(totals map[string]float64, seconds float64) float64 {
+	l := n.left.eval(totals, seconds)
+	r := n.right.eval(totals, seconds)
+	switch n.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	case '/':
+		if r == 0 {
+			return math.NaN()
+		}
+		return l / r
+	}
+	return math.NaN()
+}
+
+func exprHasRate(node exprNode) bool {
+	switch n := node.(type) {
+	case *rateNode:
+		return true
+	case *negNode:
+		return exprHasRate(n.expr)
+	case *binaryNode:
+		return exprHasRate(n.left) || exprHasRate(n.right)
+	}
+	return false
+}
+
+func exprIdents(node exprNode, idents []string) []string {
+	switch n := node.(type) {
+	case *refNode:
+		for _, id := range idents {
+			if id == n.name {
+				return idents
+			}
+		}
+		return append(idents, n.name)
+	case *negNode:
+		return exprIdents(n.expr, idents)
+	case *rateNode:
+		return exprIdents(n.expr, idents)
+	case *binaryNode:
+		return exprIdents(n.right, exprIdents(n.left, idents))
+	}
+	return idents
+}
+
+//
+// parser
+//
+
+var exprLexer = &lexer{
+	identChars: ".",
+	ops:        []string{"+", "-", "*", "/"},
+}
+
+type exprParser struct {
+	parser
+}
+
+func parseExpr(expr string) (exprNode, error) {
+	toks, err := exprLexer.lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{parser{toks: toks}}
+	root, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.done(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{left: left, right: right, op: op[0]}
+	}
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{left: left, right: right, op: op[0]}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.accept("-"); ok {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negNode{expr: expr}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *exprParser) parseGroup() (exprNode, error) {
+	if err := p.expect(tokLParen, "'('"); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokRParen, "')'"); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, errors.New("unexpected end of expression")
+	}
+	switch t.kind {
+	case tokLParen:
+		return p.parseGroup()
+	case tokNumber:
+		p.pos++
+		v, _ := strconv.ParseFloat(t.text, 64)
+		return &numNode{val: v}, nil
+	case tokString:
+		p.pos++
+		return &refNode{name: t.text}, nil
+	case tokIdent:
+		p.pos++
+		if next := p.peek(); next != nil && next.kind == tokLParen {
+			if t.text != "rate" {
+				return nil, fmt.Errorf("unknown function %q at offset %d", t.text, t.pos)
+			}
+			expr, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+			return &rateNode{expr: expr}, nil
+		}
+		return &refNode{name: t.text}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
@@ -0,0 +1,87 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestDerived(t *testing.T) {
+	t.Log("Testing Derived")
+
+	rules := []*Metric{
+		{Name: "requests"},
+		{Name: "errors"},
+		{Name: "http`5xx"},
+		{Name: "{{.Name}}", Namer: template.Must(template.New("name").Parse("{{.Name}}"))},
+	}
+
+	invalid := []Derived{
+		{Expr: "errors / requests"},
+		{Name: "d", Expr: ""},
+		{Name: "d", Expr: "errors /"},
+		{Name: "d", Expr: "(errors / requests"},
+		{Name: "d", Expr: "errors / requests)"},
+		{Name: "d", Expr: "errors % requests"},
+		{Name: "d", Expr: "'errors / requests"},
+		{Name: "d", Expr: "avg(errors)"},
+		{Name: "d", Expr: "1 / 2"},
+		{Name: "d", Expr: "errors / misses"},
+		{Name: "d", Expr: "rate('{{.Name}}')"},
+		{Name: "d", Expr: "errors", Tags: "a:{{.b}}"},
+		{Name: "d", Expr: "errors", Interval: "10ms"},
+		{Name: "d", Expr: "errors", Interval: "often"},
+	}
+	for _, d := range invalid {
+		d := d
+		if err := d.init(rules); err == nil {
+			t.Fatalf("%#v: expected error", d)
+		}
+	}
+
+	t.Log("valid")
+	{
+		d := Derived{Name: "d", Expr: "errors / (requests + errors) - rate(requests) + 'http`5xx' * -2", Interval: "10s"}
+		if err := d.init(rules); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if len(d.Refs) != 3 || d.Refs[0] != "errors" || d.Refs[1] != "requests" || d.Refs[2] != "http`5xx" {
+			t.Fatalf("unexpected refs %v", d.Refs)
+		}
+		if d.Period() != 10*time.Second {
+			t.Fatalf("expected 10s, got %s", d.Period())
+		}
+		if !d.UsesRate() {
+			t.Fatal("expected rate() used")
+		}
+		v, ok := d.Eval(map[string]float64{"errors": 10, "requests": 30, "http`5xx": 1}, 10)
+		if !ok || v != 0.25-3-2 {
+			t.Fatalf("expected -4.75, got %v %v", v, ok)
+		}
+	}
+
+	t.Log("no value")
+	{
+		d := Derived{Name: "d", Expr: "errors / requests"}
+		if err := d.init(rules); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if d.Period() != time.Minute {
+			t.Fatalf("expected default 1m, got %s", d.Period())
+		}
+		if d.UsesRate() {
+			t.Fatal("expected rate() not used")
+		}
+		if v, ok := d.Eval(map[string]float64{}, 60); ok {
+			t.Fatalf("expected no value, got %v", v)
+		}
+		if v, ok := d.Eval(map[string]float64{"requests": 4}, 60); !ok || v != 0 {
+			t.Fatalf("expected 0, got %v %v", v, ok)
+		}
+	}
+}
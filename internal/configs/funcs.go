@@ -0,0 +1,194 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	tmplparse "text/template/parse"
+)
+
+// templateFuncs is the curated function library available to the
+// name and tags templates of a metric rule.
+//
+// Functions taking more than one argument accept the value being
+// operated on as the *last* argument so they can be used in pipelines
+// e.g. `{{.path | stripQuery | trunc 64}}`.
+var templateFuncs = template.FuncMap{
+	"lower":        strings.ToLower,
+	"upper":        strings.ToUpper,
+	"trim":         strings.TrimSpace,
+	"trimPrefix":   func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix":   func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"contains":     func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":    func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":    func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"replace":      func(old, repl, s string) string { return strings.ReplaceAll(s, old, repl) },
+	"regexReplace": regexReplace,
+	"trunc":        trunc,
+	"default":      defaultValue,
+	"statusClass":  statusClass,
+	"stripQuery":   stripQuery,
+	"pathTemplate": pathTemplate,
+	"hash":         hash,
+	"tagSafe":      tagSafe,
+}
+
+// regexCache holds compiled regexReplace patterns so each is compiled once.
+var regexCache sync.Map
+
+// newTemplate parses text into a template with the function library registered.
+func newTemplate(id, text string) (*template.Template, error) {
+	t, err := template.New(id).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		if strings.Contains(err.Error(), "not defined") {
+			return nil, fmt.Errorf("unknown template function: %w", err)
+		}
+		return nil, err
+	}
+	if err := checkTemplateArgs(t.Tree.Root); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// checkTemplateArgs walks the template parse tree and verifies any
+// literal regular expressions passed to regexReplace compile, so
+// a bad pattern is reported when the config loads rather than
+// on every matched line.
+func checkTemplateArgs(node tmplparse.Node) error {
+	switch n := node.(type) {
+	case *tmplparse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Nodes {
+			if err := checkTemplateArgs(c); err != nil {
+				return err
+			}
+		}
+	case *tmplparse.ActionNode:
+		return checkTemplateArgs(n.Pipe)
+	case *tmplparse.IfNode:
+		return checkBranch(&n.BranchNode)
+	case *tmplparse.RangeNode:
+		return checkBranch(&n.BranchNode)
+	case *tmplparse.WithNode:
+		return checkBranch(&n.BranchNode)
+	case *tmplparse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			if err := checkTemplateArgs(cmd); err != nil {
+				return err
+			}
+		}
+	case *tmplparse.CommandNode:
+		if len(n.Args) < 2 {
+			return nil
+		}
+		if id, ok := n.Args[0].(*tmplparse.IdentifierNode); ok && id.Ident == "regexReplace" {
+			if s, ok := n.Args[1].(*tmplparse.StringNode); ok {
+				if _, err := regexp.Compile(s.Text); err != nil {
+					return fmt.Errorf("regexReplace pattern %q: %w", s.Text, err)
+				}
+			}
+		}
+		for _, arg := range n.Args {
+			if p, ok := arg.(*tmplparse.PipeNode); ok {
+				if err := checkTemplateArgs(p); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func checkBranch(b *tmplparse.BranchNode) error {
+	if err := checkTemplateArgs(b.Pipe); err != nil {
+		return err
+	}
+	if err := checkTemplateArgs(b.List); err != nil {
+		return err
+	}
+	return checkTemplateArgs(b.ElseList)
+}
+
+// regexReplace replaces all matches of pattern in s with repl (supports $1 expansion).
+func regexReplace(pattern, repl, s string) (string, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp).ReplaceAllString(s, repl), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	regexCache.Store(pattern, re)
+	return re.ReplaceAllString(s, repl), nil
+}
+
+// trunc limits s to at most n characters.
+func trunc(n int, s string) string {
+	if n < 0 {
+		return s
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// defaultValue returns def if s is empty.
+func defaultValue(def, s string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// statusClass maps an HTTP status code to its class (e.g. 404 -> 4xx).
+func statusClass(s string) string {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || code < 100 || code > 999 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// stripQuery removes any query string and fragment from a URL path.
+func stripQuery(s string) string {
+	if i := strings.IndexAny(s, "?#"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// pathTemplate strips the query string from a URL path and replaces
+// path segments which look like identifiers with placeholders.
+func pathTemplate(s string) string {
+	return templatePath(stripQuery(s))
+}
+
+// hash returns a short, stable (fnv-1a 32bit) hex digest of s.
+func hash(s string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// tagSafe replaces characters which are significant in the tag list
+// (',' separates tags, ':' separates category and value) with '_'.
+func tagSafe(s string) string {
+	return strings.NewReplacer(",", "_", ":", "_", " ", "_").Replace(s)
+}
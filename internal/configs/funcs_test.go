@@ -0,0 +1,76 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNewTemplate(t *testing.T) {
+	t.Log("Testing newTemplate")
+
+	t.Log("unknown function")
+	{
+		_, err := newTemplate("test", "{{.method | nosuchfunc}}")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), "unknown template function") {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+
+	t.Log("invalid regexReplace pattern")
+	{
+		_, err := newTemplate("test", `{{.path | regexReplace "[a-" ""}}`)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	tests := []struct {
+		tmpl   string
+		expect string
+	}{
+		{`{{.method | lower}}`, "get"},
+		{`{{.method | upper}}`, "GET"},
+		{`{{.status | statusClass}}`, "5xx"},
+		{`{{.path | stripQuery}}`, "/users/123"},
+		{`{{.path | pathTemplate}}`, "/users/:id"},
+		{`{{.path | regexReplace "[0-9]+" "N"}}`, "/users/N?q=N"},
+		{`{{.path | replace "users" "u"}}`, "/u/123?q=1"},
+		{`{{.path | trunc 6}}`, "/users"},
+		{`{{.missing | default "none"}}`, "none"},
+		{`{{.method | hash}}`, hash("GET")},
+		{`{{.agent | tagSafe}}`, "curl_7.1_x"},
+		{`{{if .path | hasPrefix "/users"}}u{{end}}`, "u"},
+	}
+
+	matches := map[string]string{
+		"method":  "GET",
+		"status":  "503",
+		"path":    "/users/123?q=1",
+		"missing": "",
+		"agent":   "curl 7.1,x",
+	}
+
+	for _, test := range tests {
+		t.Logf("template %s", test.tmpl)
+		tmpl, err := newTemplate("test", test.tmpl)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, matches); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if b.String() != test.expect {
+			t.Fatalf("expected (%s) got (%s)", test.expect, b.String())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Input encodings for Config.Encoding.
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingLatin1  = "latin1"   // ISO-8859-1
+	EncodingUTF16LE = "utf-16le" // lines end with the code unit 0x0A 0x00
+)
+
+// Long line policies for Config.LongLines.
+const (
+	LongLinesTruncate = "truncate" // keep the first max_line_bytes bytes
+	LongLinesSkip     = "skip"     // ignore the line
+)
+
+// Invalid UTF-8 policies for Config.InvalidUTF8.
+const (
+	InvalidUTF8Pass    = "pass"    // match the line as is
+	InvalidUTF8Replace = "replace" // replace invalid bytes with U+FFFD
+	InvalidUTF8Skip    = "skip"    // ignore the line
+)
+
+// inputSettings applies the defaults for the line length and encoding
+// settings and verifies them.
+func inputSettings(logcfg *Config) error {
+	if logcfg.MaxLineBytes < 0 {
+		return fmt.Errorf("invalid max_line_bytes (%d), must be >= 0", logcfg.MaxLineBytes)
+	}
+
+	logcfg.LongLines = strings.ToLower(logcfg.LongLines)
+	switch logcfg.LongLines {
+	case "":
+		logcfg.LongLines = LongLinesTruncate
+	case LongLinesTruncate, LongLinesSkip:
+	default:
+		return fmt.Errorf("invalid long_lines (%s), must be truncate or skip", logcfg.LongLines)
+	}
+
+	logcfg.Encoding = strings.ToLower(logcfg.Encoding)
+	switch logcfg.Encoding {
+	case "", "utf8":
+		logcfg.Encoding = EncodingUTF8
+	case "iso-8859-1":
+		logcfg.Encoding = EncodingLatin1
+	case "utf16le":
+		logcfg.Encoding = EncodingUTF16LE
+	case EncodingUTF8, EncodingLatin1, EncodingUTF16LE:
+	default:
+		return fmt.Errorf("invalid encoding (%s), must be utf-8, latin1 or utf-16le", logcfg.Encoding)
+	}
+
+	logcfg.InvalidUTF8 = strings.ToLower(logcfg.InvalidUTF8)
+	switch logcfg.InvalidUTF8 {
+	case "":
+		logcfg.InvalidUTF8 = InvalidUTF8Pass
+	case InvalidUTF8Pass, InvalidUTF8Replace, InvalidUTF8Skip:
+	default:
+		return fmt.Errorf("invalid invalid_utf8 (%s), must be pass, replace or skip", logcfg.InvalidUTF8)
+	}
+
+	return nil
+}
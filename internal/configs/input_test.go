@@ -0,0 +1,49 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"testing"
+)
+
+func TestInputSettings(t *testing.T) {
+	t.Log("Testing inputSettings")
+
+	tests := []struct {
+		cfg      Config
+		encoding string
+		ok       bool
+	}{
+		{Config{}, EncodingUTF8, true},
+		{Config{Encoding: "UTF8"}, EncodingUTF8, true},
+		{Config{Encoding: "ISO-8859-1"}, EncodingLatin1, true},
+		{Config{Encoding: "utf16le", MaxLineBytes: 1024, LongLines: "skip"}, EncodingUTF16LE, true},
+		{Config{Encoding: "ebcdic"}, "", false},
+		{Config{MaxLineBytes: -1}, "", false},
+		{Config{LongLines: "wrap"}, "", false},
+		{Config{InvalidUTF8: "Replace"}, EncodingUTF8, true},
+		{Config{InvalidUTF8: "drop"}, "", false},
+	}
+	for _, tst := range tests {
+		cfg := tst.cfg
+		err := inputSettings(&cfg)
+		if !tst.ok {
+			if err == nil {
+				t.Fatalf("%#v: expected error", tst.cfg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%#v: expected no error, got %s", tst.cfg, err)
+		}
+		if cfg.Encoding != tst.encoding {
+			t.Fatalf("expected encoding %s, got %s", tst.encoding, cfg.Encoding)
+		}
+		if cfg.LongLines == "" || cfg.InvalidUTF8 == "" {
+			t.Fatalf("expected defaults, got %#v", cfg)
+		}
+	}
+}
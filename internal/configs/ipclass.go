@@ -0,0 +1,364 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"gopkg.in/yaml.v2"
+)
+
+// Template fields set by an IP classifier, prefixed with its name and _.
+const (
+	IPClassField   = "class"
+	IPCountryField = "country"
+	IPASNField     = "asn"
+	IPASOrgField   = "as_org"
+)
+
+// IPClassifier classifies the IP address captured by a named subexpression
+// before the rule name and tags templates are executed. The address is
+// matched against named CIDR lists (e.g. internal, office, partner, bogon)
+// from a YAML or JSON file, most specific network first, and looked up in
+// MaxMind format databases (e.g. GeoLite2 Country and ASN). The results
+// are available to the templates as {{.name_class}}, {{.name_country}},
+// {{.name_asn}} and {{.name_as_org}}. The files are reloaded when they
+// change.
+type IPClassifier struct {
+	Field    string   `json:"field" yaml:"field" toml:"field"`
+	Name     string   `json:"name" yaml:"name" toml:"name"`
+	Networks string   `json:"networks" yaml:"networks" toml:"networks"`
+	Default  string   `json:"default" yaml:"default" toml:"default"`
+	MMDB     []string `json:"mmdb" yaml:"mmdb" toml:"mmdb"`
+	Reload   string   `json:"reload" yaml:"reload" toml:"reload"`
+	state    atomic.Value
+	files    []fileVersion
+	reload   time.Duration
+	mu       sync.Mutex
+}
+
+// fileVersion identifies the version of a file loaded.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// ipState holds the networks and databases of a classifier, replaced
+// atomically when reloaded.
+type ipState struct {
+	v4    []prefixTable // longest prefix first
+	v6    []prefixTable
+	dbs   []*maxminddb.Reader
+	count int
+}
+
+// prefixTable holds the networks, and their list names, of a prefix
+// length keyed by the masked network address.
+type prefixTable struct {
+	mask net.IPMask
+	nets map[string]string
+	bits int
+}
+
+// ipRecord is the subset of a MaxMind country or ASN record used.
+type ipRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+}
+
+// init validates the classifier settings and loads its files. The field
+// must be a named subexpression of at least one rule, the rules using
+// the classifier are returned.
+func (c *IPClassifier) init(rules []*Metric) ([]*Metric, error) {
+	if c.Field == "" {
+		return nil, errors.New("invalid ip_classify field (empty)")
+	}
+	if c.Name == "" {
+		c.Name = c.Field
+	}
+	if !lookupName.MatchString(c.Name) {
+		return nil, fmt.Errorf("invalid ip_classify name (%s), must be a letter or _ followed by letters, digits or _", c.Name)
+	}
+	if c.Networks == "" && len(c.MMDB) == 0 {
+		return nil, fmt.Errorf("ip_classify (%s) requires networks and/or mmdb", c.Name)
+	}
+
+	c.reload = defaultLookupReload
+	if c.Reload != "" {
+		d, err := time.ParseDuration(c.Reload)
+		if err != nil {
+			return nil, fmt.Errorf("parsing ip_classify (%s) reload: %w", c.Name, err)
+		}
+		if d < minLookupReload {
+			return nil, fmt.Errorf("invalid ip_classify (%s) reload (%s), must be at least %s", c.Name, c.Reload, minLookupReload)
+		}
+		c.reload = d
+	}
+
+	var used []*Metric
+	for _, rule := range rules {
+		if !hasMatchPart(rule.MatchParts, c.Field) {
+			continue
+		}
+		for _, field := range c.Fields() {
+			if hasMatchPart(rule.MatchParts, field) {
+				return nil, fmt.Errorf("ip_classify (%s) field (%s) is a named subexpression in match (%s)", c.Name, field, rule.Match)
+			}
+		}
+		used = append(used, rule)
+	}
+	if len(used) == 0 {
+		return nil, fmt.Errorf("ip_classify (%s) field (%s) is not a named subexpression in any rule match", c.Name, c.Field)
+	}
+
+	if _, err := c.Load(true); err != nil {
+		return nil, err
+	}
+
+	return used, nil
+}
+
+// Fields returns the names of the template fields set by the classifier.
+func (c *IPClassifier) Fields() []string {
+	return []string{
+		c.Name + "_" + IPClassField,
+		c.Name + "_" + IPCountryField,
+		c.Name + "_" + IPASNField,
+		c.Name + "_" + IPASOrgField,
+	}
+}
+
+// String returns the classifier name.
+func (c *IPClassifier) String() string {
+	return c.Name
+}
+
+// Period returns how often the files are checked for changes.
+func (c *IPClassifier) Period() time.Duration {
+	if c.reload == 0 {
+		return defaultLookupReload
+	}
+	return c.reload
+}
+
+// Len returns the number of networks in the lists.
+func (c *IPClassifier) Len() int {
+	st, _ := c.state.Load().(*ipState)
+	if st == nil {
+		return 0
+	}
+	return st.count
+}
+
+// Apply classifies the address in the field of the matches, adding the
+// template fields. The class is the name of the list with the most
+// specific network containing the address, the default if none does.
+// Country, ASN and AS organization are empty if not found.
+func (c *IPClassifier) Apply(matches map[string]string) {
+	class, country, asn, org := c.Default, "", "", ""
+
+	st, _ := c.state.Load().(*ipState)
+	if ip := parseAddr(matches[c.Field]); ip != nil && st != nil {
+		if name, ok := st.classify(ip); ok {
+			class = name
+		}
+		for _, db := range st.dbs {
+			var rec ipRecord
+			if err := db.Lookup(ip, &rec); err != nil {
+				continue // e.g. an IPv6 address in an IPv4 database
+			}
+			if country == "" {
+				country = rec.Country.ISOCode
+			}
+			if asn == "" && rec.ASN != 0 {
+				asn = strconv.FormatUint(uint64(rec.ASN), 10)
+				org = rec.ASOrg
+			}
+		}
+	}
+
+	matches[c.Name+"_"+IPClassField] = class
+	matches[c.Name+"_"+IPCountryField] = country
+	matches[c.Name+"_"+IPASNField] = asn
+	matches[c.Name+"_"+IPASOrgField] = org
+}
+
+// parseAddr parses an IP address, optionally with a port (host:port or
+// [host]:port), nil if it is not an address.
+func parseAddr(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	if ip := net.ParseIP(s); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return net.ParseIP(host)
+	}
+	return nil
+}
+
+// classify returns the list name of the most specific network containing ip.
+func (st *ipState) classify(ip net.IP) (string, bool) {
+	tables := st.v6
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		tables = st.v4
+	}
+	for _, t := range tables {
+		if name, ok := t.nets[string(ip.Mask(t.mask))]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Load reads the networks and databases if any of the files changed since
+// they were last loaded, or always with force. loaded is false if none
+// changed. On error the previous networks and databases are kept.
+func (c *IPClassifier) Load(force bool) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files := make([]string, 0, len(c.MMDB)+1)
+	if c.Networks != "" {
+		files = append(files, c.Networks)
+	}
+	files = append(files, c.MMDB...)
+
+	versions := make([]fileVersion, len(files))
+	changed := force || len(c.files) != len(files)
+	for i, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return false, fmt.Errorf("ip_classify (%s): %w", c.Name, err)
+		}
+		versions[i] = fileVersion{modTime: fi.ModTime(), size: fi.Size()}
+		if !changed && (!versions[i].modTime.Equal(c.files[i].modTime) || versions[i].size != c.files[i].size) {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	st := &ipState{}
+	if c.Networks != "" {
+		if err := st.loadNetworks(c.Networks); err != nil {
+			return false, fmt.Errorf("ip_classify (%s) networks (%s): %w", c.Name, c.Networks, err)
+		}
+	}
+	for _, file := range c.MMDB {
+		// read into memory rather than mapped, so a replaced database
+		// can be released while lines are still being classified
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return false, fmt.Errorf("ip_classify (%s): %w", c.Name, err)
+		}
+		db, err := maxminddb.FromBytes(data)
+		if err != nil {
+			return false, fmt.Errorf("ip_classify (%s) mmdb (%s): %w", c.Name, file, err)
+		}
+		st.dbs = append(st.dbs, db)
+	}
+
+	c.state.Store(st)
+	c.files = versions
+	return true, nil
+}
+
+// loadNetworks reads a YAML or JSON map of list names to networks, CIDR
+// (e.g. 10.0.0.0/8) or single addresses.
+func (st *ipState) loadNetworks(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var lists map[string][]string
+	if err := yaml.Unmarshal(data, &lists); err != nil {
+		return err
+	}
+
+	v4 := make(map[int]map[string]string)
+	v6 := make(map[int]map[string]string)
+	owner := make(map[string]string)
+	for name, nets := range lists {
+		for _, s := range nets {
+			ipnet, err := parseNetwork(s)
+			if err != nil {
+				return fmt.Errorf("list (%s): %w", name, err)
+			}
+			key := ipnet.String()
+			if other, ok := owner[key]; ok && other != name {
+				return fmt.Errorf("network (%s) in lists %s and %s", key, other, name)
+			}
+			owner[key] = name
+			bits, _ := ipnet.Mask.Size()
+			tables := v6
+			if len(ipnet.IP) == net.IPv4len {
+				tables = v4
+			}
+			if tables[bits] == nil {
+				tables[bits] = make(map[string]string)
+			}
+			tables[bits][string(ipnet.IP)] = name
+		}
+	}
+
+	st.v4 = prefixTables(v4, 8*net.IPv4len)
+	st.v6 = prefixTables(v6, 8*net.IPv6len)
+	st.count = len(owner)
+	return nil
+}
+
+// parseNetwork parses a CIDR network or a single address, IPv4 networks
+// are returned with 4 byte addresses.
+func parseNetwork(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid network (%s)", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)}, nil
+	}
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	if ip4 := ipnet.IP.To4(); ip4 != nil && len(ipnet.Mask) == net.IPv4len {
+		ipnet.IP = ip4
+	}
+	return ipnet, nil
+}
+
+// prefixTables orders the tables of each prefix length, longest first.
+func prefixTables(byBits map[int]map[string]string, size int) []prefixTable {
+	tables := make([]prefixTable, 0, len(byBits))
+	for bits, nets := range byBits {
+		tables = append(tables, prefixTable{bits: bits, mask: net.CIDRMask(bits, size), nets: nets})
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].bits > tables[j].bits })
+	return tables
+}
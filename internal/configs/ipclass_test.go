@@ -0,0 +1,204 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// mmdbControl, mmdbString, mmdbUint and mmdbMap encode MaxMind DB data
+// section values.
+func mmdbControl(typ byte, size int) []byte {
+	var b []byte
+	if size < 29 {
+		b = []byte{byte(size)}
+	} else {
+		b = []byte{29, byte(size - 29)}
+	}
+	if typ < 8 {
+		b[0] |= typ << 5
+		return b
+	}
+	return append([]byte{b[0]}, append([]byte{typ - 7}, b[1:]...)...)
+}
+
+func mmdbString(s string) []byte {
+	return append(mmdbControl(2, len(s)), s...)
+}
+
+func mmdbUint(typ byte, v uint64) []byte {
+	var payload []byte
+	for ; v > 0; v >>= 8 {
+		payload = append([]byte{byte(v)}, payload...)
+	}
+	return append(mmdbControl(typ, len(payload)), payload...)
+}
+
+func mmdbMap(kv ...[]byte) []byte {
+	b := mmdbControl(7, len(kv)/2)
+	for _, v := range kv {
+		b = append(b, v...)
+	}
+	return b
+}
+
+// writeTestMMDB writes an IPv4 MaxMind DB with a single network,
+// 198.51.100.0/24, country NZ and AS64500.
+func writeTestMMDB(t *testing.T, file string) {
+	const prefix = 24
+	network := []byte{198, 51, 100}
+	nodeCount := prefix
+	record := func(v int) []byte { return []byte{byte(v >> 16), byte(v >> 8), byte(v)} }
+
+	var tree []byte
+	for i := 0; i < prefix; i++ {
+		bit := network[i/8] >> (7 - uint(i%8)) & 1
+		next := i + 1
+		if i == prefix-1 {
+			next = nodeCount + 16 // data section offset 0
+		}
+		left, right := record(nodeCount), record(nodeCount) // no data
+		if bit == 0 {
+			left = record(next)
+		} else {
+			right = record(next)
+		}
+		tree = append(tree, left...)
+		tree = append(tree, right...)
+	}
+
+	db := append(tree, make([]byte, 16)...)
+	db = append(db, mmdbMap(
+		mmdbString("country"), mmdbMap(mmdbString("iso_code"), mmdbString("NZ")),
+		mmdbString("autonomous_system_number"), mmdbUint(6, 64500),
+		mmdbString("autonomous_system_organization"), mmdbString("Example Networks"),
+	)...)
+	db = append(db, "\xab\xcd\xefMaxMind.com"...)
+	db = append(db, mmdbMap(
+		mmdbString("binary_format_major_version"), mmdbUint(5, 2),
+		mmdbString("binary_format_minor_version"), mmdbUint(5, 0),
+		mmdbString("build_epoch"), mmdbUint(9, 1600000000),
+		mmdbString("database_type"), mmdbString("Test"),
+		mmdbString("description"), mmdbMap(),
+		mmdbString("ip_version"), mmdbUint(5, 4),
+		mmdbString("languages"), mmdbControl(11, 0),
+		mmdbString("node_count"), mmdbUint(6, uint64(nodeCount)),
+		mmdbString("record_size"), mmdbUint(5, 24),
+	)...)
+
+	if err := ioutil.WriteFile(file, db, 0600); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+}
+
+func TestIPClassifier(t *testing.T) {
+	t.Log("Testing IPClassifier")
+
+	re := regexp.MustCompile(`client=(?P<client>\S+)`)
+	rules := []*Metric{
+		{Match: re.String(), MatchParts: re.SubexpNames()},
+		{Match: "other", MatchParts: []string{""}},
+	}
+	mmdb := filepath.Join(t.TempDir(), "test.mmdb")
+	writeTestMMDB(t, mmdb)
+
+	invalid := []*IPClassifier{
+		{Networks: "testdata/networks/networks.yaml"},
+		{Field: "client"},
+		{Field: "unknown", Networks: "testdata/networks/networks.yaml"},
+		{Field: "client", Name: "client-ip", Networks: "testdata/networks/networks.yaml"},
+		{Field: "client", Networks: "testdata/networks/missing.yaml"},
+		{Field: "client", Networks: "testdata/networks/networks.yaml", Reload: "1ms"},
+		{Field: "client", MMDB: []string{"testdata/networks/networks.yaml"}},
+		{Field: "client", Networks: "testdata/lookups/tiers.json"},
+	}
+	for _, c := range invalid {
+		if _, err := c.init(rules); err == nil {
+			t.Fatalf("%#v: expected error", c.Field)
+		}
+	}
+
+	c := &IPClassifier{Field: "client", Networks: "testdata/networks/networks.yaml", Default: "external", MMDB: []string{mmdb}}
+	used, err := c.init(rules)
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if len(used) != 1 || used[0] != rules[0] || c.Name != "client" || c.Len() != 6 {
+		t.Fatalf("unexpected classifier %s %d %v", c.Name, c.Len(), used)
+	}
+
+	tests := []struct {
+		addr, class, country, asn, org string
+	}{
+		{"10.2.3.4", "internal", "", "", ""},
+		{"10.1.3.4", "office", "", "", ""},
+		{"203.0.113.7", "office", "", "", ""},
+		{"203.0.113.8", "external", "", "", ""},
+		{"0.1.2.3", "bogon", "", "", ""},
+		{"[fd00::1]:8080", "internal", "", "", ""},
+		{"192.168.1.1:443", "internal", "", "", ""},
+		{"::ffff:10.0.0.1", "internal", "", "", ""},
+		{"198.51.100.20", "external", "NZ", "64500", "Example Networks"},
+		{"2001:db8::1", "external", "", "", ""},
+		{"-", "external", "", "", ""},
+	}
+	for _, tst := range tests {
+		matches := map[string]string{"client": tst.addr}
+		c.Apply(matches)
+		if matches["client_class"] != tst.class ||
+			matches["client_country"] != tst.country ||
+			matches["client_asn"] != tst.asn ||
+			matches["client_as_org"] != tst.org {
+			t.Fatalf("%s: unexpected classification %v", tst.addr, matches)
+		}
+	}
+}
+
+func TestIPClassifierLoad(t *testing.T) {
+	t.Log("Testing IPClassifier.Load")
+
+	file := filepath.Join(t.TempDir(), "networks.json")
+	if err := ioutil.WriteFile(file, []byte(`{"internal": ["10.0.0.0/8"]}`), 0600); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	c := &IPClassifier{Field: "ip", Name: "ip", Networks: file}
+	if loaded, err := c.Load(false); err != nil || !loaded {
+		t.Fatalf("expected loaded, got %v %v", loaded, err)
+	}
+	if loaded, err := c.Load(false); err != nil || loaded {
+		t.Fatalf("expected not loaded, got %v %v", loaded, err)
+	}
+
+	t.Log("changed")
+	if err := ioutil.WriteFile(file, []byte(`{"internal": ["10.0.0.0/8"], "partner": ["10.9.0.0/16"]}`), 0600); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if loaded, err := c.Load(false); err != nil || !loaded {
+		t.Fatalf("expected loaded, got %v %v", loaded, err)
+	}
+	matches := map[string]string{"ip": "10.9.1.1"}
+	c.Apply(matches)
+	if matches["ip_class"] != "partner" {
+		t.Fatalf("expected partner, got %v", matches)
+	}
+
+	t.Log("invalid, previous networks kept")
+	for _, data := range []string{`{"internal": ["10.0.0.0/33"]}`, `{"a": ["10.0.0.0/8"], "b": ["10.0.0.0/8"]}`} {
+		if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if _, err := c.Load(false); err == nil {
+			t.Fatalf("%s: expected error", data)
+		}
+	}
+	c.Apply(matches)
+	if matches["ip_class"] != "partner" {
+		t.Fatalf("expected partner, got %v", matches)
+	}
+}
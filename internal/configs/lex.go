@@ -0,0 +1,153 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The lexer and parser plumbing shared by rule 'where' conditions and
+// derived metric expressions.
+
+type tokKind int
+
+const (
+	tokIdent tokKind = iota
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	text string
+	kind tokKind
+	pos  int
+}
+
+// lexer splits an expression into tokens. Identifiers start with a letter
+// or _ followed by letters, digits, _ or identChars. Strings are 'single'
+// or "double" quoted. Operators are matched in order, so longer operators
+// must come first.
+type lexer struct {
+	identChars    string
+	ops           []string
+	signedNumbers bool // a '-' followed by a number is part of the number
+}
+
+func (lx *lexer) lex(expr string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(expr) {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			toks = append(toks, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], expr[i])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			toks = append(toks, token{kind: tokString, text: expr[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case (c == '-' && lx.signedNumbers) || c == '.' || unicode.IsDigit(c):
+			start := i
+			i++
+			for i < len(expr) && (expr[i] == '.' || unicode.IsDigit(rune(expr[i]))) {
+				i++
+			}
+			if _, err := strconv.ParseFloat(expr[start:i], 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q at offset %d", expr[start:i], start)
+			}
+			toks = append(toks, token{kind: tokNumber, text: expr[start:i], pos: start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(expr) && lx.identChar(rune(expr[i])) {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: expr[start:i], pos: start})
+		default:
+			found := false
+			for _, op := range lx.ops {
+				if strings.HasPrefix(expr[i:], op) {
+					toks = append(toks, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+		}
+	}
+	if len(toks) == 0 {
+		return nil, errors.New("empty expression")
+	}
+	return toks, nil
+}
+
+func (lx *lexer) identChar(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune(lx.identChars, c)
+}
+
+// parser holds the position in the tokens of an expression, it is
+// embedded by the condition and derived metric parsers.
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() *token {
+	if p.pos >= len(p.toks) {
+		return nil
+	}
+	return &p.toks[p.pos]
+}
+
+// accept consumes the next token if it is one of the operators.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t == nil || t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// expect consumes the next token, which must be of kind.
+func (p *parser) expect(kind tokKind, what string) error {
+	t := p.peek()
+	if t == nil || t.kind != kind {
+		return fmt.Errorf("missing %s", what)
+	}
+	p.pos++
+	return nil
+}
+
+// done returns an error if any tokens were not parsed.
+func (p *parser) done() error {
+	if t := p.peek(); t != nil {
+		return fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"testing"
+)
+
+func TestLexer(t *testing.T) {
+	t.Log("Testing lexer")
+
+	tests := []struct {
+		lx     *lexer
+		expr   string
+		expect []token
+	}{
+		{condLexer, "a.b", nil}, // . only allowed in derived names
+		{condLexer, "x >= -1.5", []token{{"x", tokIdent, 0}, {">=", tokOp, 2}, {"-1.5", tokNumber, 5}}},
+		{condLexer, "!(s =~ 'a b')", []token{{"!", tokOp, 0}, {"(", tokLParen, 1}, {"s", tokIdent, 2}, {"=~", tokOp, 4}, {"a b", tokString, 7}, {")", tokRParen, 12}}},
+		{exprLexer, "a.b-1", []token{{"a.b", tokIdent, 0}, {"-", tokOp, 3}, {"1", tokNumber, 4}}},
+		{exprLexer, "rate('x`y')", []token{{"rate", tokIdent, 0}, {"(", tokLParen, 4}, {"x`y", tokString, 5}, {")", tokRParen, 10}}},
+		{exprLexer, "a == b", nil},
+		{exprLexer, "'a", nil},
+		{exprLexer, " ", nil},
+	}
+
+	for _, test := range tests {
+		toks, err := test.lx.lex(test.expr)
+		if test.expect == nil {
+			if err == nil {
+				t.Fatalf("%q: expected error, got %v", test.expr, toks)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: expected no error, got (%s)", test.expr, err)
+		}
+		if len(toks) != len(test.expect) {
+			t.Fatalf("%q: expected %v, got %v", test.expr, test.expect, toks)
+		}
+		for i, tok := range toks {
+			if tok != test.expect[i] {
+				t.Fatalf("%q: expected %v, got %v", test.expr, test.expect[i], tok)
+			}
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Lookup file formats for LookupTable.Format.
+const (
+	LookupCSV  = "csv"
+	LookupJSON = "json"
+	LookupYAML = "yaml"
+)
+
+// Lookup key matching for LookupTable.Match.
+const (
+	LookupExact  = "exact"  // the captured value must equal a key
+	LookupPrefix = "prefix" // the longest key the captured value starts with (e.g. an IP prefix 10.1.)
+)
+
+const (
+	defaultLookupReload = 10 * time.Second
+	minLookupReload     = time.Second
+)
+
+var lookupName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LookupTable maps the value of a named subexpression to a new value, from a
+// table in a CSV, JSON or YAML file (e.g. customer_id to tier), before the
+// rule name and tags templates are executed. The result is available to
+// the templates as {{.name}}. The file is reloaded when it changes, the
+// table (a map[string]string) is replaced atomically.
+type LookupTable struct {
+	Name    string `json:"name" yaml:"name" toml:"name"`
+	File    string `json:"file" yaml:"file" toml:"file"`
+	Format  string `json:"format" yaml:"format" toml:"format"`
+	Field   string `json:"field" yaml:"field" toml:"field"`
+	Key     string `json:"key" yaml:"key" toml:"key"`
+	Value   string `json:"value" yaml:"value" toml:"value"`
+	Default string `json:"default" yaml:"default" toml:"default"`
+	Match   string `json:"match" yaml:"match" toml:"match"`
+	Reload  string `json:"reload" yaml:"reload" toml:"reload"`
+	modTime time.Time
+	table   atomic.Value
+	size    int64
+	reload  time.Duration
+	mu      sync.Mutex
+}
+
+// init validates the lookup settings and loads the table. The field must
+// be a named subexpression of at least one rule, the rules using the
+// lookup are returned.
+func (l *LookupTable) init(rules []*Metric) ([]*Metric, error) {
+	if !lookupName.MatchString(l.Name) {
+		return nil, fmt.Errorf("invalid lookup name (%s), must be a letter or _ followed by letters, digits or _", l.Name)
+	}
+	if l.File == "" {
+		return nil, fmt.Errorf("lookup (%s) invalid file (empty)", l.Name)
+	}
+	if l.Field == "" {
+		return nil, fmt.Errorf("lookup (%s) invalid field (empty)", l.Name)
+	}
+
+	l.Format = strings.ToLower(l.Format)
+	if l.Format == "" {
+		l.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(l.File)), ".")
+		if l.Format == "yml" {
+			l.Format = LookupYAML
+		}
+	}
+	switch l.Format {
+	case LookupCSV, LookupJSON, LookupYAML:
+	default:
+		return nil, fmt.Errorf("lookup (%s) invalid format (%s), must be csv, json or yaml", l.Name, l.Format)
+	}
+
+	l.Match = strings.ToLower(l.Match)
+	switch l.Match {
+	case "":
+		l.Match = LookupExact
+	case LookupExact, LookupPrefix:
+	default:
+		return nil, fmt.Errorf("lookup (%s) invalid match (%s), must be exact or prefix", l.Name, l.Match)
+	}
+
+	l.reload = defaultLookupReload
+	if l.Reload != "" {
+		d, err := time.ParseDuration(l.Reload)
+		if err != nil {
+			return nil, fmt.Errorf("parsing lookup (%s) reload: %w", l.Name, err)
+		}
+		if d < minLookupReload {
+			return nil, fmt.Errorf("invalid lookup (%s) reload (%s), must be at least %s", l.Name, l.Reload, minLookupReload)
+		}
+		l.reload = d
+	}
+
+	var used []*Metric
+	for _, rule := range rules {
+		if !hasMatchPart(rule.MatchParts, l.Field) {
+			continue
+		}
+		if hasMatchPart(rule.MatchParts, l.Name) {
+			return nil, fmt.Errorf("lookup (%s) name is a named subexpression in match (%s)", l.Name, rule.Match)
+		}
+		used = append(used, rule)
+	}
+	if len(used) == 0 {
+		return nil, fmt.Errorf("lookup (%s) field (%s) is not a named subexpression in any rule match", l.Name, l.Field)
+	}
+
+	if _, err := l.Load(true); err != nil {
+		return nil, err
+	}
+
+	return used, nil
+}
+
+// Period returns how often the file is checked for changes.
+func (l *LookupTable) Period() time.Duration {
+	if l.reload == 0 {
+		return defaultLookupReload
+	}
+	return l.reload
+}
+
+// Find returns the value for the key, the default if the key is not in
+// the table.
+func (l *LookupTable) Find(key string) string {
+	table, _ := l.table.Load().(map[string]string)
+	if key == "" || table == nil {
+		return l.Default
+	}
+	if l.Match == LookupPrefix {
+		for i := len(key); i > 0; i-- {
+			if v, ok := table[key[:i]]; ok {
+				return v
+			}
+		}
+		return l.Default
+	}
+	if v, ok := table[key]; ok {
+		return v
+	}
+	return l.Default
+}
+
+// String returns the lookup name.
+func (l *LookupTable) String() string {
+	return l.Name
+}
+
+// Len returns the number of keys in the table.
+func (l *LookupTable) Len() int {
+	table, _ := l.table.Load().(map[string]string)
+	return len(table)
+}
+
+// Load reads the table from the file if it changed since it was last
+// loaded, or always with force. loaded is false if the file did not
+// change. On error the previous table is kept.
+func (l *LookupTable) Load(force bool) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fi, err := os.Stat(l.File)
+	if err != nil {
+		return false, fmt.Errorf("lookup (%s): %w", l.Name, err)
+	}
+	if !force && fi.ModTime().Equal(l.modTime) && fi.Size() == l.size {
+		return false, nil
+	}
+
+	data, err := ioutil.ReadFile(l.File)
+	if err != nil {
+		return false, fmt.Errorf("lookup (%s): %w", l.Name, err)
+	}
+	var table map[string]string
+	switch l.Format {
+	case LookupCSV:
+		table, err = l.parseCSV(data)
+	case LookupJSON:
+		var v interface{}
+		if err = json.Unmarshal(data, &v); err == nil {
+			table, err = l.entries(v)
+		}
+	case LookupYAML:
+		var v interface{}
+		if err = yaml.Unmarshal(data, &v); err == nil {
+			table, err = l.entries(v)
+		}
+	default:
+		err = fmt.Errorf("unknown format (%s)", l.Format)
+	}
+	if err != nil {
+		return false, fmt.Errorf("lookup (%s) file (%s): %w", l.Name, l.File, err)
+	}
+
+	l.table.Store(table)
+	l.modTime = fi.ModTime()
+	l.size = fi.Size()
+	return true, nil
+}
+
+// parseCSV reads a CSV table with a header row, the key and value are
+// the columns named by Key and Value, the first two columns by default.
+func (l *LookupTable) parseCSV(data []byte) (map[string]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("missing header row")
+	}
+	header := records[0]
+	keyCol, err := csvColumn(header, l.Key, 0)
+	if err != nil {
+		return nil, err
+	}
+	valCol, err := csvColumn(header, l.Value, 1)
+	if err != nil {
+		return nil, err
+	}
+	table := make(map[string]string, len(records)-1)
+	for _, rec := range records[1:] {
+		table[strings.TrimSpace(rec[keyCol])] = strings.TrimSpace(rec[valCol])
+	}
+	return table, nil
+}
+
+// csvColumn returns the index of the named column, or def if name is empty.
+func csvColumn(header []string, name string, def int) (int, error) {
+	if name == "" {
+		if def >= len(header) {
+			return 0, errors.New("at least two columns required")
+		}
+		return def, nil
+	}
+	for i, col := range header {
+		if strings.TrimSpace(col) == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("column (%s) not found", name)
+}
+
+// entries converts a decoded JSON or YAML table, either a map of keys to
+// values or a list of objects with Key and Value fields.
+func (l *LookupTable) entries(v interface{}) (map[string]string, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		table := make(map[string]string, len(t))
+		for k, val := range t {
+			table[k] = scalar(val)
+		}
+		return table, nil
+	case map[interface{}]interface{}:
+		table := make(map[string]string, len(t))
+		for k, val := range t {
+			table[scalar(k)] = scalar(val)
+		}
+		return table, nil
+	case []interface{}:
+		if l.Key == "" || l.Value == "" {
+			return nil, errors.New("a list of objects requires 'key' and 'value'")
+		}
+		table := make(map[string]string, len(t))
+		for i, item := range t {
+			var k, val interface{}
+			var kok, vok bool
+			switch obj := item.(type) {
+			case map[string]interface{}:
+				k, kok = obj[l.Key]
+				val, vok = obj[l.Value]
+			case map[interface{}]interface{}:
+				k, kok = obj[l.Key]
+				val, vok = obj[l.Value]
+			}
+			if !kok || !vok {
+				return nil, fmt.Errorf("item %d missing key (%s) or value (%s)", i, l.Key, l.Value)
+			}
+			table[scalar(k)] = scalar(val)
+		}
+		return table, nil
+	}
+	return nil, errors.New("table must be a map of keys to values or a list of objects")
+}
+
+// scalar formats a decoded JSON or YAML value as a string.
+func scalar(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
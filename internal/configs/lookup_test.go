@@ -0,0 +1,150 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLookupTable(t *testing.T) {
+	t.Log("Testing LookupTable")
+
+	re := regexp.MustCompile(`customer=(?P<customer>\S+) ip=(?P<ip>\S+)`)
+	rules := []*Metric{
+		{Match: re.String(), MatchParts: re.SubexpNames()},
+		{Match: "other", MatchParts: []string{""}},
+	}
+
+	invalid := []*LookupTable{
+		{Name: "", File: "testdata/lookups/customers.csv", Field: "customer"},
+		{Name: "tier-name", File: "testdata/lookups/customers.csv", Field: "customer"},
+		{Name: "tier", Field: "customer"},
+		{Name: "tier", File: "testdata/lookups/customers.csv"},
+		{Name: "tier", File: "testdata/lookups/customers.csv", Field: "unknown"},
+		{Name: "ip", File: "testdata/lookups/customers.csv", Field: "customer"},
+		{Name: "tier", File: "testdata/lookups/customers.txt", Field: "customer"},
+		{Name: "tier", File: "testdata/lookups/customers.csv", Field: "customer", Match: "regex"},
+		{Name: "tier", File: "testdata/lookups/customers.csv", Field: "customer", Reload: "1ms"},
+		{Name: "tier", File: "testdata/lookups/missing.csv", Field: "customer"},
+		{Name: "tier", File: "testdata/lookups/customers.csv", Field: "customer", Value: "level"},
+		{Name: "dc", File: "testdata/lookups/datacenters.yaml", Field: "ip"},
+	}
+	for _, l := range invalid {
+		if _, err := l.init(rules); err == nil {
+			t.Fatalf("%s %s: expected error", l.Name, l.File)
+		}
+	}
+
+	t.Log("csv")
+	{
+		l := &LookupTable{Name: "tier", File: "testdata/lookups/customers.csv", Field: "customer", Key: "customer_id", Value: "tier", Default: "none"}
+		used, err := l.init(rules)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if len(used) != 1 || used[0] != rules[0] {
+			t.Fatalf("expected first rule to use lookup, got %v", used)
+		}
+		if l.Period() != defaultLookupReload {
+			t.Fatalf("expected default reload, got %s", l.Period())
+		}
+		for key, expected := range map[string]string{"c1": "gold", "c2": "silver", "c3": "none", "": "none"} {
+			if v := l.Find(key); v != expected {
+				t.Fatalf("%q: expected %s, got %s", key, expected, v)
+			}
+		}
+
+		t.Log("first two columns by default")
+		l = &LookupTable{Name: "customer_name", File: "testdata/lookups/customers.csv", Field: "customer"}
+		if _, err := l.init(rules); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if v := l.Find("c2"); v != "Globex, Inc" {
+			t.Fatalf("expected Globex, Inc, got %s", v)
+		}
+	}
+
+	t.Log("json map")
+	{
+		l := &LookupTable{Name: "tier", File: "testdata/lookups/tiers.json", Field: "customer"}
+		if _, err := l.init(rules); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if l.Len() != 3 || l.Find("c1") != "gold" || l.Find("c3") != "3" || l.Find("c4") != "" {
+			t.Fatalf("unexpected values %s %s %s", l.Find("c1"), l.Find("c3"), l.Find("c4"))
+		}
+	}
+
+	t.Log("yaml list, prefix")
+	{
+		l := &LookupTable{Name: "dc", File: "testdata/lookups/datacenters.yaml", Field: "ip", Key: "prefix", Value: "dc", Match: "Prefix", Reload: "1m"}
+		if _, err := l.init(rules); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if l.Format != LookupYAML || l.Period() != time.Minute {
+			t.Fatalf("unexpected settings %s %s", l.Format, l.Period())
+		}
+		for key, expected := range map[string]string{"10.1.1.5": "us-east", "10.1.2.7": "us-east-b", "10.2.0.1": "eu-west", "10.3.0.1": ""} {
+			if v := l.Find(key); v != expected {
+				t.Fatalf("%q: expected %q, got %q", key, expected, v)
+			}
+		}
+	}
+}
+
+func TestLookupTableLoad(t *testing.T) {
+	t.Log("Testing LookupTable.Load")
+
+	file := filepath.Join(t.TempDir(), "tiers.csv")
+	if err := ioutil.WriteFile(file, []byte("id,tier\nc1,gold\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	l := &LookupTable{Name: "tier", File: file, Format: LookupCSV}
+	if loaded, err := l.Load(false); err != nil || !loaded {
+		t.Fatalf("expected loaded, got %v %v", loaded, err)
+	}
+
+	t.Log("unchanged")
+	if loaded, err := l.Load(false); err != nil || loaded {
+		t.Fatalf("expected not loaded, got %v %v", loaded, err)
+	}
+
+	t.Log("changed")
+	if err := ioutil.WriteFile(file, []byte("id,tier\nc1,platinum\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if loaded, err := l.Load(false); err != nil || !loaded {
+		t.Fatalf("expected loaded, got %v %v", loaded, err)
+	}
+	if v := l.Find("c1"); v != "platinum" {
+		t.Fatalf("expected platinum, got %s", v)
+	}
+
+	t.Log("invalid, previous table kept")
+	if err := ioutil.WriteFile(file, []byte("id\nc1\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if _, err := l.Load(false); err == nil {
+		t.Fatal("expected error")
+	}
+	if v := l.Find("c1"); v != "platinum" {
+		t.Fatalf("expected platinum, got %s", v)
+	}
+
+	t.Log("removed")
+	os.Remove(file)
+	if _, err := l.Load(false); err == nil {
+		t.Fatal("expected error")
+	}
+	if v := l.Find("c1"); v != "platinum" {
+		t.Fatalf("expected platinum, got %s", v)
+	}
+}
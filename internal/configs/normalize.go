@@ -0,0 +1,129 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Normalize defines how captured URL paths are normalized before the
+// name and tags templates are executed, to control tag cardinality.
+type Normalize struct {
+	Fields    []string `json:"fields" yaml:"fields" toml:"fields"`
+	Routes    []string `json:"routes" yaml:"routes" toml:"routes"`
+	KeepQuery bool     `json:"keep_query" yaml:"keep_query" toml:"keep_query"`
+	KeepIDs   bool     `json:"keep_ids" yaml:"keep_ids" toml:"keep_ids"`
+	routes    [][]string
+}
+
+const defaultNormalizeField = "path"
+
+var (
+	numericSegment = regexp.MustCompile(`^[0-9]+$`)
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexSegment     = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// init validates the normalize settings against the named subexpressions
+// of the rule match and prepares the route patterns.
+func (n *Normalize) init(matchParts []string) error {
+	if len(n.Fields) == 0 {
+		n.Fields = []string{defaultNormalizeField}
+	}
+
+	for _, field := range n.Fields {
+		if !hasMatchPart(matchParts, field) {
+			return fmt.Errorf("normalize field (%s) is not a named subexpression in match", field)
+		}
+	}
+
+	n.routes = make([][]string, 0, len(n.Routes))
+	for _, route := range n.Routes {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("normalize route (%s) must start with '/'", route)
+		}
+		segs := strings.Split(route, "/")
+		for i, seg := range segs {
+			if seg == "*" && i != len(segs)-1 {
+				return fmt.Errorf("normalize route (%s) '*' only allowed as last segment", route)
+			}
+		}
+		n.routes = append(n.routes, segs)
+	}
+
+	return nil
+}
+
+// Apply normalizes the configured fields of matches in place.
+func (n *Normalize) Apply(matches map[string]string) {
+	for _, field := range n.Fields {
+		v, ok := matches[field]
+		if !ok {
+			continue
+		}
+		matches[field] = n.Path(v)
+	}
+}
+
+// Path returns the normalized form of a single URL path.
+func (n *Normalize) Path(p string) string {
+	if !n.KeepQuery {
+		p = stripQuery(p)
+	}
+
+	segs := strings.Split(p, "/")
+	for i, route := range n.routes {
+		if routeMatch(route, segs) {
+			return n.Routes[i]
+		}
+	}
+
+	if n.KeepIDs {
+		return p
+	}
+
+	return templatePath(p)
+}
+
+// routeMatch reports whether the path segments match the route pattern,
+// ':name' matches any single segment and a trailing '*' matches the rest.
+func routeMatch(route, segs []string) bool {
+	for i, rs := range route {
+		if rs == "*" {
+			return true
+		}
+		if i >= len(segs) {
+			return false
+		}
+		if strings.HasPrefix(rs, ":") && segs[i] != "" {
+			continue
+		}
+		if rs != segs[i] {
+			return false
+		}
+	}
+	return len(route) == len(segs)
+}
+
+// templatePath replaces numeric, uuid and long hex path segments
+// with :id, :uuid and :hash respectively.
+func templatePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		switch {
+		case seg == "":
+		case numericSegment.MatchString(seg):
+			segs[i] = ":id"
+		case uuidSegment.MatchString(seg):
+			segs[i] = ":uuid"
+		case hexSegment.MatchString(seg):
+			segs[i] = ":hash"
+		}
+	}
+	return strings.Join(segs, "/")
+}
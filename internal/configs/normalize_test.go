@@ -0,0 +1,114 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"testing"
+)
+
+func TestNormalizeInit(t *testing.T) {
+	t.Log("Testing Normalize.init")
+
+	t.Log("default field, missing subexpression")
+	{
+		n := &Normalize{}
+		if err := n.init([]string{"", "method"}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("default field")
+	{
+		n := &Normalize{}
+		if err := n.init([]string{"", "path"}); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if len(n.Fields) != 1 || n.Fields[0] != "path" {
+			t.Fatalf("expected [path] got %v", n.Fields)
+		}
+	}
+
+	t.Log("invalid route")
+	{
+		n := &Normalize{Routes: []string{"users/:id"}}
+		if err := n.init([]string{"", "path"}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("invalid wildcard")
+	{
+		n := &Normalize{Routes: []string{"/static/*/x"}}
+		if err := n.init([]string{"", "path"}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	t.Log("Testing Normalize.Path")
+
+	n := &Normalize{
+		Routes: []string{
+			"/users/:name/profile",
+			"/static/*",
+		},
+	}
+	if err := n.init([]string{"", "path"}); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	tests := map[string]string{
+		"/users/123":                                 "/users/:id",
+		"/users/123?expand=true":                     "/users/:id",
+		"/users/bob/profile":                         "/users/:name/profile",
+		"/users/bob/profile?tab=1":                   "/users/:name/profile",
+		"/static/js/app.js":                          "/static/*",
+		"/obj/3f2504e0-4f89-11d3-9a0c-0305e82c3301":  "/obj/:uuid",
+		"/blob/d41d8cd98f00b204e9800998ecf8427e/raw": "/blob/:hash/raw",
+		"/health": "/health",
+		"/":       "/",
+	}
+
+	for in, expect := range tests {
+		if got := n.Path(in); got != expect {
+			t.Fatalf("%s: expected (%s) got (%s)", in, expect, got)
+		}
+	}
+
+	t.Log("keep query and ids")
+	{
+		k := &Normalize{KeepQuery: true, KeepIDs: true}
+		if err := k.init([]string{"", "path"}); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		in := "/users/123?q=1"
+		if got := k.Path(in); got != in {
+			t.Fatalf("expected (%s) got (%s)", in, got)
+		}
+	}
+}
+
+func TestNormalizeApply(t *testing.T) {
+	t.Log("Testing Normalize.Apply")
+
+	n := &Normalize{Fields: []string{"path", "referer"}}
+	if err := n.init([]string{"", "path", "referer"}); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	matches := map[string]string{"path": "/a/1", "method": "GET"}
+	n.Apply(matches)
+	if matches["path"] != "/a/:id" {
+		t.Fatalf("expected (/a/:id) got (%s)", matches["path"])
+	}
+	if matches["method"] != "GET" {
+		t.Fatalf("expected method untouched, got (%s)", matches["method"])
+	}
+	if _, ok := matches["referer"]; ok {
+		t.Fatal("expected referer not to be added")
+	}
+}
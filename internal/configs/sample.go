@@ -0,0 +1,44 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Sample defines deterministic sampling of log lines, 1 in Rate lines
+// are processed. Without a Field every Rate'th line is kept, with a Field
+// the lines whose named subexpression value hashes to the same 1 in Rate
+// bucket are kept (e.g. all lines for a request id are kept or dropped).
+type Sample struct {
+	Field string `json:"field" yaml:"field" toml:"field"`
+	Rate  int    `json:"rate" yaml:"rate" toml:"rate"`
+}
+
+// init validates the sample settings, the field must be a named
+// subexpression in at least one rule match.
+func (s *Sample) init(rules []*Metric) error {
+	if s.Rate < 1 {
+		return fmt.Errorf("invalid sample rate (%d), must be 1 or more", s.Rate)
+	}
+	if s.Field == "" {
+		return nil
+	}
+	for _, rule := range rules {
+		if hasMatchPart(rule.MatchParts, s.Field) {
+			return nil
+		}
+	}
+	return fmt.Errorf("sample field (%s) is not a named subexpression in any rule match", s.Field)
+}
+
+// Keep reports whether a line with the field value is in the sample.
+func (s *Sample) Keep(value string) bool {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(value))
+	return h.Sum32()%uint32(s.Rate) == 0
+}
@@ -0,0 +1,59 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	t.Log("Testing Sample")
+
+	rules := []*Metric{{MatchParts: []string{"", "request_id", "Value"}}}
+
+	t.Log("init")
+	{
+		tests := []struct {
+			sample Sample
+			ok     bool
+		}{
+			{Sample{Rate: 0}, false},
+			{Sample{Rate: 1}, true},
+			{Sample{Rate: 10}, true},
+			{Sample{Rate: 10, Field: "request_id"}, true},
+			{Sample{Rate: 10, Field: "user"}, false},
+		}
+		for _, tst := range tests {
+			err := tst.sample.init(rules)
+			if tst.ok && err != nil {
+				t.Fatalf("%#v: expected no error, got %s", tst.sample, err)
+			}
+			if !tst.ok && err == nil {
+				t.Fatalf("%#v: expected error", tst.sample)
+			}
+		}
+	}
+
+	t.Log("Keep")
+	{
+		s := Sample{Rate: 10, Field: "request_id"}
+		kept := 0
+		for i := 0; i < 10000; i++ {
+			v := fmt.Sprintf("req-%d", i)
+			k := s.Keep(v)
+			if k != s.Keep(v) {
+				t.Fatalf("%s: expected the same result for the same value", v)
+			}
+			if k {
+				kept++
+			}
+		}
+		if kept < 800 || kept > 1200 {
+			t.Fatalf("expected about 1000 of 10000 kept, got %d", kept)
+		}
+	}
+}
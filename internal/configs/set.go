@@ -0,0 +1,76 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Set modes for Set.Mode.
+const (
+	SetValues = "values" // sent to the destination as a set (circonus: a counter per value, `metric`value)
+	SetExact  = "exact"  // distinct values counted exactly per interval
+	SetHLL    = "hll"    // distinct values estimated with a HyperLogLog per interval
+)
+
+const defaultSetInterval = time.Minute
+
+// Set defines how the values of a set ('s') metric rule are reported.
+// With exact or hll, the number of distinct values seen in each interval
+// is sent as a gauge, `metric`cardinality, optionally along with counters
+// for the top_k most frequent values, `metric`value.
+type Set struct {
+	Mode     string `json:"mode" yaml:"mode" toml:"mode"`
+	Interval string `json:"interval" yaml:"interval" toml:"interval"`
+	TopK     int    `json:"top_k" yaml:"top_k" toml:"top_k"`
+	interval time.Duration
+}
+
+// init validates the set settings.
+func (s *Set) init() error {
+	s.Mode = strings.ToLower(s.Mode)
+	switch s.Mode {
+	case "":
+		s.Mode = SetValues
+	case SetValues, SetExact, SetHLL:
+	default:
+		return fmt.Errorf("invalid set mode (%s), must be values, exact or hll", s.Mode)
+	}
+
+	if s.TopK < 0 {
+		return fmt.Errorf("invalid set top_k (%d), must be >= 0", s.TopK)
+	}
+
+	s.interval = defaultSetInterval
+	if s.Interval != "" {
+		d, err := time.ParseDuration(s.Interval)
+		if err != nil {
+			return fmt.Errorf("parsing set interval: %w", err)
+		}
+		if d < time.Second {
+			return fmt.Errorf("invalid set interval (%s), must be at least 1s", s.Interval)
+		}
+		s.interval = d
+	}
+
+	return nil
+}
+
+// Cardinality reports whether distinct values are counted by logwatch
+// rather than sent to the destination as a set.
+func (s *Set) Cardinality() bool {
+	return s != nil && s.Mode != SetValues && s.Mode != ""
+}
+
+// Period returns the interval distinct values are counted over.
+func (s *Set) Period() time.Duration {
+	if s.interval == 0 {
+		return defaultSetInterval
+	}
+	return s.interval
+}
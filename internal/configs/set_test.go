@@ -0,0 +1,55 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSet(t *testing.T) {
+	t.Log("Testing Set")
+
+	tests := []struct {
+		set         Set
+		period      time.Duration
+		cardinality bool
+		ok          bool
+	}{
+		{Set{}, time.Minute, false, true},
+		{Set{Mode: "values"}, time.Minute, false, true},
+		{Set{Mode: "HLL", Interval: "10s", TopK: 5}, 10 * time.Second, true, true},
+		{Set{Mode: "exact"}, time.Minute, true, true},
+		{Set{Mode: "bloom"}, 0, false, false},
+		{Set{Mode: "exact", TopK: -1}, 0, false, false},
+		{Set{Mode: "exact", Interval: "1ms"}, 0, false, false},
+		{Set{Mode: "exact", Interval: "soon"}, 0, false, false},
+	}
+	for _, tst := range tests {
+		s := tst.set
+		err := s.init()
+		if !tst.ok {
+			if err == nil {
+				t.Fatalf("%#v: expected error", tst.set)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%#v: expected no error, got %s", tst.set, err)
+		}
+		if s.Period() != tst.period {
+			t.Fatalf("%#v: expected period %s, got %s", tst.set, tst.period, s.Period())
+		}
+		if s.Cardinality() != tst.cardinality {
+			t.Fatalf("%#v: expected cardinality %v", tst.set, tst.cardinality)
+		}
+	}
+
+	var s *Set
+	if s.Cardinality() {
+		t.Fatal("expected nil set to use values")
+	}
+}
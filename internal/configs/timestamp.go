@@ -0,0 +1,236 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timestamp defines how the event time is extracted from log lines.
+//
+// The timestamp is taken from the named subexpression `field` of the
+// matching rule, or, if `match` is set, extracted once per line using
+// the `match` regular expression (first named subexpression, otherwise
+// the first subexpression, otherwise the entire match).
+//
+// Layouts:
+//
+//	rfc3339   2006-01-02T15:04:05.999999999Z07:00
+//	apache    02/Jan/2006:15:04:05 -0700 (%t, surrounding [] are ignored)
+//	syslog    Jan _2 15:04:05 (current year assumed)
+//	epoch     seconds since epoch (fractional allowed)
+//	epoch_ms  milliseconds since epoch
+//	epoch_us  microseconds since epoch
+//	epoch_ns  nanoseconds since epoch
+//	strftime  any layout containing % directives (e.g. %Y-%m-%d %H:%M:%S)
+//	otherwise a Go reference time layout (e.g. 2006-01-02 15:04:05)
+type Timestamp struct {
+	Field    string `json:"field" yaml:"field" toml:"field"`
+	Match    string `json:"match" yaml:"match" toml:"match"`
+	Layout   string `json:"layout" yaml:"layout" toml:"layout"`
+	Timezone string `json:"timezone" yaml:"timezone" toml:"timezone"`
+	MaxAge   string `json:"max_age" yaml:"max_age" toml:"max_age"`
+	matcher  *regexp.Regexp
+	loc      *time.Location
+	parse    func(string) (time.Time, error)
+	maxAge   time.Duration
+	matchIdx int
+}
+
+const (
+	layoutApache = "02/Jan/2006:15:04:05 -0700"
+	layoutSyslog = "Jan _2 15:04:05"
+)
+
+// strftimeDirectives maps strftime directives to Go reference time layout elements.
+var strftimeDirectives = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'f': "000000",
+	'L': "000",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'j': "002",
+	'z': "-0700",
+	'Z': "MST",
+	'T': "15:04:05",
+	'F': "2006-01-02",
+	'D': "01/02/06",
+	'%': "%",
+}
+
+// init validates the timestamp settings.
+func (ts *Timestamp) init() error {
+	if ts.Field == "" && ts.Match == "" {
+		return errors.New("one of 'field' or 'match' is required")
+	}
+
+	if ts.Match != "" {
+		re, err := regexp.Compile(ts.Match)
+		if err != nil {
+			return fmt.Errorf("compiling match: %w", err)
+		}
+		ts.matcher = re
+		ts.matchIdx = 0
+		if re.NumSubexp() > 0 {
+			ts.matchIdx = 1
+			for i, name := range re.SubexpNames() {
+				if name != "" {
+					ts.matchIdx = i
+					break
+				}
+			}
+		}
+	}
+
+	ts.loc = time.Local
+	if ts.Timezone != "" {
+		loc, err := time.LoadLocation(ts.Timezone)
+		if err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+		ts.loc = loc
+	}
+
+	if ts.MaxAge != "" {
+		d, err := time.ParseDuration(ts.MaxAge)
+		if err != nil {
+			return fmt.Errorf("max_age: %w", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("max_age (%s) must be positive", ts.MaxAge)
+		}
+		ts.maxAge = d
+	}
+
+	switch strings.ToLower(ts.Layout) {
+	case "":
+		return errors.New("'layout' is required")
+	case "rfc3339", "iso8601":
+		ts.parse = func(s string) (time.Time, error) { return time.Parse(time.RFC3339Nano, s) }
+	case "apache":
+		ts.parse = func(s string) (time.Time, error) {
+			return time.Parse(layoutApache, strings.Trim(s, "[]"))
+		}
+	case "syslog":
+		ts.parse = ts.parseSyslog
+	case "epoch":
+		ts.parse = epochParser(1e9)
+	case "epoch_ms":
+		ts.parse = epochParser(1e6)
+	case "epoch_us":
+		ts.parse = epochParser(1e3)
+	case "epoch_ns":
+		ts.parse = epochParser(1)
+	default:
+		layout := ts.Layout
+		if strings.Contains(layout, "%") {
+			l, err := strftimeLayout(layout)
+			if err != nil {
+				return err
+			}
+			layout = l
+		}
+		ts.parse = func(s string) (time.Time, error) { return time.ParseInLocation(layout, s, ts.loc) }
+	}
+
+	return nil
+}
+
+// Extract returns the raw timestamp from the line using the log level
+// match regular expression. ok is false if match is not configured or
+// the line does not contain a timestamp.
+func (ts *Timestamp) Extract(line string) (string, bool) {
+	if ts.matcher == nil {
+		return "", false
+	}
+	m := ts.matcher.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	return m[ts.matchIdx], true
+}
+
+// Parse converts a raw timestamp to a time.
+func (ts *Timestamp) Parse(s string) (time.Time, error) {
+	return ts.parse(strings.TrimSpace(s))
+}
+
+// Stale reports whether t is older than the configured max_age.
+func (ts *Timestamp) Stale(t time.Time) bool {
+	if ts.maxAge == 0 || t.IsZero() {
+		return false
+	}
+	return time.Since(t) > ts.maxAge
+}
+
+// parseSyslog parses a timestamp without a year, assuming the current
+// year unless that would place the event more than a day in the future.
+func (ts *Timestamp) parseSyslog(s string) (time.Time, error) {
+	t, err := time.ParseInLocation(layoutSyslog, s, ts.loc)
+	if err != nil {
+		return t, err
+	}
+	now := time.Now().In(ts.loc)
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.Sub(now) > 24*time.Hour {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, nil
+}
+
+// epochParser returns a parser for (possibly fractional) epoch values of the given unit in nanoseconds.
+func epochParser(unit float64) func(string) (time.Time, error) {
+	return func(s string) (time.Time, error) {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return time.Unix(0, i*int64(unit)), nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parsing epoch: %w", err)
+		}
+		sec, frac := math.Modf(f * unit / 1e9)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+}
+
+// strftimeLayout converts a strftime format to a Go reference time layout.
+func strftimeLayout(format string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		if i >= len(format) {
+			return "", fmt.Errorf("layout (%s) ends with '%%'", format)
+		}
+		elem, ok := strftimeDirectives[format[i]]
+		if !ok {
+			return "", fmt.Errorf("layout (%s) unsupported directive %%%c", format, format[i])
+		}
+		b.WriteString(elem)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,155 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestampInit(t *testing.T) {
+	t.Log("Testing Timestamp.init")
+
+	invalid := []*Timestamp{
+		{Layout: "rfc3339"},
+		{Field: "ts"},
+		{Field: "ts", Layout: "rfc3339", Timezone: "Nowhere/Special"},
+		{Field: "ts", Layout: "rfc3339", MaxAge: "forever"},
+		{Field: "ts", Layout: "rfc3339", MaxAge: "-1h"},
+		{Match: "[a-", Layout: "rfc3339"},
+		{Field: "ts", Layout: "%Y-%m-%d %Q"},
+		{Field: "ts", Layout: "%Y-%m-%d %"},
+	}
+
+	for _, ts := range invalid {
+		t.Logf("invalid %#v", ts)
+		if err := ts.init(); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestTimestampParse(t *testing.T) {
+	t.Log("Testing Timestamp.Parse")
+
+	expect := time.Date(2023, time.October, 10, 13, 55, 36, 0, time.UTC)
+
+	tests := []struct {
+		ts  *Timestamp
+		raw string
+	}{
+		{&Timestamp{Field: "ts", Layout: "rfc3339"}, "2023-10-10T13:55:36Z"},
+		{&Timestamp{Field: "ts", Layout: "apache"}, "[10/Oct/2023:13:55:36 +0000]"},
+		{&Timestamp{Field: "ts", Layout: "apache"}, "10/Oct/2023:06:55:36 -0700"},
+		{&Timestamp{Field: "ts", Layout: "epoch"}, "1696946136"},
+		{&Timestamp{Field: "ts", Layout: "epoch_ms"}, "1696946136000"},
+		{&Timestamp{Field: "ts", Layout: "epoch_us"}, "1696946136000000"},
+		{&Timestamp{Field: "ts", Layout: "epoch_ns"}, "1696946136000000000"},
+		{&Timestamp{Field: "ts", Layout: "epoch"}, "1696946136.000"},
+		{&Timestamp{Field: "ts", Layout: "%Y-%m-%d %H:%M:%S", Timezone: "UTC"}, "2023-10-10 13:55:36"},
+		{&Timestamp{Field: "ts", Layout: "%d/%b/%Y:%T %z"}, "10/Oct/2023:13:55:36 +0000"},
+		{&Timestamp{Field: "ts", Layout: "2006-01-02 15:04:05", Timezone: "UTC"}, "2023-10-10 13:55:36"},
+	}
+
+	for _, test := range tests {
+		if err := test.ts.init(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		got, err := test.ts.Parse(test.raw)
+		if err != nil {
+			t.Fatalf("%s (%s): expected no error, got (%s)", test.ts.Layout, test.raw, err)
+		}
+		if !got.Equal(expect) {
+			t.Fatalf("%s (%s): expected %s got %s", test.ts.Layout, test.raw, expect, got)
+		}
+	}
+
+	t.Log("syslog (no year)")
+	{
+		ts := &Timestamp{Field: "ts", Layout: "syslog", Timezone: "UTC"}
+		if err := ts.init(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		now := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+		got, err := ts.Parse(now.Format("Jan _2 15:04:05"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if !got.Equal(now) {
+			t.Fatalf("expected %s got %s", now, got)
+		}
+	}
+
+	t.Log("invalid")
+	{
+		ts := &Timestamp{Field: "ts", Layout: "epoch"}
+		if err := ts.init(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if _, err := ts.Parse("yesterday"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestTimestampExtract(t *testing.T) {
+	t.Log("Testing Timestamp.Extract")
+
+	tests := []struct {
+		match  string
+		expect string
+	}{
+		{`\[([^\]]+)\]`, "10/Oct/2023:13:55:36 +0000"},
+		{`(GET) \S+ \[(?P<ts>[^\]]+)\]`, "10/Oct/2023:13:55:36 +0000"},
+		{`[0-9]{2}/[A-Za-z]{3}/[0-9]{4}:[0-9:]+ \+0000`, "10/Oct/2023:13:55:36 +0000"},
+	}
+
+	line := `127.0.0.1 GET /x [10/Oct/2023:13:55:36 +0000] 200`
+
+	for _, test := range tests {
+		ts := &Timestamp{Match: test.match, Layout: "apache"}
+		if err := ts.init(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		got, ok := ts.Extract(line)
+		if !ok {
+			t.Fatalf("%s: expected match", test.match)
+		}
+		if got != test.expect {
+			t.Fatalf("%s: expected (%s) got (%s)", test.match, test.expect, got)
+		}
+	}
+
+	t.Log("no match configured")
+	{
+		ts := &Timestamp{Field: "ts", Layout: "apache"}
+		if err := ts.init(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if _, ok := ts.Extract(line); ok {
+			t.Fatal("expected no match")
+		}
+	}
+}
+
+func TestTimestampStale(t *testing.T) {
+	t.Log("Testing Timestamp.Stale")
+
+	ts := &Timestamp{Field: "ts", Layout: "epoch", MaxAge: "1h"}
+	if err := ts.init(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	if ts.Stale(time.Now().Add(-30 * time.Minute)) {
+		t.Fatal("expected not stale")
+	}
+	if !ts.Stale(time.Now().Add(-2 * time.Hour)) {
+		t.Fatal("expected stale")
+	}
+	if ts.Stale(time.Time{}) {
+		t.Fatal("expected zero time not stale")
+	}
+}
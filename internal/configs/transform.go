@@ -0,0 +1,164 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValueTransform defines conversions applied to an extracted value
+// before it is parsed according to the metric type.
+//
+// Order of operations:
+//
+//  1. map    - enum string to number (e.g. OK=1, FAIL=0)
+//  2. from/to - unit conversion, a unit suffix on the value (e.g. 12.3KB, 1.2GiB, 250us) takes precedence over from
+//  3. scale  - multiply by a factor
+type ValueTransform struct {
+	Map   map[string]float64 `json:"map" yaml:"map" toml:"map"`
+	From  string             `json:"from" yaml:"from" toml:"from"`
+	To    string             `json:"to" yaml:"to" toml:"to"`
+	Scale float64            `json:"scale" yaml:"scale" toml:"scale"`
+	to    *unit
+	from  *unit
+}
+
+type unitKind int
+
+const (
+	unitTime unitKind = iota
+	unitBytes
+)
+
+type unit struct {
+	kind   unitKind
+	factor float64 // relative to the base unit of the kind (ns, bytes)
+}
+
+// units supported for conversion, names are matched case-insensitively
+// with the exception of the single letter time units.
+var units = map[string]unit{
+	"ns": {unitTime, 1},
+	"us": {unitTime, 1e3},
+	"µs": {unitTime, 1e3},
+	"ms": {unitTime, 1e6},
+	"s":  {unitTime, 1e9},
+	"m":  {unitTime, 60e9},
+	"h":  {unitTime, 3600e9},
+
+	"b":   {unitBytes, 1},
+	"kb":  {unitBytes, 1e3},
+	"mb":  {unitBytes, 1e6},
+	"gb":  {unitBytes, 1e9},
+	"tb":  {unitBytes, 1e12},
+	"kib": {unitBytes, 1 << 10},
+	"mib": {unitBytes, 1 << 20},
+	"gib": {unitBytes, 1 << 30},
+	"tib": {unitBytes, 1 << 40},
+}
+
+func lookupUnit(name string) (*unit, bool) {
+	if u, ok := units[name]; ok {
+		return &u, true
+	}
+	if u, ok := units[strings.ToLower(name)]; ok {
+		return &u, true
+	}
+	return nil, false
+}
+
+// init validates the transform settings.
+func (vt *ValueTransform) init() error {
+	if vt.From != "" {
+		u, ok := lookupUnit(vt.From)
+		if !ok {
+			return fmt.Errorf("unknown unit 'from' (%s)", vt.From)
+		}
+		vt.from = u
+	}
+	if vt.To != "" {
+		u, ok := lookupUnit(vt.To)
+		if !ok {
+			return fmt.Errorf("unknown unit 'to' (%s)", vt.To)
+		}
+		vt.to = u
+	}
+	if vt.from != nil && vt.to == nil {
+		return errors.New("'from' requires 'to'")
+	}
+	if vt.from != nil && vt.to != nil && vt.from.kind != vt.to.kind {
+		return fmt.Errorf("incompatible units 'from' (%s) 'to' (%s)", vt.From, vt.To)
+	}
+	return nil
+}
+
+// Apply transforms the value, returning the resulting number.
+func (vt *ValueTransform) Apply(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+
+	var v float64
+	if n, ok := vt.Map[value]; ok {
+		v = n
+	} else {
+		num, suffix := splitUnit(value)
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			if len(vt.Map) > 0 {
+				return 0, fmt.Errorf("value (%s) not in map", value)
+			}
+			return 0, fmt.Errorf("parsing value (%s): %w", value, err)
+		}
+		v = f
+
+		if vt.to != nil {
+			src := vt.from
+			if suffix != "" {
+				u, ok := lookupUnit(suffix)
+				if !ok {
+					return 0, fmt.Errorf("unknown unit (%s) in value (%s)", suffix, value)
+				}
+				src = u
+			}
+			if src == nil {
+				return 0, fmt.Errorf("value (%s) has no unit and 'from' not set", value)
+			}
+			if src.kind != vt.to.kind {
+				return 0, fmt.Errorf("incompatible unit in value (%s) for 'to' (%s)", value, vt.To)
+			}
+			v = v * src.factor / vt.to.factor
+		} else if suffix != "" {
+			return 0, fmt.Errorf("value (%s) has a unit and 'to' not set", value)
+		}
+	}
+
+	if vt.Scale != 0 {
+		v *= vt.Scale
+	}
+
+	return v, nil
+}
+
+// splitUnit separates a numeric value from a trailing unit suffix (e.g. "1.2GiB" -> "1.2", "GiB").
+func splitUnit(value string) (string, string) {
+	i := len(value)
+	for i > 0 {
+		c := value[i-1]
+		if (c >= '0' && c <= '9') || c == '.' {
+			break
+		}
+		i--
+	}
+	// handle exponent notation (e.g. 1e+06) as a number, not a unit
+	if i < len(value) {
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return value, ""
+		}
+	}
+	return value[:i], strings.TrimSpace(value[i:])
+}
@@ -0,0 +1,86 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package configs
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValueTransformInit(t *testing.T) {
+	t.Log("Testing ValueTransform.init")
+
+	invalid := []*ValueTransform{
+		{From: "parsecs", To: "ms"},
+		{From: "us", To: "lightyears"},
+		{From: "us"},
+		{From: "us", To: "MB"},
+	}
+
+	for _, vt := range invalid {
+		t.Logf("invalid %#v", vt)
+		if err := vt.init(); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestValueTransformApply(t *testing.T) {
+	t.Log("Testing ValueTransform.Apply")
+
+	tests := []struct {
+		vt     *ValueTransform
+		value  string
+		expect float64
+	}{
+		{&ValueTransform{From: "us", To: "ms"}, "1500", 1.5},
+		{&ValueTransform{From: "s", To: "ms"}, "0.25", 250},
+		{&ValueTransform{From: "B", To: "MB"}, "2500000", 2.5},
+		{&ValueTransform{To: "B"}, "12.3KB", 12300},
+		{&ValueTransform{To: "MiB"}, "1.5GiB", 1536},
+		{&ValueTransform{To: "B"}, "2 KiB", 2048},
+		{&ValueTransform{From: "s", To: "ms"}, "250us", 0.25},
+		{&ValueTransform{Scale: 0.001}, "1234", 1.234},
+		{&ValueTransform{From: "us", To: "ms", Scale: 2}, "1000", 2},
+		{&ValueTransform{Map: map[string]float64{"OK": 1, "FAIL": 0}}, "FAIL", 0},
+		{&ValueTransform{Map: map[string]float64{"OK": 1, "FAIL": 0}}, "OK", 1},
+		{&ValueTransform{}, "1e+03", 1000},
+	}
+
+	for _, test := range tests {
+		if err := test.vt.init(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		v, err := test.vt.Apply(test.value)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got (%s)", test.value, err)
+		}
+		if math.Abs(v-test.expect) > 1e-9 {
+			t.Fatalf("%s: expected %f got %f", test.value, test.expect, v)
+		}
+	}
+
+	errs := []struct {
+		vt    *ValueTransform
+		value string
+	}{
+		{&ValueTransform{Map: map[string]float64{"OK": 1}}, "UNKNOWN"},
+		{&ValueTransform{To: "ms"}, "100"},
+		{&ValueTransform{To: "ms"}, "10KB"},
+		{&ValueTransform{To: "ms"}, "10 parsecs"},
+		{&ValueTransform{}, "10KB"},
+		{&ValueTransform{}, "abc"},
+	}
+
+	for _, test := range errs {
+		if err := test.vt.init(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if _, err := test.vt.Apply(test.value); err == nil {
+			t.Fatalf("%s: expected error", test.value)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"io/ioutil"
 	stdlog "log"
 	"strings"
+	"sync"
 	"time"
 
 	cgm "github.com/circonus-labs/circonus-gometrics/v3"
@@ -24,9 +25,17 @@ import (
 )
 
 // Circonus defines an instance of the circonus metrics destination.
+//
+// cgm's automatic flush is disabled, all flushes are made by the
+// destination, serialized by flushMu, so a flush is never skipped while
+// another is in progress.
 type Circonus struct {
-	client *cgm.CirconusMetrics
-	logger zerolog.Logger
+	client   *cgm.CirconusMetrics
+	ts       *tsBuckets
+	submits  *submitLog
+	logger   zerolog.Logger
+	interval time.Duration
+	flushMu  sync.Mutex
 }
 
 // New returns a new instance of the circonus metrics destination.
@@ -36,6 +45,13 @@ func New() (*Circonus, error) {
 	logger := log.With().Str("pkg", "circonus").Logger()
 	dest := viper.GetString(config.KeyDestType)
 
+	// flush interval for agent, the cgm default for check
+	interval := "10s"
+	submits := &submitLog{}
+	if viper.GetBool(config.KeyDebugCGM) {
+		submits.out = log.With().Str("pkg", "dest-check").Logger()
+	}
+
 	switch dest {
 	case "agent":
 		sURL := viper.GetString(config.KeyDestAgentURL)
@@ -44,14 +60,12 @@ func New() (*Circonus, error) {
 		}
 
 		cmc := &cgm.Config{}
-		if viper.GetBool(config.KeyDebugCGM) {
-			cmc.Debug = true
-			cmc.Log = stdlog.New(log.With().Str("pkg", "dest-check").Logger(), "", 0)
-		}
+		cmc.Debug = viper.GetBool(config.KeyDebugCGM)
+		cmc.Log = stdlog.New(submits, "", 0)
 
 		cmc.CheckManager.Check.SubmissionURL = sURL
 
-		interval := viper.GetString(config.KeyDestCfgAgentInterval)
+		interval = viper.GetString(config.KeyDestCfgAgentInterval)
 		if interval == "" {
 			interval = defaults.AgentInterval
 		}
@@ -59,7 +73,7 @@ func New() (*Circonus, error) {
 		if err != nil {
 			return nil, fmt.Errorf("parsing destination interval: %w", err)
 		}
-		cmc.Interval = interval
+		cmc.Interval = "0" // flushed by the destination
 
 		c, err := cgm.New(cmc)
 		if err != nil {
@@ -69,10 +83,9 @@ func New() (*Circonus, error) {
 
 	case "check":
 		cmc := &cgm.Config{}
-		if viper.GetBool(config.KeyDebugCGM) {
-			cmc.Debug = true
-			cmc.Log = stdlog.New(log.With().Str("pkg", "dest-check").Logger(), "", 0)
-		}
+		cmc.Debug = viper.GetBool(config.KeyDebugCGM)
+		cmc.Log = stdlog.New(submits, "", 0)
+		cmc.Interval = "0" // flushed by the destination
 		cmc.CheckManager.API.TokenKey = viper.GetString(config.KeyAPITokenKey)
 		if viper.GetString(config.KeyAPITokenApp) != "" {
 			cmc.CheckManager.API.TokenApp = viper.GetString(config.KeyAPITokenApp)
@@ -116,21 +129,75 @@ func New() (*Circonus, error) {
 		return nil, fmt.Errorf("unknown destination type for circonus client %s", dest)
 	}
 
-	return &Circonus{client: client, logger: logger}, nil
+	// submissions are failing until a flush passes without an error
+	flush, _ := time.ParseDuration(interval)
+	submits.window = 2 * flush
+
+	return &Circonus{
+		client:   client,
+		submits:  submits,
+		logger:   logger,
+		interval: flush,
+		ts: &tsBuckets{
+			buckets: make(map[int64]map[string]*tsSample),
+			done:    make(chan struct{}),
+		},
+	}, nil
 }
 
-// Start NOOP cgm starts as it is initialized.
+// Start the periodic flush.
 func (c *Circonus) Start() error {
-	// noop
+	go c.flushPeriodic()
 	return nil
 }
 
 // Stop flushes any outstanding metrics.
 func (c *Circonus) Stop() error {
-	c.client.Flush()
+	c.ts.Lock()
+	select {
+	case <-c.ts.done:
+	default:
+		close(c.ts.done)
+	}
+	c.ts.Unlock()
+	c.flush(true)
 	return nil
 }
 
+// flush submits the metrics and the closed timestamped buckets, or all of
+// them, waiting for any flush in progress. Until the check is ready
+// nothing is flushed, cgm would drop the metrics.
+func (c *Circonus) flush(all bool) {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	if !c.client.Ready() {
+		c.logger.Debug().Msg("check not ready, holding metrics")
+		return
+	}
+
+	ready := c.takeClosed(all)
+	if len(ready) == 0 {
+		c.client.Flush()
+		return
+	}
+	c.submitBuckets(ready)
+}
+
+// flushPeriodic flushes the metrics every destination interval.
+func (c *Circonus) flushPeriodic() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ts.done:
+			return
+		case <-ticker.C:
+			c.flush(false)
+		}
+	}
+}
+
 // convert []string to cgm.Tags.
 func (c *Circonus) tagsToCgmTags(tags []string) cgm.Tags {
 	var tagList cgm.Tags
@@ -0,0 +1,66 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package circonus
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cgm submits in the background and only logs submission failures, the
+// messages which indicate metrics were not delivered.
+var submitErrors = []string{"error sending metrics", "check not ready"}
+
+// submitLog receives the cgm log to record submission failures, messages
+// are forwarded to out (the debug_cgm logger) if set. Submissions are
+// considered to be failing until one flush window passes without an error.
+type submitLog struct {
+	out     io.Writer
+	lastErr error
+	since   time.Time
+	last    time.Time
+	window  time.Duration
+	sync.Mutex
+}
+
+func (l *submitLog) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	for _, e := range submitErrors {
+		if strings.Contains(msg, e) {
+			l.failure(errors.New(msg))
+			break
+		}
+	}
+	if l.out != nil {
+		return l.out.Write(p)
+	}
+	return len(p), nil
+}
+
+func (l *submitLog) failure(err error) {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	if l.last.IsZero() || now.Sub(l.last) > l.window {
+		l.since = now
+	}
+	l.last = now
+	l.lastErr = err
+}
+
+// Health returns the last submission error and when submissions started
+// failing, nil if there has not been an error in the last flush window.
+func (c *Circonus) Health() (time.Time, error) {
+	c.submits.Lock()
+	defer c.submits.Unlock()
+	if c.submits.last.IsZero() || time.Since(c.submits.last) > c.submits.window {
+		return time.Time{}, nil
+	}
+	return c.submits.since, c.submits.lastErr
+}
@@ -0,0 +1,56 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package circonus
+
+import (
+	"bytes"
+	stdlog "log"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	t.Log("Testing Health")
+
+	var out bytes.Buffer
+	c := &Circonus{submits: &submitLog{out: &out, window: time.Minute}}
+	cgmLog := stdlog.New(c.submits, "", 0)
+
+	t.Log("no submission errors")
+	{
+		cgmLog.Printf("using socket transport")
+		if _, err := c.Health(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if out.Len() == 0 {
+			t.Fatal("expected message forwarded to debug log")
+		}
+	}
+
+	t.Log("submission failing")
+	{
+		cgmLog.Printf("error sending metrics - %s\n", "connection refused")
+		since, err := c.Health()
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if err.Error() != "error sending metrics - connection refused" {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		cgmLog.Printf("check not ready, skipping metric submission")
+		if again, _ := c.Health(); !again.Equal(since) {
+			t.Fatalf("expected failing since %s, got %s", since, again)
+		}
+	}
+
+	t.Log("recovered after window")
+	{
+		c.submits.last = time.Now().Add(-2 * time.Minute)
+		if _, err := c.Health(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package circonus
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+	"github.com/openhistogram/circonusllhist"
+)
+
+// Metrics carrying an explicit event time are aggregated into fixed
+// size buckets and submitted, with the bucket start as the HTTPTrap
+// `_ts`, by the first flush after a newer bucket is seen or the bucket
+// has aged out.
+const tsBucketSize = 10 * time.Second
+
+type tsSample struct {
+	gauge   interface{}
+	hist    *circonusllhist.Histogram
+	mtype   string
+	text    string
+	counter uint64
+}
+
+type tsBuckets struct {
+	buckets map[int64]map[string]*tsSample
+	done    chan struct{}
+	newest  int64
+	sync.Mutex
+}
+
+// IncrementCounterByValueWithTagsAndTime adds value to the counter for the bucket containing ts.
+func (c *Circonus) IncrementCounterByValueWithTagsAndTime(metric string, tags []string, value uint64, ts time.Time) error {
+	c.record(metric, tags, ts, func(s *tsSample) {
+		s.mtype = "L"
+		s.counter += value
+	})
+	return nil
+}
+
+// SetGaugeValueWithTagsAndTime sets the gauge for the bucket containing ts.
+func (c *Circonus) SetGaugeValueWithTagsAndTime(metric string, tags []string, value interface{}, ts time.Time) error {
+	if sv, ok := value.(string); ok {
+		v, err := strconv.ParseFloat(sv, 64)
+		if err != nil {
+			return fmt.Errorf("gauge value (%s): %w", sv, err)
+		}
+		value = v
+	}
+	c.record(metric, tags, ts, func(s *tsSample) {
+		s.mtype = "n"
+		s.gauge = value
+	})
+	return nil
+}
+
+// SetHistogramValueWithTagsAndTime records a sample in the histogram for the bucket containing ts.
+func (c *Circonus) SetHistogramValueWithTagsAndTime(metric string, tags []string, value float64, ts time.Time) error {
+	c.record(metric, tags, ts, func(s *tsSample) {
+		s.mtype = "h"
+		if s.hist == nil {
+			s.hist = circonusllhist.New()
+		}
+		_ = s.hist.RecordValue(value)
+	})
+	return nil
+}
+
+// SetTextValueWithTagsAndTime sets the text metric for the bucket containing ts.
+func (c *Circonus) SetTextValueWithTagsAndTime(metric string, tags []string, value string, ts time.Time) error {
+	c.record(metric, tags, ts, func(s *tsSample) {
+		s.mtype = "s"
+		s.text = value
+	})
+	return nil
+}
+
+// record applies fn to the sample for the metric in the bucket containing ts.
+func (c *Circonus) record(metric string, tags []string, ts time.Time, fn func(*tsSample)) {
+	name := c.client.MetricNameWithStreamTags(metric, c.tagsToCgmTags(tags))
+	bucket := ts.Truncate(tsBucketSize).UnixNano()
+
+	c.ts.Lock()
+	samples, ok := c.ts.buckets[bucket]
+	if !ok {
+		samples = make(map[string]*tsSample)
+		c.ts.buckets[bucket] = samples
+	}
+	s, ok := samples[name]
+	if !ok {
+		s = &tsSample{}
+		samples[name] = s
+	}
+	fn(s)
+	if bucket > c.ts.newest {
+		c.ts.newest = bucket
+	}
+	c.ts.Unlock()
+}
+
+// takeClosed removes and returns the buckets ready to be submitted, or
+// all of them.
+func (c *Circonus) takeClosed(all bool) map[int64]map[string]*tsSample {
+	c.ts.Lock()
+	defer c.ts.Unlock()
+	cutoff := c.ts.newest
+	if all {
+		cutoff++
+	} else if aged := time.Now().Add(-tsBucketSize).Truncate(tsBucketSize).UnixNano(); aged > cutoff {
+		cutoff = aged
+	}
+	return c.takeBuckets(cutoff)
+}
+
+// takeBuckets removes and returns all buckets older than the cutoff, ts must be locked.
+func (c *Circonus) takeBuckets(cutoff int64) map[int64]map[string]*tsSample {
+	var ready map[int64]map[string]*tsSample
+	for b, samples := range c.ts.buckets {
+		if b < cutoff {
+			if ready == nil {
+				ready = make(map[int64]map[string]*tsSample)
+			}
+			ready[b] = samples
+			delete(c.ts.buckets, b)
+		}
+	}
+	return ready
+}
+
+// submitBuckets sends each bucket, oldest first, as custom metrics with an
+// explicit timestamp. The first bucket goes with the metrics being flushed,
+// cgm holds one custom metric per name, so each further bucket is sent in
+// a submission of its own. flushMu must be held.
+func (c *Circonus) submitBuckets(ready map[int64]map[string]*tsSample) {
+	keys := make([]int64, 0, len(ready))
+	for b := range ready {
+		keys = append(keys, b)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	for _, b := range keys {
+		tsMS := uint64(b / int64(time.Millisecond))
+		for name, s := range ready[b] {
+			m := cgm.Metric{Type: s.mtype, Timestamp: tsMS}
+			switch s.mtype {
+			case "L":
+				m.Value = s.counter
+			case "n":
+				m.Value = s.gauge
+			case "s":
+				m.Value = s.text
+			case "h":
+				var buf bytes.Buffer
+				if err := s.hist.SerializeB64(&buf); err != nil {
+					c.logger.Warn().Err(err).Str("metric", name).Msg("serializing histogram")
+					continue
+				}
+				m.Value = buf.String()
+			}
+			if err := c.client.Custom(name, m); err != nil {
+				c.logger.Warn().Err(err).Str("metric", name).Msg("adding timestamped metric")
+			}
+		}
+		c.client.Flush()
+	}
+}
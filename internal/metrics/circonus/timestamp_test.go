@@ -0,0 +1,205 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package circonus
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestTimestamped(t *testing.T) {
+	t.Log("Testing *WithTagsAndTime")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	var mu sync.Mutex
+	var submissions []map[string]map[string]interface{}
+	tsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading body: %s", err)
+			return
+		}
+		var m map[string]map[string]interface{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Errorf("parsing body: %s", err)
+			return
+		}
+		mu.Lock()
+		submissions = append(submissions, m)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer tsrv.Close()
+
+	viper.Set(config.KeyDestType, "agent")
+	viper.Set(config.KeyDestAgentURL, tsrv.URL)
+	viper.Set(config.KeyDestCfgAgentInterval, "60s")
+	defer viper.Reset()
+
+	c, err := New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	tags := []string{"log_id:test"}
+	old := time.Date(2023, time.October, 10, 13, 55, 36, 0, time.UTC)
+	newer := old.Add(time.Minute)
+
+	if err := c.IncrementCounterWithTags("regular", tags); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if err := c.IncrementCounterByValueWithTagsAndTime("foo", tags, 2, old); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if err := c.IncrementCounterByValueWithTagsAndTime("foo", tags, 3, old.Add(time.Second)); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if err := c.SetGaugeValueWithTagsAndTime("bar", tags, "1.5", old); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if err := c.SetGaugeValueWithTagsAndTime("bar", tags, "abc", old); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := c.SetHistogramValueWithTagsAndTime("baz", tags, 1.2, old); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if err := c.SetTextValueWithTagsAndTime("qux", tags, "hello", old); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	// newer bucket closes the older one, nothing is sent before the next flush
+	if err := c.IncrementCounterByValueWithTagsAndTime("foo", tags, 1, newer); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	mu.Lock()
+	if len(submissions) != 0 {
+		mu.Unlock()
+		t.Fatalf("expected no submissions, got %d", len(submissions))
+	}
+	mu.Unlock()
+
+	// both buckets have aged out, the oldest goes with the regular metrics
+	c.flush(false)
+
+	mu.Lock()
+	if len(submissions) != 2 {
+		mu.Unlock()
+		t.Fatalf("expected 2 submissions, got %d", len(submissions))
+	}
+	first, second := submissions[0], submissions[1]
+	mu.Unlock()
+
+	if len(first) != 5 {
+		t.Fatalf("expected 5 metrics, got %d (%v)", len(first), first)
+	}
+	expectTS := float64(old.Truncate(tsBucketSize).UnixNano() / int64(time.Millisecond))
+	for name, m := range first {
+		if strings.HasPrefix(name, "regular") {
+			if _, ok := m["_ts"]; ok {
+				t.Fatalf("%s: expected no _ts got %v", name, m["_ts"])
+			}
+			continue
+		}
+		if m["_ts"] != expectTS {
+			t.Fatalf("%s: expected _ts %v got %v", name, expectTS, m["_ts"])
+		}
+		if m["_type"] == "L" && m["_value"] != float64(5) {
+			t.Fatalf("%s: expected counter 5 got %v", name, m["_value"])
+		}
+	}
+	if len(second) != 1 {
+		t.Fatalf("expected 1 metric, got %d (%v)", len(second), second)
+	}
+
+	if err := c.Stop(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(submissions) != 2 {
+		t.Fatalf("expected 2 submissions, got %d", len(submissions))
+	}
+}
+
+func TestTimestampedConcurrent(t *testing.T) {
+	t.Log("Testing *WithTagsAndTime, concurrent buckets")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	var mu sync.Mutex
+	var total float64
+	tsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading body: %s", err)
+			return
+		}
+		var m map[string]map[string]interface{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Errorf("parsing body: %s", err)
+			return
+		}
+		mu.Lock()
+		for _, v := range m {
+			if n, ok := v["_value"].(float64); ok {
+				total += n
+			}
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer tsrv.Close()
+
+	viper.Set(config.KeyDestType, "agent")
+	viper.Set(config.KeyDestAgentURL, tsrv.URL)
+	viper.Set(config.KeyDestCfgAgentInterval, "60s")
+	defer viper.Reset()
+
+	c, err := New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	// buckets are recorded from several goroutines at once, none of them
+	// may be lost
+	start := time.Date(2023, time.October, 10, 13, 0, 0, 0, time.UTC)
+	buckets := 50
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < buckets; i++ {
+				_ = c.IncrementCounterByValueWithTagsAndTime("foo", []string{"log_id:test"}, 1, start.Add(time.Duration(i)*tsBucketSize))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := c.Stop(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if total != float64(4*buckets) {
+		t.Fatalf("expected total %d, got %v", 4*buckets, total)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// Package llhist aggregates histogram values in process, in a log-linear
+// histogram (circllhist) per metric name and tag set, for destinations
+// which would otherwise send every value. Each interval the histograms
+// are handed to the destination and reset.
+package llhist
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/openhistogram/circonusllhist"
+	"github.com/spf13/viper"
+)
+
+// FlushFunc sends the histogram of a metric for an interval. ts is the
+// start of the event time interval of values recorded with a time, zero
+// for the others.
+type FlushFunc func(metric string, tags []string, ts time.Time, hist *circonusllhist.Histogram)
+
+// Aggregator holds the histograms for the current interval.
+type Aggregator struct {
+	hists    map[string]*series
+	flush    FlushFunc
+	done     chan struct{}
+	stopped  chan struct{}
+	interval time.Duration
+	mu       sync.Mutex
+	stopOnce sync.Once
+}
+
+type series struct {
+	ts     time.Time
+	hist   *circonusllhist.Histogram
+	metric string
+	tags   []string
+}
+
+// New returns an aggregator calling flush for each histogram every
+// interval.
+func New(interval time.Duration, flush FlushFunc) (*Aggregator, error) {
+	if interval <= 0 {
+		return nil, errors.New("invalid histogram interval, must be greater than zero")
+	}
+	if flush == nil {
+		return nil, errors.New("invalid flush function (nil)")
+	}
+	return &Aggregator{
+		hists:    make(map[string]*series),
+		flush:    flush,
+		interval: interval,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}, nil
+}
+
+// FromConfig returns an aggregator using the configured histogram interval,
+// nil if local histograms are disabled, and the configured quantiles.
+func FromConfig(flush FlushFunc) (*Aggregator, []float64, error) {
+	v := viper.GetString(config.KeyHistogramInterval)
+	if v == "" {
+		return nil, nil, nil
+	}
+	interval, err := time.ParseDuration(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	if interval == 0 {
+		return nil, nil, nil
+	}
+	qs, err := config.ParseQuantiles(viper.GetString(config.KeyHistogramQuantiles))
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := New(interval, flush)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, qs, nil
+}
+
+// Start flushing the histograms every interval.
+func (a *Aggregator) Start() {
+	go func() {
+		defer close(a.stopped)
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.done:
+				return
+			case <-ticker.C:
+				a.Flush()
+			}
+		}
+	}()
+}
+
+// Stop flushing and send the histograms of the current interval.
+func (a *Aggregator) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.done)
+	})
+	select {
+	case <-a.stopped:
+	case <-time.After(a.interval):
+	}
+	a.Flush()
+}
+
+// Record adds n occurrences of value to the histogram of the metric.
+func (a *Aggregator) Record(metric string, tags []string, value float64, n int64) {
+	a.record(metric, tags, time.Time{}, value, n)
+}
+
+// RecordWithTime adds n occurrences of value, with an event time, to the
+// histogram of the metric for the interval containing ts.
+func (a *Aggregator) RecordWithTime(metric string, tags []string, value float64, n int64, ts time.Time) {
+	a.record(metric, tags, ts.Truncate(a.interval), value, n)
+}
+
+func (a *Aggregator) record(metric string, tags []string, ts time.Time, value float64, n int64) {
+	key := seriesKey(metric, tags)
+	if !ts.IsZero() {
+		key += "@" + strconv.FormatInt(ts.UnixNano(), 10)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.hists[key]
+	if !ok {
+		s = &series{
+			hist:   circonusllhist.New(circonusllhist.NoLocks()),
+			metric: metric,
+			tags:   tags,
+			ts:     ts,
+		}
+		a.hists[key] = s
+	}
+	_ = s.hist.RecordValues(value, n)
+}
+
+// Flush sends and removes the histograms of the current interval.
+func (a *Aggregator) Flush() {
+	a.mu.Lock()
+	hists := a.hists
+	a.hists = make(map[string]*series, len(hists))
+	a.mu.Unlock()
+
+	keys := make([]string, 0, len(hists))
+	for k := range hists {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := hists[k]
+		a.flush(s.metric, s.tags, s.ts, s.hist)
+	}
+}
+
+// Quantiles returns the values of the histogram at the quantiles.
+func Quantiles(hist *circonusllhist.Histogram, qs []float64) []float64 {
+	vals, err := hist.ApproxQuantile(qs)
+	if err != nil {
+		vals = make([]float64, len(qs))
+		for i := range vals {
+			vals[i] = math.NaN()
+		}
+	}
+	return vals
+}
+
+// QuantileName returns the metric name suffix for a quantile, e.g. p99
+// for 0.99 and p99.9 for 0.999.
+func QuantileName(q float64) string {
+	return "p" + strconv.FormatFloat(math.Round(q*1e6)/1e4, 'f', -1, 64)
+}
+
+// RateCount returns the number of occurrences a value recorded from a
+// sample of rate (0-1] of the events represents.
+func RateCount(rate float64) int64 {
+	if rate <= 0 || rate >= 1 {
+		return 1
+	}
+	return int64(math.Round(1 / rate))
+}
+
+// seriesKey identifies a metric name and tag set, independent of the
+// order of the tags.
+func seriesKey(metric string, tags []string) string {
+	if len(tags) == 0 {
+		return metric
+	}
+	sorted := make([]string, len(tags))
+	copy(sorted, tags)
+	sort.Strings(sorted)
+	return metric + "|" + strings.Join(sorted, ",")
+}
@@ -0,0 +1,174 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package llhist
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/openhistogram/circonusllhist"
+	"github.com/spf13/viper"
+)
+
+func TestNew(t *testing.T) {
+	t.Log("Testing New")
+
+	flush := func(string, []string, time.Time, *circonusllhist.Histogram) {}
+
+	if _, err := New(0, flush); err == nil {
+		t.Fatal("expected error, zero interval")
+	}
+	if _, err := New(time.Second, nil); err == nil {
+		t.Fatal("expected error, nil flush")
+	}
+	if _, err := New(time.Second, flush); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	t.Log("Testing FromConfig")
+	defer viper.Reset()
+
+	flush := func(string, []string, time.Time, *circonusllhist.Histogram) {}
+
+	t.Log("disabled")
+	{
+		a, _, err := FromConfig(flush)
+		if err != nil || a != nil {
+			t.Fatalf("expected disabled, got %v %v", a, err)
+		}
+		viper.Set(config.KeyHistogramInterval, "0s")
+		a, _, err = FromConfig(flush)
+		if err != nil || a != nil {
+			t.Fatalf("expected disabled, got %v %v", a, err)
+		}
+	}
+
+	t.Log("enabled")
+	{
+		viper.Set(config.KeyHistogramInterval, "10s")
+		viper.Set(config.KeyHistogramQuantiles, "0.5, 0.999")
+		a, qs, err := FromConfig(flush)
+		if err != nil || a == nil {
+			t.Fatalf("expected aggregator, got %v %v", a, err)
+		}
+		if a.interval != 10*time.Second || len(qs) != 2 || qs[1] != 0.999 {
+			t.Fatalf("unexpected settings %s %v", a.interval, qs)
+		}
+	}
+
+	t.Log("invalid quantiles")
+	{
+		viper.Set(config.KeyHistogramQuantiles, "p99")
+		if _, _, err := FromConfig(flush); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	t.Log("Testing Record and Flush")
+
+	var flushed []string
+	a, err := New(time.Hour, func(metric string, tags []string, ts time.Time, hist *circonusllhist.Histogram) {
+		if !ts.IsZero() {
+			metric += "@" + ts.UTC().Format("15:04")
+		}
+		flushed = append(flushed, fmt.Sprintf("%s%v:%d", metric, tags, hist.Count()))
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	a.Record("b", nil, 1, 1)
+	a.Record("a", []string{"x:1", "y:2"}, 1, 1)
+	a.Record("a", []string{"y:2", "x:1"}, 2, 3)
+	a.Record("a", nil, 1, 1)
+	ts := time.Date(2023, time.October, 10, 13, 55, 36, 0, time.UTC)
+	a.RecordWithTime("a", nil, 1, 1, ts)
+	a.RecordWithTime("a", nil, 1, 1, ts.Add(time.Minute))
+	a.RecordWithTime("a", nil, 1, 1, ts.Add(time.Hour))
+
+	a.Flush()
+	expected := "[a[]:1 a@13:00[]:2 a@14:00[]:1 a[x:1 y:2]:4 b[]:1]"
+	if fmt.Sprint(flushed) != expected {
+		t.Fatalf("expected %s, got %v", expected, flushed)
+	}
+
+	t.Log("reset after flush")
+	flushed = nil
+	a.Flush()
+	if len(flushed) != 0 {
+		t.Fatalf("expected nothing flushed, got %v", flushed)
+	}
+
+	t.Log("flushed on stop")
+	a.Start()
+	a.Record("c", nil, 1, 1)
+	a.Stop()
+	if fmt.Sprint(flushed) != "[c[]:1]" {
+		t.Fatalf("expected [c[]:1], got %v", flushed)
+	}
+}
+
+func TestQuantiles(t *testing.T) {
+	t.Log("Testing Quantiles")
+
+	hist := circonusllhist.New()
+	for i := 1; i <= 100; i++ {
+		_ = hist.RecordValue(float64(i))
+	}
+	// values are approximate within their bin (two significant digits)
+	vals := Quantiles(hist, []float64{0, 0.5, 1})
+	if vals[0] != 1 || vals[1] < 50 || vals[1] >= 52 || vals[2] < 100 || vals[2] > 110 {
+		t.Fatalf("unexpected quantiles %v", vals)
+	}
+
+	vals = Quantiles(circonusllhist.New(), []float64{0.5})
+	if !math.IsNaN(vals[0]) {
+		t.Fatalf("expected NaN for empty histogram, got %v", vals)
+	}
+}
+
+func TestQuantileName(t *testing.T) {
+	t.Log("Testing QuantileName")
+
+	tests := map[float64]string{
+		0:     "p0",
+		0.5:   "p50",
+		0.9:   "p90",
+		0.99:  "p99",
+		0.999: "p99.9",
+		1:     "p100",
+	}
+	for q, expected := range tests {
+		if name := QuantileName(q); name != expected {
+			t.Fatalf("%v: expected %s, got %s", q, expected, name)
+		}
+	}
+}
+
+func TestRateCount(t *testing.T) {
+	t.Log("Testing RateCount")
+
+	tests := map[float64]int64{
+		0:    1,
+		1:    1,
+		0.5:  2,
+		0.1:  10,
+		0.3:  3,
+		0.25: 4,
+	}
+	for rate, expected := range tests {
+		if n := RateCount(rate); n != expected {
+			t.Fatalf("%v: expected %d, got %d", rate, expected, n)
+		}
+	}
+}
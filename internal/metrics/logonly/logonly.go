@@ -7,14 +7,19 @@ package logonly
 
 import (
 	"sync"
+	"time"
 
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/llhist"
+	"github.com/openhistogram/circonusllhist"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 // LogOnly defines logging metrics only destination.
 type LogOnly struct {
-	logger zerolog.Logger
+	logger    zerolog.Logger
+	hists     *llhist.Aggregator // nil unless histograms are aggregated
+	quantiles []float64
 }
 
 var (
@@ -24,25 +29,35 @@ var (
 
 // New creates a new log only destination.
 func New() (*LogOnly, error) {
+	var err error
 
 	once.Do(func() {
 		client = &LogOnly{
 			logger: log.With().Str("pkg", "dest-log").Logger(),
 		}
+		client.hists, client.quantiles, err = llhist.FromConfig(client.logHistogram)
 	})
 
+	if err != nil {
+		return nil, err
+	}
+
 	return client, nil
 }
 
-// Start is a NOP for log only destination.
+// Start aggregating histograms, if enabled, otherwise a NOP for log only destination.
 func (c *LogOnly) Start() error {
-	// NOP
+	if c.hists != nil {
+		c.hists.Start()
+	}
 	return nil
 }
 
-// Stop is a NOP for log only destination.
+// Stop logs any aggregated histograms, otherwise a NOP for log only destination.
 func (c *LogOnly) Stop() error {
-	// NOP
+	if c.hists != nil {
+		c.hists.Stop()
+	}
 	return nil
 }
 
@@ -84,24 +99,40 @@ func (c *LogOnly) SetGaugeValueWithTags(metric string, tags []string, value inte
 
 // SetHistogramValue sets a histogram metric to the specified value - type 'h'.
 func (c *LogOnly) SetHistogramValue(metric string, value float64) error { // histogram
+	if c.hists != nil {
+		c.hists.Record(metric, nil, value, 1)
+		return nil
+	}
 	c.logger.Info().Str("name", metric).Interface("value", value).Msg("metric")
 	return nil
 }
 
 // SetHistogramValueWithTags sets a histogram metric to the specified value - type 'h'.
 func (c *LogOnly) SetHistogramValueWithTags(metric string, tags []string, value float64) error { // histogram
+	if c.hists != nil {
+		c.hists.Record(metric, tags, value, 1)
+		return nil
+	}
 	c.logger.Info().Str("name", metric).Strs("tags", tags).Interface("value", value).Msg("metric")
 	return nil
 }
 
 // SetTimingValue sets a timing metric to the specified value - type 'ms'.
 func (c *LogOnly) SetTimingValue(metric string, value float64) error { // histogram
+	if c.hists != nil {
+		c.hists.Record(metric, nil, value, 1)
+		return nil
+	}
 	c.logger.Info().Str("name", metric).Interface("value", value).Msg("metric")
 	return nil
 }
 
 // SetTimingValueWithTags sets a timing metric to the specified value - type 'ms'.
 func (c *LogOnly) SetTimingValueWithTags(metric string, tags []string, value float64) error { // histogram
+	if c.hists != nil {
+		c.hists.Record(metric, tags, value, 1)
+		return nil
+	}
 	c.logger.Info().Str("name", metric).Strs("tags", tags).Interface("value", value).Msg("metric")
 	return nil
 }
@@ -129,3 +160,52 @@ func (c *LogOnly) SetTextValueWithTags(metric string, tags []string, value strin
 	c.logger.Info().Str("name", metric).Strs("tags", tags).Interface("value", value).Msg("metric")
 	return nil
 }
+
+// IncrementCounterByValueWithTagsAndTime sends value to add to counter with an explicit event time - type 'c'.
+func (c *LogOnly) IncrementCounterByValueWithTagsAndTime(metric string, tags []string, value uint64, ts time.Time) error { // counter (monotonically increasing value)
+	c.logger.Info().Str("name", metric).Strs("tags", tags).Interface("value", value).Time("ts", ts).Msg("metric")
+	return nil
+}
+
+// SetGaugeValueWithTagsAndTime sets a gauge metric with an explicit event time - type 'g'.
+func (c *LogOnly) SetGaugeValueWithTagsAndTime(metric string, tags []string, value interface{}, ts time.Time) error { // gauge (ints or floats)
+	c.logger.Info().Str("name", metric).Strs("tags", tags).Interface("value", value).Time("ts", ts).Msg("metric")
+	return nil
+}
+
+// SetHistogramValueWithTagsAndTime sets a histogram metric with an explicit event time - type 'h'.
+func (c *LogOnly) SetHistogramValueWithTagsAndTime(metric string, tags []string, value float64, ts time.Time) error { // histogram
+	if c.hists != nil {
+		c.hists.RecordWithTime(metric, tags, value, 1, ts)
+		return nil
+	}
+	c.logger.Info().Str("name", metric).Strs("tags", tags).Interface("value", value).Time("ts", ts).Msg("metric")
+	return nil
+}
+
+// SetTextValueWithTagsAndTime sets a text metric with an explicit event time - type 't'.
+func (c *LogOnly) SetTextValueWithTagsAndTime(metric string, tags []string, value string, ts time.Time) error { // text metric
+	c.logger.Info().Str("name", metric).Strs("tags", tags).Interface("value", value).Time("ts", ts).Msg("metric")
+	return nil
+}
+
+// logHistogram logs the histogram aggregated for a metric over an interval,
+// with the sample count, quantiles and bins, and the start of the event
+// time interval for values with an event time.
+func (c *LogOnly) logHistogram(metric string, tags []string, ts time.Time, hist *circonusllhist.Histogram) {
+	vals := llhist.Quantiles(hist, c.quantiles)
+	quantiles := zerolog.Dict()
+	for i, q := range c.quantiles {
+		quantiles.Float64(llhist.QuantileName(q), vals[i])
+	}
+	ev := c.logger.Info().
+		Str("name", metric).
+		Strs("tags", tags).
+		Uint64("count", hist.Count()).
+		Dict("quantiles", quantiles).
+		Strs("histogram", hist.DecStrings())
+	if !ts.IsZero() {
+		ev = ev.Time("ts", ts)
+	}
+	ev.Msg("metric")
+}
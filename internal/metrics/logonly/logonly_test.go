@@ -6,8 +6,12 @@
 package logonly
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/llhist"
 	"github.com/rs/zerolog"
 )
 
@@ -203,3 +207,105 @@ func TestSetTextValue(t *testing.T) {
 		t.Fatalf("expected no error, got (%s)", err)
 	}
 }
+
+func TestTimestamped(t *testing.T) {
+	t.Log("Testing *WithTagsAndTime")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	c, err := New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	ts := time.Now().Add(-time.Minute)
+	tags := []string{"foo:bar"}
+
+	if err := c.IncrementCounterByValueWithTagsAndTime("foo", tags, 1, ts); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if err := c.SetGaugeValueWithTagsAndTime("foo", tags, 1, ts); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if err := c.SetHistogramValueWithTagsAndTime("foo", tags, 1.2, ts); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if err := c.SetTextValueWithTagsAndTime("foo", tags, "bar", ts); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+}
+
+func TestHistograms(t *testing.T) {
+	t.Log("Testing aggregated histograms")
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	defer zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	var buf bytes.Buffer
+	c := &LogOnly{logger: zerolog.New(&buf), quantiles: []float64{0.5, 0.99}}
+	hists, err := llhist.New(time.Hour, c.logHistogram)
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	c.hists = hists
+
+	if err := c.Start(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := c.SetTimingValueWithTags("foo", []string{"a:b"}, 25); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing logged before the interval, got %s", buf.String())
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	var entry struct {
+		Name      string             `json:"name"`
+		Tags      []string           `json:"tags"`
+		Count     uint64             `json:"count"`
+		Quantiles map[string]float64 `json:"quantiles"`
+		Histogram []string           `json:"histogram"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected no error, got (%s) %s", err, buf.String())
+	}
+	if entry.Name != "foo" || entry.Count != 3 || len(entry.Tags) != 1 {
+		t.Fatalf("unexpected entry %#v", entry)
+	}
+	if _, ok := entry.Quantiles["p99"]; !ok || len(entry.Quantiles) != 2 {
+		t.Fatalf("expected p50 and p99, got %v", entry.Quantiles)
+	}
+	if len(entry.Histogram) != 1 || entry.Histogram[0] != "H[2.5e+01]=3" {
+		t.Fatalf("expected [H[2.5e+01]=3], got %v", entry.Histogram)
+	}
+
+	t.Log("event time")
+	{
+		buf.Reset()
+		ts := time.Date(2023, time.October, 10, 13, 55, 36, 0, time.UTC)
+		for i := 0; i < 2; i++ {
+			if err := c.SetHistogramValueWithTagsAndTime("bar", nil, 1.5, ts.Add(time.Duration(i)*time.Minute)); err != nil {
+				t.Fatalf("expected no error, got (%s)", err)
+			}
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("expected nothing logged before the interval, got %s", buf.String())
+		}
+		hists.Flush()
+
+		var entry struct {
+			TS    time.Time `json:"ts"`
+			Name  string    `json:"name"`
+			Count uint64    `json:"count"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("expected no error, got (%s) %s", err, buf.String())
+		}
+		if entry.Name != "bar" || entry.Count != 2 || !entry.TS.Equal(ts.Truncate(time.Hour)) {
+			t.Fatalf("unexpected entry %#v", entry)
+		}
+	}
+}
@@ -15,6 +15,8 @@
 //	t - text
 package metrics
 
+import "time"
+
 // Destination defines the interface required by the metric destination.
 type Destination interface {
 	AddSetValue(string, string) error                               // type 's'  - set metric (ala statsd, counts unique values)
@@ -34,3 +36,36 @@ type Destination interface {
 	Start() error
 	Stop() error
 }
+
+// TimestampDestination is implemented by destinations which accept an
+// explicit event time for each sample (e.g. Circonus HTTPTrap `_ts`).
+// Timing metrics are sent as histograms and set metrics as a counter per
+// value, unless it is also a TimestampSetDestination.
+type TimestampDestination interface {
+	IncrementCounterByValueWithTagsAndTime(string, []string, uint64, time.Time) error // type 'c'  - counter
+	SetGaugeValueWithTagsAndTime(string, []string, interface{}, time.Time) error      // type 'g'  - gauge (ints or floats)
+	SetHistogramValueWithTagsAndTime(string, []string, float64, time.Time) error      // type 'h'|'ms' - histogram
+	SetTextValueWithTagsAndTime(string, []string, string, time.Time) error            // type 't'  - text metric
+}
+
+// TimestampSetDestination is implemented by timestamp destinations which
+// count the unique values of a set for each event time (e.g. the backfill
+// report), set metrics are then not sent as counters.
+type TimestampSetDestination interface {
+	AddSetValueWithTagsAndTime(string, []string, string, time.Time) error // type 's'  - set metric
+}
+
+// SampledDestination is implemented by destinations which accept the
+// sample rate of counters and histograms (e.g. StatsD `|@0.1`), values
+// from sampled lines are then scaled up by the receiver.
+type SampledDestination interface {
+	IncrementCounterByValueWithTagsAndRate(string, []string, uint64, float64) error // type 'c'  - counter
+	SetHistogramValueWithTagsAndRate(string, []string, float64, float64) error      // type 'h'|'ms' - histogram
+}
+
+// HealthDestination is implemented by destinations which can tell whether
+// metrics are being delivered. Health returns nil if they are, otherwise
+// the most recent error and when the destination started failing.
+type HealthDestination interface {
+	Health() (time.Time, error)
+}
@@ -0,0 +1,347 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// Package report provides a destination which aggregates metrics into
+// time buckets and writes a JSON or CSV report when stopped.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Report defines the report destination.
+type Report struct {
+	w       io.Writer
+	series  map[string]*sample
+	format  string
+	bucket  time.Duration
+	stopped bool
+	sync.Mutex
+}
+
+type sample struct {
+	ts    time.Time
+	uniq  map[string]struct{}
+	name  string
+	mtype string
+	text  string
+	tags  []string
+	count uint64
+	sum   float64
+	min   float64
+	max   float64
+	last  float64
+}
+
+// Row is a single metric for a single time bucket in the report.
+//
+// Value is the counter total, last gauge value, histogram mean, number
+// of unique set values or last text value. Count, Min and Max are only
+// set for histograms.
+type Row struct {
+	Value interface{} `json:"value"`
+	Time  string      `json:"time,omitempty"`
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Tags  []string    `json:"tags,omitempty"`
+	Count uint64      `json:"count,omitempty"`
+	Min   float64     `json:"min,omitempty"`
+	Max   float64     `json:"max,omitempty"`
+}
+
+const (
+	// FormatJSON writes the report as a JSON array of rows.
+	FormatJSON = "json"
+	// FormatCSV writes the report as CSV with a header row.
+	FormatCSV = "csv"
+)
+
+// New creates a new report destination, metrics are aggregated into
+// buckets of the given size and the report is written to w by Stop.
+func New(w io.Writer, format string, bucket time.Duration) (*Report, error) {
+	if w == nil {
+		return nil, errors.New("invalid writer (nil)")
+	}
+	switch format {
+	case FormatJSON, FormatCSV:
+	default:
+		return nil, fmt.Errorf("unknown report format (%s)", format)
+	}
+	if bucket <= 0 {
+		return nil, fmt.Errorf("invalid bucket size (%s)", bucket)
+	}
+	return &Report{
+		w:      w,
+		format: format,
+		bucket: bucket,
+		series: make(map[string]*sample),
+	}, nil
+}
+
+// Start is a NOP for the report destination.
+func (r *Report) Start() error {
+	// NOP
+	return nil
+}
+
+// Stop writes the report, subsequent calls are a NOP.
+func (r *Report) Stop() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.stopped {
+		return nil
+	}
+	r.stopped = true
+	rows := r.rows()
+	if r.format == FormatCSV {
+		return writeCSV(r.w, rows)
+	}
+	enc := json.NewEncoder(r.w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rows); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
+
+// IncrementCounter increments a counter - type 'c'.
+func (r *Report) IncrementCounter(metric string) error {
+	return r.IncrementCounterByValueWithTagsAndTime(metric, nil, 1, time.Time{})
+}
+
+// IncrementCounterWithTags increments a counter - type 'c'.
+func (r *Report) IncrementCounterWithTags(metric string, tags []string) error {
+	return r.IncrementCounterByValueWithTagsAndTime(metric, tags, 1, time.Time{})
+}
+
+// IncrementCounterByValue adds value to a counter - type 'c'.
+func (r *Report) IncrementCounterByValue(metric string, value uint64) error {
+	return r.IncrementCounterByValueWithTagsAndTime(metric, nil, value, time.Time{})
+}
+
+// IncrementCounterByValueWithTags adds value to a counter - type 'c'.
+func (r *Report) IncrementCounterByValueWithTags(metric string, tags []string, value uint64) error {
+	return r.IncrementCounterByValueWithTagsAndTime(metric, tags, value, time.Time{})
+}
+
+// IncrementCounterByValueWithTagsAndTime adds value to the counter for the bucket containing ts.
+func (r *Report) IncrementCounterByValueWithTagsAndTime(metric string, tags []string, value uint64, ts time.Time) error {
+	r.record("c", metric, tags, ts, func(s *sample) {
+		s.count += value
+	})
+	return nil
+}
+
+// SetGaugeValue sets a gauge - type 'g'.
+func (r *Report) SetGaugeValue(metric string, value interface{}) error {
+	return r.SetGaugeValueWithTagsAndTime(metric, nil, value, time.Time{})
+}
+
+// SetGaugeValueWithTags sets a gauge - type 'g'.
+func (r *Report) SetGaugeValueWithTags(metric string, tags []string, value interface{}) error {
+	return r.SetGaugeValueWithTagsAndTime(metric, tags, value, time.Time{})
+}
+
+// SetGaugeValueWithTagsAndTime sets the gauge for the bucket containing ts.
+func (r *Report) SetGaugeValueWithTagsAndTime(metric string, tags []string, value interface{}, ts time.Time) error {
+	v, err := toFloat(value)
+	if err != nil {
+		return err
+	}
+	r.record("g", metric, tags, ts, func(s *sample) {
+		s.last = v
+	})
+	return nil
+}
+
+// SetHistogramValue adds a sample to a histogram - type 'h'.
+func (r *Report) SetHistogramValue(metric string, value float64) error {
+	return r.SetHistogramValueWithTagsAndTime(metric, nil, value, time.Time{})
+}
+
+// SetHistogramValueWithTags adds a sample to a histogram - type 'h'.
+func (r *Report) SetHistogramValueWithTags(metric string, tags []string, value float64) error {
+	return r.SetHistogramValueWithTagsAndTime(metric, tags, value, time.Time{})
+}
+
+// SetTimingValue adds a sample to a histogram - type 'ms'.
+func (r *Report) SetTimingValue(metric string, value float64) error {
+	return r.SetHistogramValueWithTagsAndTime(metric, nil, value, time.Time{})
+}
+
+// SetTimingValueWithTags adds a sample to a histogram - type 'ms'.
+func (r *Report) SetTimingValueWithTags(metric string, tags []string, value float64) error {
+	return r.SetHistogramValueWithTagsAndTime(metric, tags, value, time.Time{})
+}
+
+// SetHistogramValueWithTagsAndTime adds a sample to the histogram for the bucket containing ts.
+func (r *Report) SetHistogramValueWithTagsAndTime(metric string, tags []string, value float64, ts time.Time) error {
+	r.record("h", metric, tags, ts, func(s *sample) {
+		if s.count == 0 || value < s.min {
+			s.min = value
+		}
+		if s.count == 0 || value > s.max {
+			s.max = value
+		}
+		s.count++
+		s.sum += value
+	})
+	return nil
+}
+
+// AddSetValue adds a unique value to a set - type 's'.
+func (r *Report) AddSetValue(metric, value string) error {
+	return r.AddSetValueWithTags(metric, nil, value)
+}
+
+// AddSetValueWithTags adds a unique value to a set - type 's'.
+func (r *Report) AddSetValueWithTags(metric string, tags []string, value string) error {
+	return r.AddSetValueWithTagsAndTime(metric, tags, value, time.Time{})
+}
+
+// AddSetValueWithTagsAndTime adds a unique value to the set for the bucket containing ts.
+func (r *Report) AddSetValueWithTagsAndTime(metric string, tags []string, value string, ts time.Time) error {
+	r.record("s", metric, tags, ts, func(s *sample) {
+		if s.uniq == nil {
+			s.uniq = make(map[string]struct{})
+		}
+		s.uniq[value] = struct{}{}
+	})
+	return nil
+}
+
+// SetTextValue sets a text metric - type 't'.
+func (r *Report) SetTextValue(metric, value string) error {
+	return r.SetTextValueWithTagsAndTime(metric, nil, value, time.Time{})
+}
+
+// SetTextValueWithTags sets a text metric - type 't'.
+func (r *Report) SetTextValueWithTags(metric string, tags []string, value string) error {
+	return r.SetTextValueWithTagsAndTime(metric, tags, value, time.Time{})
+}
+
+// SetTextValueWithTagsAndTime sets the text metric for the bucket containing ts.
+func (r *Report) SetTextValueWithTagsAndTime(metric string, tags []string, value string, ts time.Time) error {
+	r.record("t", metric, tags, ts, func(s *sample) {
+		s.text = value
+	})
+	return nil
+}
+
+// record applies fn to the sample for the metric in the bucket containing ts,
+// metrics without a time are collected in a single bucket with no time.
+func (r *Report) record(mtype, metric string, tags []string, ts time.Time, fn func(*sample)) {
+	if !ts.IsZero() {
+		ts = ts.Truncate(r.bucket)
+	}
+	key := strconv.FormatInt(ts.UnixNano(), 10) + "|" + mtype + "|" + metric + "|" + strings.Join(tags, ",")
+
+	r.Lock()
+	defer r.Unlock()
+	s, ok := r.series[key]
+	if !ok {
+		s = &sample{ts: ts, name: metric, mtype: mtype, tags: tags}
+		r.series[key] = s
+	}
+	fn(s)
+}
+
+// rows returns the report rows ordered by time, name and tags, r must be locked.
+func (r *Report) rows() []Row {
+	samples := make([]*sample, 0, len(r.series))
+	for _, s := range r.series {
+		samples = append(samples, s)
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		a, b := samples[i], samples[j]
+		if !a.ts.Equal(b.ts) {
+			return a.ts.Before(b.ts)
+		}
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		return strings.Join(a.tags, ",") < strings.Join(b.tags, ",")
+	})
+
+	rows := make([]Row, 0, len(samples))
+	for _, s := range samples {
+		row := Row{Name: s.name, Type: s.mtype, Tags: s.tags}
+		if !s.ts.IsZero() {
+			row.Time = s.ts.UTC().Format(time.RFC3339)
+		}
+		switch s.mtype {
+		case "c":
+			row.Value = s.count
+		case "g":
+			row.Value = s.last
+		case "h":
+			row.Value = s.sum / float64(s.count)
+			row.Count = s.count
+			row.Min = s.min
+			row.Max = s.max
+		case "s":
+			row.Value = len(s.uniq)
+		case "t":
+			row.Value = s.text
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func writeCSV(w io.Writer, rows []Row) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"time", "name", "type", "tags", "value", "count", "min", "max"}); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	for _, row := range rows {
+		rec := []string{row.Time, row.Name, row.Type, strings.Join(row.Tags, ","), fmt.Sprint(row.Value), "", "", ""}
+		if row.Type == "h" {
+			rec[5] = strconv.FormatUint(row.Count, 10)
+			rec[6] = strconv.FormatFloat(row.Min, 'f', -1, 64)
+			rec[7] = strconv.FormatFloat(row.Max, 'f', -1, 64)
+		}
+		if err := cw.Write(rec); err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return math.NaN(), fmt.Errorf("gauge value (%s): %w", v, err)
+		}
+		return f, nil
+	}
+	return math.NaN(), fmt.Errorf("gauge value (%v) unsupported type %T", value, value)
+}
@@ -0,0 +1,149 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	t.Log("Testing New")
+
+	t.Log("nil writer")
+	{
+		if _, err := New(nil, FormatJSON, time.Minute); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("bad format")
+	{
+		if _, err := New(&bytes.Buffer{}, "xml", time.Minute); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("bad bucket")
+	{
+		if _, err := New(&bytes.Buffer{}, FormatCSV, 0); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("valid")
+	{
+		if _, err := New(&bytes.Buffer{}, FormatJSON, time.Minute); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	t.Log("Testing JSON report")
+
+	var buf bytes.Buffer
+	r, err := New(&buf, FormatJSON, time.Minute)
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	t0 := time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC)
+	tags := []string{"log_id:test"}
+
+	_ = r.IncrementCounterByValueWithTagsAndTime("c", tags, 2, t0.Add(10*time.Second))
+	_ = r.IncrementCounterByValueWithTagsAndTime("c", tags, 3, t0.Add(50*time.Second))
+	_ = r.IncrementCounterByValueWithTagsAndTime("c", tags, 1, t0.Add(70*time.Second))
+	_ = r.SetHistogramValueWithTagsAndTime("h", tags, 1, t0)
+	_ = r.SetHistogramValueWithTagsAndTime("h", tags, 3, t0.Add(time.Second))
+	if err := r.SetGaugeValueWithTagsAndTime("g", tags, "abc", t0); err == nil {
+		t.Fatal("expected error")
+	}
+	_ = r.SetGaugeValueWithTagsAndTime("g", tags, "1.5", t0)
+	_ = r.AddSetValueWithTags("s", tags, "a")
+	_ = r.AddSetValueWithTags("s", tags, "b")
+	_ = r.AddSetValueWithTags("s", tags, "a")
+	_ = r.AddSetValueWithTagsAndTime("s", tags, "a", t0)
+	_ = r.AddSetValueWithTagsAndTime("s", tags, "a", t0.Add(time.Second))
+	_ = r.AddSetValueWithTagsAndTime("s", tags, "b", t0.Add(70*time.Second))
+
+	if err := r.Stop(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	var rows []Row
+	if err := json.Unmarshal(buf.Bytes(), &rows); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	// untimed bucket sorts first
+	expect := []struct {
+		time  string
+		name  string
+		value float64
+	}{
+		{"", "s", 2},
+		{"2020-01-02T03:04:00Z", "c", 5},
+		{"2020-01-02T03:04:00Z", "g", 1.5},
+		{"2020-01-02T03:04:00Z", "h", 2},
+		{"2020-01-02T03:04:00Z", "s", 1},
+		{"2020-01-02T03:05:00Z", "c", 1},
+		{"2020-01-02T03:05:00Z", "s", 1},
+	}
+	if len(rows) != len(expect) {
+		t.Fatalf("expected %d rows, got %d (%s)", len(expect), len(rows), buf.String())
+	}
+	for i, e := range expect {
+		if rows[i].Time != e.time || rows[i].Name != e.name || rows[i].Value.(float64) != e.value {
+			t.Fatalf("row %d expected %v, got %#v", i, e, rows[i])
+		}
+	}
+	if rows[3].Count != 2 || rows[3].Min != 1 || rows[3].Max != 3 {
+		t.Fatalf("expected count 2 min 1 max 3, got %#v", rows[3])
+	}
+
+	t.Log("second stop")
+	{
+		n := buf.Len()
+		if err := r.Stop(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if buf.Len() != n {
+			t.Fatal("expected report to be written once")
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	t.Log("Testing CSV report")
+
+	var buf bytes.Buffer
+	r, err := New(&buf, FormatCSV, time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	t0 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	_ = r.SetTimingValueWithTags("t", []string{"a:b", "c:d"}, 5)
+	_ = r.IncrementCounterByValueWithTagsAndTime("c", []string{"a:b"}, 1, t0)
+
+	if err := r.Stop(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	expect := strings.Join([]string{
+		"time,name,type,tags,value,count,min,max",
+		`,t,h,"a:b,c:d",5,1,5,5`,
+		"2020-01-02T03:00:00Z,c,c,a:b,1,,,",
+		"",
+	}, "\n")
+	if buf.String() != expect {
+		t.Fatalf("expected\n%s\ngot\n%s", expect, buf.String())
+	}
+}
@@ -12,11 +12,14 @@ import (
 	"math/big"
 	"math/rand"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/llhist"
+	"github.com/openhistogram/circonusllhist"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
@@ -24,11 +27,16 @@ import (
 
 // Statsd defines the relevant properties of a StatsD connection.
 type Statsd struct {
-	logger zerolog.Logger
-	conn   net.Conn
-	id     string
-	port   string
-	prefix string
+	logger       zerolog.Logger
+	conn         net.Conn
+	lastErr      error
+	failingSince time.Time
+	hists        *llhist.Aggregator // nil unless histograms are aggregated
+	quantiles    []float64
+	id           string
+	port         string
+	prefix       string
+	healthMu     sync.Mutex
 }
 
 var (
@@ -57,6 +65,7 @@ func New() (*Statsd, error) {
 		return nil, fmt.Errorf("invalid port, empty")
 	}
 
+	var err error
 	once.Do(func() {
 		client = &Statsd{
 			id:     id,
@@ -64,18 +73,32 @@ func New() (*Statsd, error) {
 			prefix: viper.GetString(config.KeyDestCfgStatsdPrefix) + id + "`",
 			logger: log.With().Str("pkg", "dest-statsd").Logger(),
 		}
+		client.hists, client.quantiles, err = llhist.FromConfig(client.sendHistogram)
 	})
 
+	if err != nil {
+		return nil, err
+	}
+
 	return client, nil
 }
 
 // Start the statsd Statsd.
 func (c *Statsd) Start() error {
-	return c.open()
+	if err := c.open(); err != nil {
+		return err
+	}
+	if c.hists != nil {
+		c.hists.Start()
+	}
+	return nil
 }
 
-// Stop the statsd Statsd.
+// Stop the statsd Statsd, sending any aggregated histograms.
 func (c *Statsd) Stop() error {
+	if c.hists != nil {
+		c.hists.Stop()
+	}
 	if c.conn == nil {
 		return nil
 	}
@@ -112,14 +135,32 @@ func (c *Statsd) SetTimingValueWithTags(metric string, tags []string, value floa
 
 // SetHistogramValue sends a histogram metric.
 func (c *Statsd) SetHistogramValue(metric string, value float64) error { // histogram
+	if c.hists != nil {
+		c.hists.Record(metric, nil, value, 1)
+		return nil
+	}
 	return c.send(fmt.Sprintf("%s:%e|ms", metric, value))
 }
 
 // SetHistogramValueWithTags sends a histogram metric.
 func (c *Statsd) SetHistogramValueWithTags(metric string, tags []string, value float64) error { // histogram
+	if c.hists != nil {
+		c.hists.Record(metric, tags, value, 1)
+		return nil
+	}
 	return c.send(fmt.Sprintf("%s:%e|ms|#%s", metric, value, strings.Join(tags, ",")))
 }
 
+// SetHistogramValueWithTagsAndRate sends a histogram metric, from a sample of
+// rate (0-1] of the events.
+func (c *Statsd) SetHistogramValueWithTagsAndRate(metric string, tags []string, value, rate float64) error { // histogram
+	if c.hists != nil {
+		c.hists.Record(metric, tags, value, llhist.RateCount(rate))
+		return nil
+	}
+	return c.send(fmt.Sprintf("%s:%e|ms|@%s|#%s", metric, value, sampleRate(rate), strings.Join(tags, ",")))
+}
+
 // IncrementCounter sends a counter increment.
 func (c *Statsd) IncrementCounter(metric string) error { // counter (monotonically increasing value)
 	return c.IncrementCounterByValue(metric, 1)
@@ -140,6 +181,12 @@ func (c *Statsd) IncrementCounterByValueWithTags(metric string, tags []string, v
 	return c.send(fmt.Sprintf("%s:%d|c|#%s", metric, value, strings.Join(tags, ",")))
 }
 
+// IncrementCounterByValueWithTagsAndRate sends value to add to counter, from a
+// sample of rate (0-1] of the events.
+func (c *Statsd) IncrementCounterByValueWithTagsAndRate(metric string, tags []string, value uint64, rate float64) error { // counter (monotonically increasing value)
+	return c.send(fmt.Sprintf("%s:%d|c|@%s|#%s", metric, value, sampleRate(rate), strings.Join(tags, ",")))
+}
+
 // AddSetValue sends a unique value to the set metric.
 func (c *Statsd) AddSetValue(metric string, value string) error { // set metric (ala statsd, counts unique values)
 	return c.send(fmt.Sprintf("%s:%s|s", metric, value))
@@ -160,16 +207,38 @@ func (c *Statsd) SetTextValueWithTags(metric string, tags []string, value string
 	return c.send(fmt.Sprintf("%s:%s|t|#%s", metric, value, strings.Join(tags, ",")))
 }
 
+// sendHistogram sends the histogram aggregated for a metric over an
+// interval, as a counter of the values (metric`count) and a gauge for
+// each quantile (e.g. metric`p99).
+func (c *Statsd) sendHistogram(metric string, tags []string, _ time.Time, hist *circonusllhist.Histogram) {
+	suffix := ""
+	if len(tags) > 0 {
+		suffix = "|#" + strings.Join(tags, ",")
+	}
+	if err := c.send(fmt.Sprintf("%s`count:%d|c%s", metric, hist.Count(), suffix)); err != nil {
+		c.logger.Warn().Err(err).Str("metric", metric).Msg("sending histogram")
+		return
+	}
+	vals := llhist.Quantiles(hist, c.quantiles)
+	for i, q := range c.quantiles {
+		if err := c.send(fmt.Sprintf("%s`%s:%e|g%s", metric, llhist.QuantileName(q), vals[i], suffix)); err != nil {
+			c.logger.Warn().Err(err).Str("metric", metric).Msg("sending histogram")
+			return
+		}
+	}
+}
+
 // send stats data to udp statsd daemon
 //
 // Outgoing metric format:
 //
-//	name:value|type[|#tags]
+//	name:value|type[|@rate][|#tags]
 //
 // e.g.
 //
 //	foo:1|c
 //	foo:1|c|#foo:bar
+//	foo:1|c|@0.1|#foo:bar
 //	bar:2.5|ms
 //	bar:2.5|ms|#foo:bar,baz:qux
 //	baz:25|g
@@ -179,6 +248,7 @@ func (c *Statsd) SetTextValueWithTags(metric string, tags []string, value string
 func (c *Statsd) send(metric string) error {
 	if c.conn == nil {
 		if err := c.open(); err != nil {
+			c.record(err)
 			return err
 		}
 	}
@@ -188,6 +258,7 @@ func (c *Statsd) send(metric string) error {
 	c.logger.Debug().Str("metric", m).Msg("sending")
 
 	_, err := fmt.Fprint(c.conn, m)
+	c.record(err)
 	if err != nil {
 		return err
 	}
@@ -195,6 +266,29 @@ func (c *Statsd) send(metric string) error {
 	return nil
 }
 
+// record the result of sending a metric for Health.
+func (c *Statsd) record(err error) {
+	c.healthMu.Lock()
+	defer c.healthMu.Unlock()
+	if err == nil {
+		c.lastErr = nil
+		c.failingSince = time.Time{}
+		return
+	}
+	if c.lastErr == nil {
+		c.failingSince = time.Now()
+	}
+	c.lastErr = err
+}
+
+// Health returns the last send error and when sends started failing, nil
+// if the last metric was sent.
+func (c *Statsd) Health() (time.Time, error) {
+	c.healthMu.Lock()
+	defer c.healthMu.Unlock()
+	return c.failingSince, c.lastErr
+}
+
 // open udp connection.
 func (c *Statsd) open() error {
 	if c.conn != nil {
@@ -244,3 +338,8 @@ func getGaugeValue(value interface{}) (string, error) {
 	}
 	return vs, nil
 }
+
+// sampleRate formats a sample rate.
+func sampleRate(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', -1, 64)
+}
@@ -6,10 +6,14 @@
 package statsd
 
 import (
+	"errors"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/circonus-labs/circonus-logwatch/internal/config"
 	"github.com/circonus-labs/circonus-logwatch/internal/config/defaults"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/llhist"
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
 )
@@ -344,3 +348,133 @@ func TestGetGaugeValue(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestHealth(t *testing.T) {
+	t.Log("Testing Health")
+
+	c := &Statsd{}
+
+	t.Log("healthy")
+	{
+		if _, err := c.Health(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+	}
+
+	t.Log("failing")
+	{
+		c.record(errors.New("connection refused"))
+		since, err := c.Health()
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		c.record(errors.New("connection refused"))
+		if again, _ := c.Health(); !again.Equal(since) {
+			t.Fatalf("expected failing since %s, got %s", since, again)
+		}
+	}
+
+	t.Log("recovered")
+	{
+		c.record(nil)
+		if since, err := c.Health(); err != nil || !since.IsZero() {
+			t.Fatalf("expected no error, got (%s) since %s", err, since)
+		}
+	}
+}
+
+func TestSampled(t *testing.T) {
+	t.Log("Testing sampled counters and histograms")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	defer pc.Close()
+	_, port, _ := net.SplitHostPort(pc.LocalAddr().String())
+
+	c := &Statsd{port: port, prefix: "foo`"}
+	if err := c.Start(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	defer c.Stop()
+
+	read := func() string {
+		buf := make([]byte, 512)
+		_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		return string(buf[:n])
+	}
+
+	if err := c.IncrementCounterByValueWithTagsAndRate("bar", []string{"a:b"}, 1, 0.1); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if got := read(); got != "foo`bar:1|c|@0.1|#a:b" {
+		t.Fatalf("unexpected %q", got)
+	}
+
+	if err := c.SetHistogramValueWithTagsAndRate("baz", []string{"a:b"}, 2.5, 0.25); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if got := read(); got != "foo`baz:2.500000e+00|ms|@0.25|#a:b" {
+		t.Fatalf("unexpected %q", got)
+	}
+}
+
+func TestHistograms(t *testing.T) {
+	t.Log("Testing aggregated histograms")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	defer pc.Close()
+	_, port, _ := net.SplitHostPort(pc.LocalAddr().String())
+
+	c := &Statsd{port: port, prefix: "foo`", quantiles: []float64{0.5, 0.99}}
+	c.hists, err = llhist.New(time.Hour, c.sendHistogram)
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	read := func() string {
+		buf := make([]byte, 512)
+		_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		return string(buf[:n])
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := c.SetTimingValueWithTags("bar", []string{"a:b"}, 10); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+	}
+	if err := c.SetHistogramValueWithTagsAndRate("bar", []string{"a:b"}, 10, 0.1); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	t.Log("sent on stop")
+	if err := c.Stop(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	for _, expected := range []string{
+		"foo`bar`count:20|c|#a:b",
+		"foo`bar`p50:1.050000e+01|g|#a:b",
+		"foo`bar`p99:1.099000e+01|g|#a:b",
+	} {
+		if got := read(); got != expected {
+			t.Fatalf("expected %q, got %q", expected, got)
+		}
+	}
+}
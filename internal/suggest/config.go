@@ -0,0 +1,94 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package suggest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config formats, as read from the log config directory.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// logConfig is the subset of configs.Config written for a suggestion.
+type logConfig struct {
+	Timestamp *timestamp `json:"timestamp,omitempty" yaml:"timestamp,omitempty" toml:"timestamp,omitempty"`
+	ID        string     `json:"id,omitempty" yaml:"id,omitempty" toml:"id,omitempty"`
+	LogFile   string     `json:"log_file" yaml:"log_file" toml:"log_file"`
+	Metrics   []rule     `json:"metrics" yaml:"metrics" toml:"metrics"`
+}
+
+type timestamp struct {
+	Field  string `json:"field" yaml:"field" toml:"field"`
+	Layout string `json:"layout" yaml:"layout" toml:"layout"`
+}
+
+type rule struct {
+	Match string `json:"match" yaml:"match" toml:"match"`
+	Name  string `json:"name" yaml:"name" toml:"name"`
+	Type  string `json:"type" yaml:"type" toml:"type"`
+}
+
+// logConfig returns a starter log config with one rule using the match.
+// The first duration is used as the Value of a timing (ms) metric,
+// otherwise matching lines are counted. The first timestamp, if any,
+// is used as the event time.
+func (s *Suggestion) logConfig(id, logFile string) logConfig {
+	cfg := logConfig{ID: id, LogFile: logFile}
+	r := rule{Match: s.Match, Name: "lines", Type: "c"}
+
+	for i, f := range s.Fields {
+		if f.Type == TypeDuration && r.Type == "c" {
+			r.Name = f.Name
+			r.Type = "ms"
+			s.Fields[i].Name = "Value"
+			r.Match = strings.Replace(r.Match, "(?P<"+f.Name+">", "(?P<Value>", 1)
+			s.Match = r.Match
+		}
+		if f.Type == TypeTimestamp && cfg.Timestamp == nil {
+			cfg.Timestamp = &timestamp{Field: f.Name, Layout: f.Layout}
+		}
+	}
+
+	cfg.Metrics = []rule{r}
+	return cfg
+}
+
+// Encode writes the starter log config in the given format.
+func (s *Suggestion) Encode(w io.Writer, format string) error {
+	var data []byte
+	var err error
+	switch format {
+	case FormatYAML:
+		data, err = yaml.Marshal(s.config)
+	case FormatJSON:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false) // keep (?P<name>...) readable
+		enc.SetIndent("", "    ")
+		err = enc.Encode(s.config)
+		data = buf.Bytes()
+	case FormatTOML:
+		data, err = toml.Marshal(s.config)
+	default:
+		return fmt.Errorf("unknown format (%s)", format)
+	}
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", format, err)
+	}
+	_, err = w.Write(data)
+	return err
+}
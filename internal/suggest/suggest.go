@@ -0,0 +1,307 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// Package suggest proposes a metric rule match regular expression, and a
+// starter log config, from sample log lines.
+package suggest
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Field types inferred from the sample lines.
+const (
+	TypeIP        = "ip"
+	TypeTimestamp = "timestamp"
+	TypeDuration  = "duration"
+	TypeNumber    = "number"
+	TypePath      = "path"
+	TypeQuoted    = "quoted"
+	TypeWord      = "word"
+)
+
+// token kinds which are not captured.
+const (
+	kindSpace = "space"
+	kindPunct = "punct"
+)
+
+// Field is a captured (named subexpression) field of the suggested match.
+type Field struct {
+	Name    string // subexpression name
+	Type    string // inferred type
+	Example string // value from the first sample line
+	Layout  string // timestamp layout (see configs.Timestamp)
+}
+
+// Suggestion is the suggested match and starter log config.
+type Suggestion struct {
+	Match   string   // regular expression with named subexpressions
+	Fields  []Field  // captured fields, in order
+	Skipped []string // sample lines not matching the structure of the others
+	config  logConfig
+}
+
+type token struct {
+	kind   string
+	text   string // as it appears in the line
+	value  string // captured value (e.g. without surrounding quotes)
+	layout string // timestamp layout
+}
+
+type tokenPattern struct {
+	re     *regexp.Regexp
+	kind   string
+	layout string
+	inner  bool // value is the text without the first and last character
+}
+
+// tokenPatterns are tried, in order, at the start of each token.
+var tokenPatterns = []tokenPattern{
+	{re: regexp.MustCompile(`^\s+`), kind: kindSpace},
+	{re: regexp.MustCompile(`^\[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\]`), kind: TypeTimestamp, layout: "apache", inner: true},
+	{re: regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})`), kind: TypeTimestamp, layout: "rfc3339"},
+	{re: regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?`), kind: TypeTimestamp, layout: "2006-01-02T15:04:05"},
+	{re: regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?`), kind: TypeTimestamp, layout: "2006-01-02 15:04:05"},
+	{re: regexp.MustCompile(`^[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}\b`), kind: TypeTimestamp, layout: "syslog"},
+	{re: regexp.MustCompile(`^"(?:[^"\\]|\\.)*"`), kind: TypeQuoted, inner: true},
+	{re: regexp.MustCompile(`^\d{1,3}(?:\.\d{1,3}){3}\b`), kind: TypeIP},
+	{re: regexp.MustCompile(`^\d+(?:\.\d+)?(?:ns|us|µs|ms|s|m|h)\b`), kind: TypeDuration},
+	{re: regexp.MustCompile(`^-?\d+(?:\.\d+)?\b`), kind: TypeNumber},
+	{re: regexp.MustCompile(`^/[^\s"]*`), kind: TypePath},
+	{re: regexp.MustCompile(`^[^\s=,;:\[\](){}<>|"']+`), kind: TypeWord},
+}
+
+// field regular expressions, captured values exclude the surrounding [] or "".
+var fieldPatterns = map[string]string{
+	TypeIP:       `\d{1,3}(?:\.\d{1,3}){3}`,
+	TypeDuration: `[0-9.]+(?:ns|us|µs|ms|s|m|h)`,
+	TypePath:     `/[^\s"]*`,
+	TypeQuoted:   `(?:[^"\\]|\\.)*`,
+	TypeWord:     `[^\s=,;:\[\](){}<>|"']+`,
+}
+
+var timestampPatterns = map[string]string{
+	"apache":              `\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+	"rfc3339":             `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})`,
+	"2006-01-02T15:04:05": `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?`,
+	"2006-01-02 15:04:05": `\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?`,
+	"syslog":              `[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`,
+}
+
+var nameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// tokenize splits a line into typed tokens.
+func tokenize(line string) []token {
+	var tokens []token
+	for len(line) > 0 {
+		tok := token{kind: kindPunct, text: line[:1], value: line[:1]}
+		for _, tp := range tokenPatterns {
+			if m := tp.re.FindString(line); m != "" {
+				tok = token{kind: tp.kind, text: m, value: m, layout: tp.layout}
+				if tp.inner {
+					tok.value = m[1 : len(m)-1]
+				}
+				break
+			}
+		}
+		if tok.kind == kindPunct {
+			// a single (possibly multi-byte) character
+			r := []rune(line)[0]
+			tok.text = string(r)
+			tok.value = tok.text
+		}
+		tokens = append(tokens, tok)
+		line = line[len(tok.text):]
+	}
+	return tokens
+}
+
+// shape is the structure of a tokenized line, lines with the same shape
+// can be described by one regular expression.
+func shape(tokens []token) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		switch t.kind {
+		case kindSpace:
+			b.WriteByte(' ')
+		case kindPunct:
+			b.WriteString(t.text)
+		case TypeQuoted:
+			b.WriteByte('"')
+		case TypeTimestamp:
+			b.WriteString("t:" + t.layout)
+		default:
+			b.WriteByte('w')
+		}
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// Suggest infers the fields in the sample lines and proposes a match
+// regular expression and a starter log config with one rule. Lines with
+// a different structure to the majority of the samples are skipped.
+func Suggest(lines []string, id, logFile string) (*Suggestion, error) {
+	var samples [][]token
+	var shapes []string
+	counts := map[string]int{}
+	best := ""
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		tokens := tokenize(line)
+		s := shape(tokens)
+		samples = append(samples, tokens)
+		shapes = append(shapes, s)
+		counts[s]++
+		if best == "" || counts[s] > counts[best] {
+			best = s
+		}
+	}
+	if len(samples) == 0 {
+		return nil, errors.New("no sample lines")
+	}
+
+	sug := &Suggestion{}
+	var aligned [][]token
+	var used []string
+	for i, tokens := range samples {
+		if shapes[i] != best {
+			sug.Skipped = append(sug.Skipped, joinTokens(tokens))
+			continue
+		}
+		aligned = append(aligned, tokens)
+		used = append(used, joinTokens(tokens))
+	}
+
+	names := map[string]int{}
+	var b strings.Builder
+	b.WriteByte('^')
+	for pos := range aligned[0] {
+		col := make([]token, len(aligned))
+		for i := range aligned {
+			col[i] = aligned[i][pos]
+		}
+		f, expr := field(col)
+		if f == nil {
+			b.WriteString(expr)
+			continue
+		}
+		f.Name = uniqueName(names, fieldName(aligned[0], pos, f.Type))
+		sug.Fields = append(sug.Fields, *f)
+		b.WriteString(strings.Replace(expr, "(?P<>", "(?P<"+f.Name+">", 1))
+	}
+	sug.Match = b.String()
+
+	re, err := regexp.Compile(sug.Match)
+	if err != nil {
+		return nil, fmt.Errorf("compiling suggested match: %w", err)
+	}
+	for _, line := range used {
+		if !re.MatchString(line) {
+			return nil, fmt.Errorf("suggested match does not match sample line (%s)", line)
+		}
+	}
+
+	sug.config = sug.logConfig(id, logFile)
+
+	return sug, nil
+}
+
+// field returns the field for the tokens at one position in the aligned
+// lines (nil if it is not captured) and its regular expression. Captured
+// fields contain an unnamed `(?P<>` group which is named by the caller.
+func field(col []token) (*Field, string) {
+	kind := col[0].kind
+	same := true
+	mixed := false
+	for _, t := range col[1:] {
+		if t.text != col[0].text {
+			same = false
+		}
+		if t.kind != kind {
+			mixed = true
+		}
+	}
+
+	switch {
+	case kind == kindSpace:
+		return nil, `\s+`
+	case kind == kindPunct:
+		return nil, regexp.QuoteMeta(col[0].text)
+	case kind == TypeWord && same:
+		return nil, regexp.QuoteMeta(col[0].text)
+	case mixed:
+		// e.g. a number in one line and a word in another
+		kind = TypeWord
+	}
+
+	f := &Field{Type: kind, Example: col[0].value, Layout: col[0].layout}
+	switch kind {
+	case TypeTimestamp:
+		expr := "(?P<>" + timestampPatterns[f.Layout] + ")"
+		if f.Layout == "apache" {
+			expr = `\[` + expr + `\]`
+		}
+		return f, expr
+	case TypeQuoted:
+		return f, `"(?P<>` + fieldPatterns[TypeQuoted] + `)"`
+	case TypeNumber:
+		return f, "(?P<>" + numberPattern(col) + ")"
+	}
+	return f, "(?P<>" + fieldPatterns[kind] + ")"
+}
+
+// numberPattern returns the narrowest number expression for the values.
+func numberPattern(col []token) string {
+	neg, frac := false, false
+	for _, t := range col {
+		neg = neg || strings.HasPrefix(t.value, "-")
+		frac = frac || strings.Contains(t.value, ".")
+	}
+	expr := "[0-9]+"
+	if frac {
+		expr += `(?:\.[0-9]+)?`
+	}
+	if neg {
+		expr = "-?" + expr
+	}
+	return expr
+}
+
+// fieldName returns the name for the field at pos: the key if it is the
+// value of a key=value or key:value pair, otherwise its type.
+func fieldName(tokens []token, pos int, fieldType string) string {
+	if pos >= 2 && tokens[pos-1].kind == kindPunct && (tokens[pos-1].text == "=" || tokens[pos-1].text == ":") {
+		key := tokens[pos-2].text
+		if tokens[pos-2].kind == TypeWord && nameRe.MatchString(key) && key != "Value" {
+			return key
+		}
+	}
+	return fieldType
+}
+
+// uniqueName returns name, or name with a numeric suffix if it is in use.
+func uniqueName(names map[string]int, name string) string {
+	names[name]++
+	if names[name] == 1 {
+		return name
+	}
+	return fmt.Sprintf("%s%d", name, names[name])
+}
+
+func joinTokens(tokens []token) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
@@ -0,0 +1,167 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package suggest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+var (
+	apacheLines = []string{
+		`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://ref" "Mozilla/4.08"`,
+		`10.1.2.3 - - [10/Oct/2000:13:55:37 -0700] "POST /api/x HTTP/1.1" 404 12 "-" "curl/7.1"`,
+	}
+	kvLines = []string{
+		`2024-01-02T03:04:05Z level=info msg="request done" path=/api/v1/x status=200 latency=12.5ms`,
+		`2024-01-02T03:04:06Z level=warn msg="slow \"request\"" path=/api/v1/y status=500 latency=1.2s`,
+		`starting up`,
+	}
+)
+
+func TestTokenize(t *testing.T) {
+	t.Log("Testing tokenize")
+
+	tests := []struct {
+		line  string
+		kinds []string
+	}{
+		{`GET /a 200 12ms`, []string{TypeWord, kindSpace, TypePath, kindSpace, TypeNumber, kindSpace, TypeDuration}},
+		{`client=10.1.2.3:5432`, []string{TypeWord, kindPunct, TypeIP, kindPunct, TypeNumber}},
+		{`Jan  2 15:04:05 host x[12]: "a b"`, []string{TypeTimestamp, kindSpace, TypeWord, kindSpace, TypeWord, kindPunct, TypeNumber, kindPunct, kindPunct, kindSpace, TypeQuoted}},
+		{`2024-01-02 03:04:05.123 -1.5 µ`, []string{TypeTimestamp, kindSpace, TypeNumber, kindSpace, TypeWord}},
+	}
+
+	for _, tst := range tests {
+		tokens := tokenize(tst.line)
+		if len(tokens) != len(tst.kinds) {
+			t.Fatalf("%q: expected %d tokens, got %#v", tst.line, len(tst.kinds), tokens)
+		}
+		for i, tok := range tokens {
+			if tok.kind != tst.kinds[i] {
+				t.Fatalf("%q: token %d (%s) expected %s, got %s", tst.line, i, tok.text, tst.kinds[i], tok.kind)
+			}
+		}
+		if joinTokens(tokens) != tst.line {
+			t.Fatalf("%q: tokens do not rejoin, got %q", tst.line, joinTokens(tokens))
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	t.Log("Testing Suggest")
+
+	t.Log("no lines")
+	{
+		if _, err := Suggest([]string{"", "  "}, "", ""); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("apache")
+	{
+		s, err := Suggest(apacheLines, "", "/var/log/access.log")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		expected := []Field{
+			{Name: "ip", Type: TypeIP, Example: "127.0.0.1"},
+			{Name: "word", Type: TypeWord, Example: "frank"},
+			{Name: "timestamp", Type: TypeTimestamp, Example: "10/Oct/2000:13:55:36 -0700", Layout: "apache"},
+			{Name: "quoted", Type: TypeQuoted, Example: "GET /apache_pb.gif HTTP/1.0"},
+			{Name: "number", Type: TypeNumber, Example: "200"},
+			{Name: "number2", Type: TypeNumber, Example: "2326"},
+			{Name: "quoted2", Type: TypeQuoted, Example: "http://ref"},
+			{Name: "quoted3", Type: TypeQuoted, Example: "Mozilla/4.08"},
+		}
+		if len(s.Fields) != len(expected) {
+			t.Fatalf("expected %d fields, got %#v", len(expected), s.Fields)
+		}
+		for i, f := range expected {
+			if s.Fields[i] != f {
+				t.Fatalf("field %d expected %#v, got %#v", i, f, s.Fields[i])
+			}
+		}
+		if s.config.Metrics[0].Type != "c" || s.config.Timestamp == nil || s.config.Timestamp.Layout != "apache" {
+			t.Fatalf("unexpected config %#v", s.config)
+		}
+	}
+
+	t.Log("key=value, with a skipped line")
+	{
+		s, err := Suggest(kvLines, "app", "/var/log/app.log")
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if len(s.Skipped) != 1 || s.Skipped[0] != "starting up" {
+			t.Fatalf("expected 1 skipped line, got %#v", s.Skipped)
+		}
+		names := []string{"timestamp", "level", "msg", "path", "status", "Value"}
+		for i, n := range names {
+			if s.Fields[i].Name != n {
+				t.Fatalf("field %d expected %s, got %#v", i, n, s.Fields[i])
+			}
+		}
+		r := s.config.Metrics[0]
+		if r.Name != "latency" || r.Type != "ms" || r.Match != s.Match {
+			t.Fatalf("unexpected rule %#v", r)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	t.Log("Testing Encode, parsed by configs.Load")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer viper.Reset()
+
+	s, err := Suggest(kvLines, "app", "/var/log/app.log")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if err := s.Encode(&bytes.Buffer{}, "xml"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	for _, format := range []string{FormatYAML, FormatJSON, FormatTOML} {
+		t.Logf("%s", format)
+
+		var buf bytes.Buffer
+		if err := s.Encode(&buf, format); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		dir := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(dir, "app."+format), buf.Bytes(), 0600); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		viper.Set(config.KeyLogConfDir, dir)
+		cfgs, err := configs.Load()
+		if err != nil {
+			t.Fatalf("expected no error, got %s\n%s", err, buf.String())
+		}
+		cfg := cfgs[0]
+		if cfg.ID != "app" || cfg.Timestamp == nil || cfg.Timestamp.Field != "timestamp" {
+			t.Fatalf("unexpected config %#v", cfg)
+		}
+		r := cfg.Metrics[0]
+		if r.Match != s.Match || r.ValueKey != "Value" || r.Type != "ms" {
+			t.Fatalf("unexpected rule %#v", r)
+		}
+		for _, line := range kvLines[:2] {
+			if !r.Matcher.MatchString(line) {
+				t.Fatalf("expected match %q", line)
+			}
+		}
+	}
+}
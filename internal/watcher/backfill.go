@@ -0,0 +1,139 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	backfillBufSize     = 64 * 1024
+	backfillMaxLineSize = 1024 * 1024
+)
+
+// Backfill processes the given files (or the configured log file if none
+// are given) from start to EOF, sending metrics to the destination as
+// they are extracted. Compressed (gzip, bzip2) files are decompressed.
+// The timestamp max_age is not applied when backfilling. Distinct set
+// values are counted, and derived metrics computed, over the whole
+// backfill, derived metrics using rate() are skipped.
+func (w *Watcher) Backfill(files []string) error {
+	w.backfill = true
+	w.backfillDerived()
+	if len(files) == 0 {
+		files = []string{w.cfg.LogFile}
+	}
+	for _, file := range files {
+		if err := w.backfillFile(file); err != nil {
+			return err
+		}
+	}
+	w.flushSets(time.Time{})
+	w.flushDerived(time.Time{})
+	return nil
+}
+
+// backfillFile processes a single file.
+func (w *Watcher) backfillFile(file string) error {
+	r, err := openLog(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	start := time.Now()
+	var lines, matched int
+
+	scanner := w.newScanner(r)
+	for scanner.Scan() {
+		select {
+		case <-w.ctx.Done():
+			return w.ctx.Err()
+		default:
+		}
+		lines++
+		w.lineRead()
+		text, ok := w.decodeLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		for _, ml := range w.matchLine(text) {
+			matched++
+			if m, ok := w.parseLine(ml); ok {
+				w.saveMetric(m)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", file, err)
+	}
+
+	w.logger.Info().
+		Str("file", file).
+		Int("lines", lines).
+		Int("matched", matched).
+		Str("duration", time.Since(start).String()).
+		Msg("backfilled")
+
+	return nil
+}
+
+type logReader struct {
+	io.Reader
+	f    *os.File
+	zstd *zstd.Decoder
+}
+
+func (lr *logReader) Close() error {
+	if lr.zstd != nil {
+		lr.zstd.Close()
+	}
+	return lr.f.Close()
+}
+
+// openLog opens a log file, transparently decompressing gzip, bzip2 and
+// zstd files (detected by content, not extension).
+func openLog(file string) (io.ReadCloser, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening log: %w", err)
+	}
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+
+	lr := &logReader{Reader: br, f: f}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("opening gzip log %s: %w", file, err)
+		}
+		lr.Reader = gz
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		lr.Reader = bzip2.NewReader(br)
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("opening zstd log %s: %w", file, err)
+		}
+		lr.Reader = zr
+		lr.zstd = zr
+	}
+
+	return lr, nil
+}
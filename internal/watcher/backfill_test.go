@@ -0,0 +1,111 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/report"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestBackfill(t *testing.T) {
+	t.Log("Testing Backfill")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyLogConfDir, "testdata")
+	defer viper.Reset()
+	cfgs, err := configs.Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	dir := t.TempDir()
+
+	// 2020-01-02T03:04:05Z, older than the config max_age
+	plain := filepath.Join(dir, "test.log")
+	if err := ioutil.WriteFile(plain, []byte("event 1577934245 1\nnomatch\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	var gzbuf bytes.Buffer
+	gz := gzip.NewWriter(&gzbuf)
+	_, _ = gz.Write([]byte("event 1577934250 5\nevent 1577934365 7\n"))
+	_ = gz.Close()
+	gzFile := filepath.Join(dir, "test.log.1.gz")
+	if err := ioutil.WriteFile(gzFile, gzbuf.Bytes(), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	t.Log("missing file")
+	{
+		dest, err := report.New(&bytes.Buffer{}, report.FormatJSON, time.Minute)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		w, err := New(context.Background(), dest, cfgs[0])
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if err := w.Backfill([]string{filepath.Join(dir, "missing.log")}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("plain, gzip and bzip2")
+	{
+		var buf bytes.Buffer
+		dest, err := report.New(&buf, report.FormatJSON, time.Minute)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		w, err := New(context.Background(), dest, cfgs[0])
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if err := w.Backfill([]string{plain, gzFile, filepath.Join("testdata", "backfill.log.bz2")}); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if err := dest.Stop(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+
+		var rows []report.Row
+		if err := json.Unmarshal(buf.Bytes(), &rows); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+
+		expect := map[string]float64{
+			"counter1@":                  1,
+			"event@2020-01-02T03:04:00Z": 8,
+			"event@2020-01-02T03:05:00Z": 4,
+			"event@2020-01-02T03:06:00Z": 7,
+		}
+		if len(rows) != len(expect) {
+			t.Fatalf("expected %d rows, got %d (%s)", len(expect), len(rows), buf.String())
+		}
+		for _, row := range rows {
+			e, ok := expect[row.Name+"@"+row.Time]
+			if !ok {
+				t.Fatalf("unexpected row %#v", row)
+			}
+			if row.Value.(float64) != e {
+				t.Fatalf("expected %s@%s = %f, got %v", row.Name, row.Time, e, row.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+)
+
+const (
+	// overflowTagValue replaces the value of each field in the rule name
+	// and tags once a rule has reached its max_series limit.
+	overflowTagValue = "__other__"
+
+	// foldedMetricName is the counter emitted for each folded metric.
+	foldedMetricName = "logwatch_series_folded"
+)
+
+// seriesLimiter tracks the distinct name+tag sets produced by a rule
+// and folds new ones into an overflow series once the limit is reached.
+// For a rule with a name or tags template, new names and tags are folded
+// into the ones produced with every field set to __other__.
+type seriesLimiter struct {
+	folded       uint64 // atomic, reported in status
+	seen         map[string]struct{}
+	names        map[string]struct{}
+	overflowName string
+	overflowTags []string
+	max          int
+	limited      bool
+	sync.Mutex
+}
+
+func newSeriesLimiter(maxSeries int, overflowName string, overflowTags []string) *seriesLimiter {
+	return &seriesLimiter{
+		seen:         make(map[string]struct{}),
+		names:        make(map[string]struct{}),
+		overflowName: overflowName,
+		overflowTags: overflowTags,
+		max:          maxSeries,
+	}
+}
+
+// overflowName returns the name of the overflow series of a rule with a
+// name template, empty if the rule name is static.
+func overflowName(rule *configs.Metric) string {
+	if rule.Namer == nil {
+		return ""
+	}
+	var b bytes.Buffer
+	if err := rule.Namer.Execute(&b, overflowFields(rule)); err != nil || b.Len() == 0 {
+		return overflowTagValue
+	}
+	return b.String()
+}
+
+// overflowTags returns the tags of the overflow series of a rule with a
+// tags template, nil if the rule tags are static. Literal tags in the
+// template (e.g. env:prod) are kept.
+func overflowTags(rule *configs.Metric) []string {
+	if rule.Tagger == nil {
+		return nil
+	}
+	var b bytes.Buffer
+	if err := rule.Tagger.Execute(&b, overflowFields(rule)); err != nil {
+		return nil
+	}
+	return strings.Split(b.String(), ",")
+}
+
+// overflowFields returns the template fields of a rule, every one set to
+// __other__.
+func overflowFields(rule *configs.Metric) map[string]string {
+	fields := make(map[string]string)
+	for _, name := range rule.MatchParts {
+		if name != "" {
+			fields[name] = overflowTagValue
+		}
+	}
+	for _, lt := range rule.Lookups {
+		fields[lt.Name] = overflowTagValue
+	}
+	for _, ic := range rule.Classify {
+		for _, name := range ic.Fields() {
+			fields[name] = overflowTagValue
+		}
+	}
+	return fields
+}
+
+// limit returns the name and tags to use for the metric. If the series is
+// new and the limit has been reached, the tags after the fixed tags (the
+// first numFixed) are replaced with the overflow tags, or without them
+// have their values replaced with __other__, and a new name produced by a
+// name template with the overflow name. Static tags should be passed as
+// fixed. folded indicates the series was rewritten, first indicates this
+// is the first time the limit was hit.
+func (sl *seriesLimiter) limit(name string, tags []string, numFixed int) (resultName string, result []string, folded, first bool) {
+	key := seriesKey(name, tags)
+
+	sl.Lock()
+	defer sl.Unlock()
+
+	if _, ok := sl.seen[key]; ok {
+		return name, tags, false, false
+	}
+
+	if len(sl.seen) < sl.max {
+		sl.seen[key] = struct{}{}
+		sl.names[name] = struct{}{}
+		return name, tags, false, false
+	}
+
+	resultName = name
+	if _, ok := sl.names[name]; !ok && sl.overflowName != "" {
+		resultName = sl.overflowName
+	}
+	result = make([]string, numFixed, len(tags))
+	copy(result, tags)
+	if sl.overflowTags != nil && numFixed < len(tags) {
+		result = append(result, sl.overflowTags...)
+	} else {
+		for _, tag := range tags[numFixed:] {
+			if p := strings.Index(tag, ":"); p > 0 {
+				tag = tag[:p+1] + overflowTagValue
+			} else {
+				tag += ":" + overflowTagValue
+			}
+			result = append(result, tag)
+		}
+	}
+
+	atomic.AddUint64(&sl.folded, 1)
+	first = !sl.limited
+	sl.limited = true
+
+	return resultName, result, true, first
+}
+
+// seriesKey returns a key identifying a unique name+tag set, tag order is ignored.
+func seriesKey(name string, tags []string) string {
+	sorted := make([]string, len(tags))
+	copy(sorted, tags)
+	sort.Strings(sorted)
+	return name + "|" + strings.Join(sorted, ",")
+}
@@ -0,0 +1,158 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+)
+
+func TestSeriesLimiter(t *testing.T) {
+	t.Log("Testing seriesLimiter")
+
+	sl := newSeriesLimiter(2, "", nil)
+
+	t.Log("under limit")
+	{
+		for _, path := range []string{"/a", "/b", "/a"} {
+			_, tags, folded, _ := sl.limit("latency", []string{"log_id:test", "path:" + path}, 1)
+			if folded {
+				t.Fatalf("expected %s not folded", path)
+			}
+			if tags[1] != "path:"+path {
+				t.Fatalf("expected path:%s got %s", path, tags[1])
+			}
+		}
+	}
+
+	t.Log("tag order ignored")
+	{
+		_, _, folded, _ := sl.limit("latency", []string{"path:/b", "log_id:test"}, 1)
+		if folded {
+			t.Fatal("expected not folded")
+		}
+	}
+
+	t.Log("over limit")
+	{
+		name, tags, folded, first := sl.limit("latency", []string{"log_id:test", "path:/c", "method"}, 1)
+		if !folded {
+			t.Fatal("expected folded")
+		}
+		if !first {
+			t.Fatal("expected first")
+		}
+		if name != "latency" {
+			t.Fatalf("expected static name kept, got %s", name)
+		}
+		if tags[0] != "log_id:test" {
+			t.Fatalf("expected fixed tag untouched, got %s", tags[0])
+		}
+		if tags[1] != "path:"+overflowTagValue {
+			t.Fatalf("expected path:%s got %s", overflowTagValue, tags[1])
+		}
+		if tags[2] != "method:"+overflowTagValue {
+			t.Fatalf("expected method:%s got %s", overflowTagValue, tags[2])
+		}
+	}
+
+	t.Log("over limit, again")
+	{
+		_, _, folded, first := sl.limit("latency", []string{"log_id:test", "path:/d"}, 1)
+		if !folded {
+			t.Fatal("expected folded")
+		}
+		if first {
+			t.Fatal("expected not first")
+		}
+		if sl.folded != 2 {
+			t.Fatalf("expected 2 folded, got %d", sl.folded)
+		}
+	}
+}
+
+func TestSeriesLimiterNamer(t *testing.T) {
+	t.Log("Testing seriesLimiter with a name template")
+
+	rule := &configs.Metric{
+		Namer:      template.Must(template.New("name").Parse("{{.host}}`{{.path}}`latency")),
+		MatchParts: []string{"", "host", "path"},
+	}
+	if name := overflowName(rule); name != "__other__`__other__`latency" {
+		t.Fatalf("unexpected overflow name %s", name)
+	}
+	if name := overflowName(&configs.Metric{Name: "latency"}); name != "" {
+		t.Fatalf("expected no overflow name for a static name, got %s", name)
+	}
+
+	sl := newSeriesLimiter(2, overflowName(rule), nil)
+	tags := []string{"log_id:test"}
+	for _, name := range []string{"a`/x`latency", "b`/x`latency"} {
+		if _, _, folded, _ := sl.limit(name, tags, 1); folded {
+			t.Fatalf("expected %s not folded", name)
+		}
+	}
+
+	t.Log("new name folded")
+	{
+		name, _, folded, _ := sl.limit("c`/x`latency", tags, 1)
+		if !folded || name != "__other__`__other__`latency" {
+			t.Fatalf("expected folded overflow name, got %s %v", name, folded)
+		}
+	}
+
+	t.Log("known name with new tags keeps its name")
+	{
+		name, tags, folded, _ := sl.limit("a`/x`latency", []string{"log_id:test", "method:GET"}, 1)
+		if !folded || name != "a`/x`latency" || tags[1] != "method:"+overflowTagValue {
+			t.Fatalf("unexpected %s %v %v", name, tags, folded)
+		}
+	}
+}
+
+func TestSeriesLimiterTagger(t *testing.T) {
+	t.Log("Testing seriesLimiter with a tags template")
+
+	rule := &configs.Metric{
+		Tagger:     template.Must(template.New("tags").Parse("env:prod,path:{{.path}}")),
+		MatchParts: []string{"", "path"},
+	}
+	tags := overflowTags(rule)
+	if len(tags) != 2 || tags[0] != "env:prod" || tags[1] != "path:"+overflowTagValue {
+		t.Fatalf("unexpected overflow tags %v", tags)
+	}
+	if tags := overflowTags(&configs.Metric{Tags: "env:prod"}); tags != nil {
+		t.Fatalf("expected no overflow tags for static tags, got %v", tags)
+	}
+
+	sl := newSeriesLimiter(1, "", overflowTags(rule))
+	if _, _, folded, _ := sl.limit("latency", []string{"log_id:test", "env:prod", "path:/a"}, 1); folded {
+		t.Fatal("expected not folded")
+	}
+
+	t.Log("captured values folded, literal tags kept")
+	{
+		_, tags, folded, _ := sl.limit("latency", []string{"log_id:test", "env:prod", "path:/b"}, 1)
+		if !folded {
+			t.Fatal("expected folded")
+		}
+		if len(tags) != 3 || tags[0] != "log_id:test" || tags[1] != "env:prod" || tags[2] != "path:"+overflowTagValue {
+			t.Fatalf("unexpected tags %v", tags)
+		}
+	}
+
+	t.Log("static tags kept")
+	{
+		sl := newSeriesLimiter(1, "", nil)
+		_, _, _, _ = sl.limit("a", []string{"log_id:test", "env:prod"}, 2)
+		name, tags, folded, _ := sl.limit("b", []string{"log_id:test", "env:prod"}, 2)
+		if !folded || name != "b" || tags[1] != "env:prod" {
+			t.Fatalf("unexpected %s %v %v", name, tags, folded)
+		}
+	}
+}
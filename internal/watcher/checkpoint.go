@@ -0,0 +1,217 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/nxadm/tail"
+)
+
+// checkpoint records how far into a log file lines have been read.
+// The file is identified by a fingerprint of its leading bytes, which,
+// unlike an inode, survives the file being rotated and compressed.
+type checkpoint struct {
+	Fingerprint    string `json:"fingerprint"`
+	Offset         int64  `json:"offset"`
+	FingerprintLen int    `json:"fingerprint_len"`
+}
+
+const (
+	fingerprintSize = 1024
+	// maxRotations is the number of rotated files (e.g. log.1 .. log.N)
+	// checked for a checkpointed file.
+	maxRotations = 10
+)
+
+// rotatedExts are the suffixes checked, in order, for each rotated file.
+var rotatedExts = []string{"", ".gz", ".bz2", ".zst"}
+
+// fingerprint returns the hash of the first n bytes of the file, or of the
+// first fingerprintSize bytes (or fewer, if the file is smaller) if n is 0.
+func fingerprint(file string, n int) (string, int, error) {
+	r, err := openLog(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer r.Close()
+
+	size := n
+	if size == 0 {
+		size = fingerprintSize
+	}
+	buf := make([]byte, size)
+	got, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", 0, fmt.Errorf("fingerprint %s: %w", file, err)
+	}
+	if n > 0 && got < n {
+		return "", got, nil // too short to be the checkpointed file
+	}
+	sum := sha256.Sum256(buf[:got])
+	return hex.EncodeToString(sum[:]), got, nil
+}
+
+// loadCheckpoint reads the checkpoint for the log, nil if there is none.
+func (w *Watcher) loadCheckpoint() (*checkpoint, error) {
+	data, err := ioutil.ReadFile(w.stateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading checkpoint: %w", err)
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("parsing checkpoint (%s): %w", w.stateFile, err)
+	}
+	return &cp, nil
+}
+
+// saveCheckpoint records the offset of the last line read from the live log.
+func (w *Watcher) saveCheckpoint(offset int64) error {
+	fp, n, err := fingerprint(w.cfg.LogFile, 0)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil // empty file, nothing to record
+	}
+	data, err := json.Marshal(checkpoint{Fingerprint: fp, FingerprintLen: n, Offset: offset})
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+	tmp := w.stateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, w.stateFile); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// rotationChain returns the live log followed by the rotated files which
+// exist, newest first (e.g. log, log.1, log.2.gz, ...).
+func rotationChain(logFile string) []string {
+	chain := []string{logFile}
+	for i := 1; i <= maxRotations; i++ {
+		base := logFile + "." + strconv.Itoa(i)
+		for _, ext := range rotatedExts {
+			if _, err := os.Stat(base + ext); err == nil {
+				chain = append(chain, base+ext)
+				break
+			}
+		}
+	}
+	return chain
+}
+
+// resume locates the checkpointed file in the rotation chain, processes
+// any unread lines in rotated files and returns where tailing of the live
+// log should start. nil is returned when tailing should start at the end
+// of the live log (no checkpoint, or the checkpointed file was not found).
+func (w *Watcher) resume() *tail.SeekInfo {
+	cp, err := w.loadCheckpoint()
+	if err != nil {
+		w.logger.Warn().Err(err).Msg("ignoring checkpoint")
+		return nil
+	}
+	if cp == nil {
+		return nil
+	}
+
+	chain := rotationChain(w.cfg.LogFile)
+	found := -1
+	for i, file := range chain {
+		fp, _, err := fingerprint(file, cp.FingerprintLen)
+		if err != nil {
+			continue
+		}
+		if fp == cp.Fingerprint {
+			found = i
+			break
+		}
+	}
+
+	switch {
+	case found < 0:
+		w.logger.Warn().Msg("checkpointed file not found in rotation chain, starting at end of log")
+		return nil
+	case found == 0:
+		fi, err := os.Stat(w.cfg.LogFile)
+		if err != nil || fi.Size() < cp.Offset {
+			w.logger.Info().Msg("log truncated since checkpoint, starting at beginning of log")
+			return &tail.SeekInfo{Offset: 0, Whence: io.SeekStart}
+		}
+		w.logger.Info().Int64("offset", cp.Offset).Msg("resuming from checkpoint")
+		return &tail.SeekInfo{Offset: cp.Offset, Whence: io.SeekStart}
+	}
+
+	// the checkpointed file has been rotated, finish it then read any
+	// newer rotated files before starting at the beginning of the live log
+	offset := cp.Offset
+	for i := found; i > 0; i-- {
+		if err := w.catchUp(chain[i], offset); err != nil {
+			if w.groupCtx.Err() != nil {
+				return nil
+			}
+			w.logger.Warn().Err(err).Str("file", chain[i]).Msg("catching up rotated log")
+		}
+		offset = 0
+	}
+	return &tail.SeekInfo{Offset: 0, Whence: io.SeekStart}
+}
+
+// catchUp processes the lines in a (possibly compressed) rotated file
+// starting at offset (in uncompressed bytes).
+func (w *Watcher) catchUp(file string, offset int64) error {
+	r, err := openLog(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if offset > 0 {
+		if _, err := io.CopyN(ioutil.Discard, r, offset); err != nil {
+			return fmt.Errorf("seeking to checkpoint: %w", err)
+		}
+	}
+
+	var lines int
+	scanner := w.newScanner(r)
+	for scanner.Scan() {
+		lines++
+		w.lineRead()
+		text, ok := w.decodeLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if !w.dispatch(text) {
+			return w.groupCtx.Err()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", file, err)
+	}
+
+	w.logger.Info().
+		Str("file", filepath.Base(file)).
+		Int64("offset", offset).
+		Int("lines", lines).
+		Msg("caught up rotated log")
+
+	return nil
+}
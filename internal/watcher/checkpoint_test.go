@@ -0,0 +1,145 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestRotationChain(t *testing.T) {
+	t.Log("Testing rotationChain")
+
+	dir := t.TempDir()
+	live := filepath.Join(dir, "access_log")
+	for _, f := range []string{"access_log", "access_log.1", "access_log.2.gz", "access_log.3.zst", "access_log.5.gz"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte("x\n"), 0600); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+	}
+
+	chain := rotationChain(live)
+	expect := []string{live, live + ".1", live + ".2.gz", live + ".3.zst", live + ".5.gz"}
+	if len(chain) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, chain)
+	}
+	for i := range expect {
+		if chain[i] != expect[i] {
+			t.Fatalf("expected %v, got %v", expect, chain)
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	t.Log("Testing resume")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := t.TempDir()
+	viper.Set(config.KeyLogConfDir, "testdata")
+	viper.Set(config.KeyStateDir, dir)
+	defer viper.Reset()
+
+	cfgs, err := configs.Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	cfg := *cfgs[0]
+	cfg.LogFile = filepath.Join(dir, "access_log")
+
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	newWatcher := func() *Watcher {
+		w, err := New(context.Background(), dest, &cfg)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		return w
+	}
+
+	t.Log("no checkpoint")
+	{
+		w := newWatcher()
+		if loc := w.resume(); loc != nil {
+			t.Fatalf("expected nil, got %#v", loc)
+		}
+	}
+
+	old := "testcounter 1\ntestcounter 2\ntestcounter 3\n"
+	if err := ioutil.WriteFile(cfg.LogFile, []byte(old), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	t.Log("live log")
+	{
+		w := newWatcher()
+		if err := w.saveCheckpoint(14); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		loc := w.resume()
+		if loc == nil {
+			t.Fatal("expected location")
+		}
+		if loc.Offset != 14 || loc.Whence != io.SeekStart {
+			t.Fatalf("expected offset 14 from start, got %#v", loc)
+		}
+	}
+
+	t.Log("rotated and compressed")
+	{
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, _ = gz.Write([]byte(old))
+		_ = gz.Close()
+		if err := ioutil.WriteFile(cfg.LogFile+".2.gz", buf.Bytes(), 0600); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if err := ioutil.WriteFile(cfg.LogFile+".1", []byte("testcounter 4\n"), 0600); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if err := ioutil.WriteFile(cfg.LogFile, []byte("testcounter 5\n"), 0600); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		w := newWatcher()
+		loc := w.resume()
+		if loc == nil {
+			t.Fatal("expected location")
+		}
+		if loc.Offset != 0 || loc.Whence != io.SeekStart {
+			t.Fatalf("expected beginning of live log, got %#v", loc)
+		}
+		// two unread lines in .2.gz, one in .1
+		if len(w.metricLines) != 3 {
+			t.Fatalf("expected 3 metric lines, got %d", len(w.metricLines))
+		}
+	}
+
+	t.Log("not found")
+	{
+		if err := ioutil.WriteFile(cfg.LogFile+".2.gz", []byte("other\n"), 0600); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		w := newWatcher()
+		if loc := w.resume(); loc != nil {
+			t.Fatalf("expected nil, got %#v", loc)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+)
+
+// derivedReportInterval is how often derived metrics are checked for
+// the end of their interval.
+const derivedReportInterval = time.Second
+
+// derivedWindow holds the totals of the rules referenced by a derived
+// metric for the current interval.
+type derivedWindow struct {
+	start  time.Time
+	def    *configs.Derived
+	totals map[string]float64
+	tags   []string
+}
+
+// newDerived returns the windows of the derived metrics in the log config
+// and, for each rule, the windows referencing it. Both are nil if there
+// are no derived metrics.
+func newDerived(cfg *configs.Config, start time.Time) ([]*derivedWindow, [][]*derivedWindow) {
+	if len(cfg.Derived) == 0 {
+		return nil, nil
+	}
+	windows := make([]*derivedWindow, 0, len(cfg.Derived))
+	refs := make([][]*derivedWindow, len(cfg.Metrics))
+	for _, def := range cfg.Derived {
+		dw := &derivedWindow{
+			start:  start,
+			def:    def,
+			totals: make(map[string]float64, len(def.Refs)),
+			tags:   []string{"log_id:" + cfg.ID},
+		}
+		if def.Tags != "" {
+			dw.tags = append(dw.tags, strings.Split(def.Tags, ",")...)
+		}
+		windows = append(windows, dw)
+		for ruleID, rule := range cfg.Metrics {
+			if rule.Namer != nil {
+				continue
+			}
+			for _, ref := range def.Refs {
+				if rule.Name == ref {
+					refs[ruleID] = append(refs[ruleID], dw)
+					break
+				}
+			}
+		}
+	}
+	return windows, refs
+}
+
+// backfillDerived removes the derived metrics using rate(), a backfill
+// is not processed over the time the lines were logged.
+func (w *Watcher) backfillDerived() {
+	if w.derived == nil {
+		return
+	}
+	skip := make(map[*derivedWindow]bool)
+	windows := w.derived[:0]
+	for _, dw := range w.derived {
+		if dw.def.UsesRate() {
+			w.logger.Warn().
+				Str("derived", dw.def.Name).
+				Str("expr", dw.def.Expr).
+				Msg("rate() is not supported by backfill, skipping derived metric")
+			skip[dw] = true
+			continue
+		}
+		windows = append(windows, dw)
+	}
+	if len(skip) == 0 {
+		return
+	}
+	if len(windows) == 0 {
+		w.derived, w.derivedRefs = nil, nil
+		return
+	}
+	w.derived = windows
+	for ruleID, refs := range w.derivedRefs {
+		kept := refs[:0]
+		for _, dw := range refs {
+			if !skip[dw] {
+				kept = append(kept, dw)
+			}
+		}
+		w.derivedRefs[ruleID] = kept
+	}
+}
+
+// recordDerived adds a metric to the totals of the derived metrics
+// referencing its rule. Counters add their increment, other types add
+// one, scaled up when the line was sampled.
+func (w *Watcher) recordDerived(m metric) {
+	refs := w.derivedRefs[m.ruleID]
+	if len(refs) == 0 {
+		return
+	}
+	v := 1.0
+	if m.Type == "c" {
+		n, err := strconv.ParseUint(m.Value, 10, 64)
+		if err != nil {
+			return // reported when the metric is sent
+		}
+		v = float64(n)
+	}
+	if m.sampleRate > 1 {
+		v *= float64(m.sampleRate)
+	}
+	name := w.cfg.Metrics[m.ruleID].Name
+
+	w.derivedMu.Lock()
+	defer w.derivedMu.Unlock()
+
+	for _, dw := range refs {
+		dw.totals[name] += v
+	}
+}
+
+// reportDerived sends the derived metrics whose interval has ended, and
+// all of them when the watcher stops.
+func (w *Watcher) reportDerived() error {
+	ticker := time.NewTicker(derivedReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.groupCtx.Done():
+			w.flushDerived(time.Time{})
+			return nil
+		case now := <-ticker.C:
+			w.flushDerived(now)
+		}
+	}
+}
+
+// flushDerived computes and sends the derived metrics whose interval
+// ended by now, or all of them if now is zero, and starts their next
+// interval.
+func (w *Watcher) flushDerived(now time.Time) {
+	end := now
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	type result struct {
+		dw    *derivedWindow
+		value float64
+		ok    bool
+	}
+	var results []result
+
+	w.derivedMu.Lock()
+	for _, dw := range w.derived {
+		if !now.IsZero() && now.Sub(dw.start) < dw.def.Period() {
+			continue
+		}
+		v, ok := dw.def.Eval(dw.totals, end.Sub(dw.start).Seconds())
+		results = append(results, result{dw: dw, value: v, ok: ok})
+		dw.totals = make(map[string]float64, len(dw.def.Refs))
+		dw.start = end
+	}
+	w.derivedMu.Unlock()
+
+	for _, r := range results {
+		if !r.ok {
+			if w.trace {
+				w.logger.Log().
+					Str("derived", r.dw.def.Name).
+					Str("expr", r.dw.def.Expr).
+					Msg("no value for interval")
+			}
+			continue
+		}
+		_ = w.dest.SetGaugeValueWithTags(r.dw.def.Name, r.dw.tags, r.value)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+const derivedConfig = `id: web
+log_file: /var/log/web.log
+metrics:
+    - match: 'status=5'
+      name: errors
+    - match: 'status='
+      name: requests
+    - match: 'bytes=(?P<Value>[0-9]+)'
+      name: bytes
+      type: c
+derived:
+    - name: error_ratio
+      expr: errors / requests
+      tags: 'team:web'
+    - name: ok_requests
+      expr: requests - errors
+      interval: 10s
+    - name: bytes_per_sec
+      expr: rate(bytes)
+`
+
+func TestDerived(t *testing.T) {
+	t.Log("Testing derived metrics")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "web.yaml"), []byte(derivedConfig), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	viper.Set(config.KeyLogConfDir, dir)
+	cfgs, err := configs.Load()
+	viper.Reset()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	sd := &setDest{Destination: dest}
+	w, err := New(context.Background(), sd, cfgs[0])
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if len(w.derived) != 3 {
+		t.Fatalf("expected 3 derived metrics, got %d", len(w.derived))
+	}
+	start := time.Now()
+	for _, dw := range w.derived {
+		dw.start = start
+	}
+
+	for _, line := range []string{"status=200", "status=500", "status=200 bytes=100", "status=503", "bytes=500"} {
+		for _, ml := range w.matchLine(line) {
+			m, ok := w.parseLine(ml)
+			if !ok {
+				t.Fatalf("expected metric for %q", line)
+			}
+			w.saveMetric(m)
+		}
+	}
+	t.Log("sampled")
+	w.saveMetric(metric{Name: "requests", Type: "c", Value: "1", ruleID: 1, sampleRate: 4})
+
+	t.Log("interval not ended")
+	sd.sent = nil
+	w.flushDerived(start.Add(time.Second))
+	if len(sd.sent) != 0 {
+		t.Fatalf("expected nothing sent, got %v", sd.sent)
+	}
+
+	t.Log("10s interval ended")
+	w.flushDerived(start.Add(10 * time.Second))
+	expected := "[ok_requests:6|g|[log_id:web]]"
+	if fmt.Sprint(sd.sent) != expected {
+		t.Fatalf("expected %s, got %v", expected, sd.sent)
+	}
+
+	t.Log("1m interval ended")
+	sd.sent = nil
+	w.flushDerived(start.Add(time.Minute))
+	expected = "[error_ratio:0.25|g|[log_id:web team:web] ok_requests:0|g|[log_id:web] bytes_per_sec:10|g|[log_id:web]]"
+	if fmt.Sprint(sd.sent) != expected {
+		t.Fatalf("expected %s, got %v", expected, sd.sent)
+	}
+
+	t.Log("no lines in interval")
+	sd.sent = nil
+	w.flushDerived(start.Add(2 * time.Minute))
+	expected = "[ok_requests:0|g|[log_id:web] bytes_per_sec:0|g|[log_id:web]]"
+	if fmt.Sprint(sd.sent) != expected {
+		t.Fatalf("expected %s (no error_ratio), got %v", expected, sd.sent)
+	}
+
+	t.Log("backfill skips rate()")
+	{
+		w, err := New(context.Background(), sd, cfgs[0])
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		logFile := filepath.Join(dir, "web.log")
+		if err := ioutil.WriteFile(logFile, []byte("status=200 bytes=100\nstatus=500\n"), 0600); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		sd.sent = nil
+		if err := w.Backfill([]string{logFile}); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if len(w.derived) != 2 || len(w.derivedRefs[2]) != 0 {
+			t.Fatalf("expected bytes_per_sec removed, got %d derived", len(w.derived))
+		}
+		expected := "[error_ratio:0.5|g|[log_id:web team:web] ok_requests:1|g|[log_id:web]]"
+		if got := fmt.Sprint(sd.sent[len(sd.sent)-2:]); got != expected {
+			t.Fatalf("expected %s, got %v", expected, sd.sent)
+		}
+	}
+
+	t.Log("no derived metrics")
+	w, err = New(context.Background(), sd, &configs.Config{ID: "web"})
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if w.derived != nil || w.derivedRefs != nil {
+		t.Fatal("expected no derived metrics")
+	}
+}
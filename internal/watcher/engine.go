@@ -0,0 +1,177 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+)
+
+const (
+	minLiteralLen   = 2 // shorter literals are in almost every line, not worth checking
+	maxRuleLiterals = 3 // longest required literals checked per rule
+)
+
+// engine matches lines against the rules of a log config. The literal
+// substrings every match of a rule must contain are extracted when the
+// engine is built, a rule's regular expression is only run on lines
+// containing all of its literals. Literals are shared by rules and
+// searched for at most once per line.
+type engine struct {
+	literals []string
+	rules    []engineRule
+	pool     sync.Pool // per line literal search results (*[]byte)
+}
+
+type engineRule struct {
+	def      *configs.Metric
+	literals []int // indexes into engine.literals
+	submatch bool  // named subexpressions are used, otherwise only test for a match
+}
+
+// literal search results for a line.
+const (
+	literalUnknown byte = iota
+	literalFound
+	literalMissing
+)
+
+func newEngine(rules []*configs.Metric) *engine {
+	e := &engine{rules: make([]engineRule, len(rules))}
+	ids := map[string]int{}
+	for i, def := range rules {
+		r := engineRule{
+			def:      def,
+			submatch: def.Condition != nil || def.Namer != nil || def.Tagger != nil,
+		}
+		for _, name := range def.MatchParts {
+			if name != "" {
+				r.submatch = true
+			}
+		}
+		for _, lit := range ruleLiterals(def.Matcher.String()) {
+			id, ok := ids[lit]
+			if !ok {
+				id = len(e.literals)
+				ids[lit] = id
+				e.literals = append(e.literals, lit)
+			}
+			r.literals = append(r.literals, id)
+		}
+		e.rules[i] = r
+	}
+	n := len(e.literals)
+	e.pool.New = func() interface{} {
+		found := make([]byte, n)
+		return &found
+	}
+	return e
+}
+
+// candidate reports whether line contains all of the required literals
+// for rule id. found caches the literal searches for the line.
+func (e *engine) candidate(id int, line string, found []byte) bool {
+	for _, lit := range e.rules[id].literals {
+		switch found[lit] {
+		case literalMissing:
+			return false
+		case literalUnknown:
+			if !strings.Contains(line, e.literals[lit]) {
+				found[lit] = literalMissing
+				return false
+			}
+			found[lit] = literalFound
+		}
+	}
+	return true
+}
+
+// match runs the rule regular expression on the line, loc holds the
+// submatch index pairs if the rule uses named subexpressions.
+func (e *engine) match(id int, line string) (loc []int, ok bool) {
+	r := &e.rules[id]
+	if !r.submatch {
+		return nil, r.def.Matcher.MatchString(line)
+	}
+	loc = r.def.Matcher.FindStringSubmatchIndex(line)
+	return loc, loc != nil
+}
+
+// scratch returns a cleared literal search result buffer for a line.
+func (e *engine) scratch() *[]byte {
+	found := e.pool.Get().(*[]byte)
+	for i := range *found {
+		(*found)[i] = literalUnknown
+	}
+	return found
+}
+
+func (e *engine) release(found *[]byte) {
+	e.pool.Put(found)
+}
+
+// ruleLiterals returns the longest literals required by expr, none if
+// expr cannot be parsed or has no case sensitive required literals.
+func ruleLiterals(expr string) []string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	var lits []string
+	seen := map[string]bool{}
+	for _, lit := range requiredLiterals(re.Simplify()) {
+		if len(lit) >= minLiteralLen && !seen[lit] {
+			seen[lit] = true
+			lits = append(lits, lit)
+		}
+	}
+	sort.SliceStable(lits, func(i, j int) bool { return len(lits[i]) > len(lits[j]) })
+	if len(lits) > maxRuleLiterals {
+		lits = lits[:maxRuleLiterals]
+	}
+	return lits
+}
+
+// requiredLiterals returns substrings which must appear in any match of re.
+// Alternations, optional and case insensitive parts contribute nothing.
+func requiredLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil
+		}
+		return []string{string(re.Rune)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return requiredLiterals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		var lits []string
+		var run []rune
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral && sub.Flags&syntax.FoldCase == 0 {
+				run = append(run, sub.Rune...)
+				continue
+			}
+			if len(run) > 0 {
+				lits = append(lits, string(run))
+				run = nil
+			}
+			lits = append(lits, requiredLiterals(sub)...)
+		}
+		if len(run) > 0 {
+			lits = append(lits, string(run))
+		}
+		return lits
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestRuleLiterals(t *testing.T) {
+	t.Log("Testing ruleLiterals")
+
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{`testcounter`, []string{"testcounter"}},
+		{`(?P<Name>gaugeint)\s+(?P<Value>[0-9]+)`, []string{"gaugeint"}},
+		{`(?P<Name>text)\|(?P<Value>.+)`, []string{"text"}},
+		{`"(?:GET|POST) /api/v1/(?P<path>\S*) HTTP/1\.[01]" (?P<status>\d{3})`, []string{" /api/v1/", " HTTP/1.", "\" "}},
+		{`^status=(ok|fail) took (?P<Value>\d+)ms$`, []string{"status=", " took ", "ms"}},
+		{`a(bc)+d`, []string{"bc"}},
+		{`x(?:abc)?y`, nil},
+		{`(?:ab){2,}`, []string{"ab"}},
+		{`(?i)error`, nil},
+		{`(one|two)`, nil},
+		{`[`, nil},
+	}
+
+	for _, tst := range tests {
+		got := ruleLiterals(tst.expr)
+		if !reflect.DeepEqual(got, tst.expected) {
+			t.Errorf("%q: expected %q, got %q", tst.expr, tst.expected, got)
+		}
+	}
+}
+
+func TestEngine(t *testing.T) {
+	t.Log("Testing engine")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyLogConfDir, "testdata")
+	defer viper.Reset()
+	cfgs, err := configs.Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	rules := cfgs[0].Metrics
+	e := newEngine(rules)
+
+	t.Log("candidates and matches agree with the rule regular expressions")
+	{
+		lines := []string{
+			"testcounter",
+			"testcounterval 2",
+			"gaugefloat 1.23",
+			"gaugeint 22",
+			"hist 3.86",
+			"event 1577934245 2",
+			"set abc",
+			"text|hello",
+			"nomatch",
+			"",
+		}
+		for _, line := range lines {
+			found := e.scratch()
+			for id, def := range rules {
+				expected := def.Matcher.MatchString(line)
+				if !e.candidate(id, line, *found) {
+					if expected {
+						t.Fatalf("%q: rule %d matches but is not a candidate", line, id)
+					}
+					continue
+				}
+				if _, ok := e.match(id, line); ok != expected {
+					t.Fatalf("%q: rule %d expected match %v", line, id, expected)
+				}
+			}
+			e.release(found)
+		}
+	}
+
+	t.Log("rules without named subexpressions only test for a match")
+	{
+		loc, ok := e.match(0, "testcounter")
+		if !ok || loc != nil {
+			t.Fatalf("expected match without loc, got %v %v", ok, loc)
+		}
+		loc, ok = e.match(1, "testcounterval 2")
+		if !ok || len(loc) != 6 {
+			t.Fatalf("expected match with loc, got %v %v", ok, loc)
+		}
+	}
+
+	t.Log("submatches")
+	{
+		re := regexp.MustCompile(`(?P<a>x)?(?P<b>y+)(?P<a>z)?`)
+		line := "yyz"
+		l := metricLine{line: line, loc: re.FindStringSubmatchIndex(line)}
+		names := re.SubexpNames()
+		if v, ok := l.submatch(names, "b"); !ok || v != "yy" {
+			t.Fatalf("expected yy, got %q %v", v, ok)
+		}
+		if v, ok := l.submatch(names, "a"); !ok || v != "z" {
+			t.Fatalf("expected last a (z), got %q %v", v, ok)
+		}
+		if _, ok := l.submatch(names, "c"); ok {
+			t.Fatal("expected not found")
+		}
+		expected := map[string]string{"a": "z", "b": "yy"}
+		if m := l.submatches(names); !reflect.DeepEqual(m, expected) {
+			t.Fatalf("expected %v, got %v", expected, m)
+		}
+		l = metricLine{line: "y", loc: re.FindStringSubmatchIndex("y")}
+		if v, ok := l.submatch(names, "a"); !ok || v != "" {
+			t.Fatalf("expected empty a, got %q %v", v, ok)
+		}
+	}
+}
+
+// regexpMatch is the previous matching, every rule regular expression
+// run on every line and a map of the named subexpressions built for
+// each match.
+func regexpMatch(rules []*configs.Metric, line string) int {
+	n := 0
+	for _, def := range rules {
+		matches := def.Matcher.FindAllStringSubmatch(line, -1)
+		if matches == nil {
+			continue
+		}
+		m := map[string]string{}
+		for i, val := range matches[0] {
+			if def.MatchParts[i] != "" {
+				m[def.MatchParts[i]] = val
+			}
+		}
+		n += len(m) + 1
+	}
+	return n
+}
+
+// engineMatch matches with the engine, including building the map of
+// named subexpressions for rules which need it when parsing.
+func engineMatch(e *engine, rules []*configs.Metric, line string) int {
+	n := 0
+	found := e.scratch()
+	for id, def := range rules {
+		if !e.candidate(id, line, *found) {
+			continue
+		}
+		loc, ok := e.match(id, line)
+		if !ok {
+			continue
+		}
+		n++
+		if def.Namer != nil || def.Tagger != nil || def.Normalize != nil {
+			n += len(metricLine{line: line, loc: loc}.submatches(def.MatchParts))
+		}
+	}
+	e.release(found)
+	return n
+}
+
+func benchmarkMatch(b *testing.B, rules []*configs.Metric, lines []string) {
+	e := newEngine(rules)
+	b.Run("regexp", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			regexpMatch(rules, lines[i%len(lines)])
+		}
+	})
+	b.Run("engine", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			engineMatch(e, rules, lines[i%len(lines)])
+		}
+	})
+}
+
+// BenchmarkMatch uses the testdata log config and log.
+func BenchmarkMatch(b *testing.B) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyLogConfDir, "testdata")
+	defer viper.Reset()
+	cfgs, err := configs.Load()
+	if err != nil {
+		b.Fatalf("expected no error, got %s", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "test.log"))
+	if err != nil {
+		b.Fatalf("expected no error, got %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	benchmarkMatch(b, cfgs[0].Metrics, lines)
+}
+
+// BenchmarkMatchNginx uses 40 access log rules, one per service, each
+// line matching one rule.
+func BenchmarkMatchNginx(b *testing.B) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	const services = 40
+	var cfg strings.Builder
+	cfg.WriteString("id: nginx\nlog_file: /var/log/nginx/access.log\nmetrics:\n")
+	for i := 0; i < services; i++ {
+		fmt.Fprintf(&cfg, "    - match: '\"(?P<method>GET|POST|PUT) /api/v1/svc%d/(?P<path>\\S*) HTTP/1\\.[01]\" (?P<status>\\d{3}) (?P<bytes>\\d+) (?P<Value>[0-9.]+)$'\n", i)
+		fmt.Fprintf(&cfg, "      name: svc%d_latency\n      type: h\n      tags: 'method:{{.method}},status:{{.status}}'\n", i)
+	}
+	dir := b.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "nginx.yaml"), []byte(cfg.String()), 0600); err != nil {
+		b.Fatalf("expected no error, got %s", err)
+	}
+	viper.Set(config.KeyLogConfDir, dir)
+	defer viper.Reset()
+	cfgs, err := configs.Load()
+	if err != nil {
+		b.Fatalf("expected no error, got %s", err)
+	}
+	if len(cfgs[0].Metrics) != services {
+		b.Fatalf("expected %d rules, got %d", services, len(cfgs[0].Metrics))
+	}
+
+	lines := make([]string, 1000)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(`10.1.2.%d - - [10/Oct/2000:13:55:36 -0700] "GET /api/v1/svc%d/items/%d HTTP/1.1" 200 %d 0.%03d`,
+			i%255, (i*7)%services, i, 100+i, i%1000)
+	}
+
+	benchmarkMatch(b, cfgs[0].Metrics, lines)
+}
@@ -0,0 +1,139 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/maier/go-appstats"
+)
+
+// rateLimiter is a token bucket, allowing bursts of up to one second of
+// lines. It is only used by the goroutine reading the log.
+type rateLimiter struct {
+	last   time.Time
+	rate   float64
+	burst  float64
+	tokens float64
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		last:   time.Now(),
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// allow reports whether a line may be processed at now.
+func (r *rateLimiter) allow(now time.Time) bool {
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// admit applies max_lines_per_second and, without a sample field, line
+// sampling to a line read from the log. Returns false if it is dropped.
+func (w *Watcher) admit() bool {
+	if w.limiter != nil && !w.limiter.allow(time.Now()) {
+		_ = appstats.IncrementInt(w.statRateLimited)
+		atomic.AddUint64(&w.stats.rateLimited, 1)
+		return false
+	}
+	if s := w.cfg.Sample; s != nil && s.Rate > 1 && s.Field == "" {
+		w.sampleCount++
+		if (w.sampleCount-1)%uint64(s.Rate) != 0 {
+			w.lineSampledOut()
+			return false
+		}
+	}
+	return true
+}
+
+// sampleLine sets the sample rate of a line matching rule def. With a
+// sample field, returns false if the line is not in the sample. Rules
+// without the field are not sampled. Backfill is never sampled.
+func (w *Watcher) sampleLine(def *configs.Metric, ml *metricLine) bool {
+	s := w.cfg.Sample
+	if s == nil || s.Rate <= 1 || w.backfill {
+		return true
+	}
+	if s.Field == "" {
+		ml.sampleRate = s.Rate // the line was sampled by admit
+		return true
+	}
+	v, ok := ml.submatch(def.MatchParts, s.Field)
+	if !ok {
+		return true
+	}
+	if !s.Keep(v) {
+		return false
+	}
+	ml.sampleRate = s.Rate
+	return true
+}
+
+// lineSampledOut records a line which was not in the sample.
+func (w *Watcher) lineSampledOut() {
+	_ = appstats.IncrementInt(w.statSampledOut)
+	atomic.AddUint64(&w.stats.sampledOut, 1)
+}
+
+// saveSampled sends a metric from a sampled line. Destinations accepting
+// a sample rate get counters and histograms with the rate, otherwise
+// counters are scaled up by the sample rate and sent by the caller.
+// Returns true if the metric was sent.
+func (w *Watcher) saveSampled(m *metric) bool {
+	useRate := w.sampledDest != nil && (w.tsDest == nil || m.Timestamp.IsZero())
+	rate := 1 / float64(m.sampleRate)
+
+	var err error
+	switch m.Type {
+	case "c":
+		v, perr := strconv.ParseUint(m.Value, 10, 64)
+		if perr != nil {
+			return false // reported by the caller
+		}
+		if !useRate {
+			m.Value = strconv.FormatUint(v*uint64(m.sampleRate), 10)
+			return false
+		}
+		err = w.sampledDest.IncrementCounterByValueWithTagsAndRate(m.Name, m.Tags, v, rate)
+	case "h":
+		v, perr := strconv.ParseFloat(m.Value, 64)
+		if perr != nil || !useRate {
+			return false
+		}
+		err = w.sampledDest.SetHistogramValueWithTagsAndRate(m.Name, m.Tags, v, rate)
+	case "ms":
+		v, perr := parseTiming(m.Value)
+		if perr != nil || !useRate {
+			return false
+		}
+		err = w.sampledDest.SetHistogramValueWithTagsAndRate(m.Name, m.Tags, v, rate)
+	default:
+		return false
+	}
+	if err != nil {
+		w.logger.Warn().Err(err).Str("metric", m.Name).Msg("sending sampled metric")
+	}
+	return true
+}
@@ -0,0 +1,234 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// sampledDest records metrics sent with a sample rate.
+type sampledDest struct {
+	metrics.Destination
+	sent []string
+}
+
+func (d *sampledDest) IncrementCounterByValueWithTagsAndRate(name string, tags []string, v uint64, rate float64) error {
+	d.sent = append(d.sent, fmt.Sprintf("%s:%d|c|@%g", name, v, rate))
+	return nil
+}
+
+func (d *sampledDest) SetHistogramValueWithTagsAndRate(name string, tags []string, v, rate float64) error {
+	d.sent = append(d.sent, fmt.Sprintf("%s:%g|h|@%g", name, v, rate))
+	return nil
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Log("Testing rateLimiter")
+
+	r := newRateLimiter(10)
+	now := r.last
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if r.allow(now) {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Fatalf("expected burst of 10, got %d", allowed)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	allowed = 0
+	for i := 0; i < 20; i++ {
+		if r.allow(now) {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Fatalf("expected 5 after 500ms, got %d", allowed)
+	}
+
+	now = now.Add(time.Hour)
+	allowed = 0
+	for i := 0; i < 20; i++ {
+		if r.allow(now) {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Fatalf("expected burst capped at 10, got %d", allowed)
+	}
+}
+
+func TestIngest(t *testing.T) {
+	t.Log("Testing rate limiting and sampling")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyLogConfDir, "testdata")
+	defer viper.Reset()
+	cfgs, err := configs.Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	newWatcher := func(cfg configs.Config) *Watcher {
+		w, err := New(context.Background(), dest, &cfg)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		return w
+	}
+
+	t.Log("max_lines_per_second")
+	{
+		cfg := *cfgs[0]
+		cfg.MaxLinesPerSecond = 5
+		w := newWatcher(cfg)
+		for i := 0; i < 8; i++ {
+			if !w.dispatch("testcounter") {
+				t.Fatal("expected true")
+			}
+		}
+		st := w.Status()
+		if st.RateLimited != 3 || len(w.metricLines) != 5 {
+			t.Fatalf("expected 3 rate limited and 5 queued, got %d %d", st.RateLimited, len(w.metricLines))
+		}
+	}
+
+	t.Log("1 in 3 lines")
+	{
+		cfg := *cfgs[0]
+		cfg.Sample = &configs.Sample{Rate: 3}
+		w := newWatcher(cfg)
+		for i := 0; i < 9; i++ {
+			if !w.dispatch("testcounter") {
+				t.Fatal("expected true")
+			}
+		}
+		if st := w.Status(); st.SampledOut != 6 || len(w.metricLines) != 3 {
+			t.Fatalf("expected 6 sampled out and 3 queued, got %d %d", st.SampledOut, len(w.metricLines))
+		}
+		l := <-w.metricLines
+		if l.sampleRate != 3 {
+			t.Fatalf("expected sample rate 3, got %d", l.sampleRate)
+		}
+		m, ok := w.parseLine(l)
+		if !ok || m.sampleRate != 3 {
+			t.Fatalf("expected metric with sample rate 3, got %#v", m)
+		}
+	}
+
+	t.Log("hash of a field")
+	{
+		cfg := *cfgs[0]
+		cfg.Sample = &configs.Sample{Rate: 4, Field: "Value"}
+		w := newWatcher(cfg)
+		kept := 0
+		for i := 0; i < 100; i++ {
+			line := fmt.Sprintf("hist %d", i)
+			mls := w.matchLine(line)
+			if cfg.Sample.Keep(fmt.Sprint(i)) != (len(mls) == 1) {
+				t.Fatalf("%s: sample mismatch", line)
+			}
+			if len(mls) == 1 {
+				kept++
+				if mls[0].sampleRate != 4 {
+					t.Fatalf("expected sample rate 4, got %d", mls[0].sampleRate)
+				}
+			}
+		}
+		if st := w.Status(); int(st.SampledOut) != 100-kept || st.Unmatched != 0 {
+			t.Fatalf("expected %d sampled out, got %#v", 100-kept, st)
+		}
+
+		t.Log("rules without the field are not sampled")
+		mls := w.matchLine("testcounter")
+		if len(mls) != 1 || mls[0].sampleRate != 0 {
+			t.Fatalf("expected unsampled line, got %#v", mls)
+		}
+
+		t.Log("backfill is not sampled")
+		w.backfill = true
+		for i := 0; i < 10; i++ {
+			if mls := w.matchLine(fmt.Sprintf("hist %d", i)); len(mls) != 1 || mls[0].sampleRate != 0 {
+				t.Fatalf("expected unsampled line, got %#v", mls)
+			}
+		}
+	}
+}
+
+func TestSaveSampled(t *testing.T) {
+	t.Log("Testing saveSampled")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	t.Log("scaled counters")
+	{
+		w, err := New(context.Background(), dest, &configs.Config{ID: "sampled"})
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		m := metric{Name: "c", Type: "c", Value: "2", sampleRate: 10}
+		if w.saveSampled(&m) {
+			t.Fatal("expected false, sent by caller")
+		}
+		if m.Value != "20" {
+			t.Fatalf("expected 20, got %s", m.Value)
+		}
+		h := metric{Name: "h", Type: "h", Value: "1.5", sampleRate: 10}
+		if w.saveSampled(&h) || h.Value != "1.5" {
+			t.Fatalf("expected histogram unchanged, got %#v", h)
+		}
+	}
+
+	t.Log("sample rate")
+	{
+		sd := &sampledDest{Destination: dest}
+		w, err := New(context.Background(), sd, &configs.Config{ID: "sampled"})
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		for _, m := range []metric{
+			{Name: "c", Type: "c", Value: "2", sampleRate: 10},
+			{Name: "h", Type: "h", Value: "1.5", sampleRate: 4},
+			{Name: "ms", Type: "ms", Value: "2s", sampleRate: 2},
+		} {
+			m := m
+			if !w.saveSampled(&m) {
+				t.Fatalf("expected %s sent", m.Name)
+			}
+		}
+		g := metric{Name: "g", Type: "g", Value: "1", sampleRate: 10}
+		if w.saveSampled(&g) {
+			t.Fatal("expected gauge sent by caller")
+		}
+		expected := []string{"c:2|c|@0.1", "h:1.5|h|@0.25", "ms:2000|h|@0.5"}
+		if fmt.Sprint(sd.sent) != fmt.Sprint(expected) {
+			t.Fatalf("expected %v, got %v", expected, sd.sent)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+//go:build windows
+// +build windows
+
+package watcher
+
+import "os"
+
+// inode is not available on Windows.
+func inode(fi os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,259 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"sync/atomic"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/maier/go-appstats"
+)
+
+// logLineMax is the most of a line included in log messages.
+const logLineMax = 256
+
+// decodeLine applies max_line_bytes to a line read from the log and
+// converts it to UTF-8 for matching. Returns false if the line is
+// skipped, too long or invalid UTF-8 with the skip policies.
+func (w *Watcher) decodeLine(text string) (string, bool) {
+	if max := w.cfg.MaxLineBytes; max > 0 && len(text) > max {
+		w.lineTooLong()
+		if w.cfg.LongLines == configs.LongLinesSkip {
+			return "", false
+		}
+		text = truncateLine(text, max, w.cfg.Encoding)
+	}
+
+	switch w.cfg.Encoding {
+	case configs.EncodingLatin1:
+		return decodeLatin1(text), true
+	case configs.EncodingUTF16LE:
+		return decodeUTF16LE(text), true
+	}
+
+	switch w.cfg.InvalidUTF8 {
+	case configs.InvalidUTF8Replace, configs.InvalidUTF8Skip:
+	default:
+		return text, true
+	}
+	if utf8.ValidString(text) {
+		return text, true
+	}
+	w.lineInvalid()
+	if w.cfg.InvalidUTF8 == configs.InvalidUTF8Skip {
+		return "", false
+	}
+	return strings.ToValidUTF8(text, string(utf8.RuneError)), true
+}
+
+// truncateLine returns the first max bytes of a line, for UTF-8 without
+// splitting a multi-byte character.
+func truncateLine(text string, max int, encoding string) string {
+	if encoding == configs.EncodingUTF8 || encoding == "" {
+		for i := max; i > 0 && max-i < utf8.UTFMax; i-- {
+			if utf8.RuneStart(text[i]) {
+				return text[:i]
+			}
+		}
+	}
+	return text[:max]
+}
+
+// decodeLatin1 converts an ISO-8859-1 line to UTF-8.
+func decodeLatin1(text string) string {
+	ascii := true
+	for i := 0; i < len(text); i++ {
+		if text[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return text
+	}
+	var sb strings.Builder
+	sb.Grow(len(text) * 2)
+	for i := 0; i < len(text); i++ {
+		sb.WriteRune(rune(text[i]))
+	}
+	return sb.String()
+}
+
+// decodeUTF16LE converts a UTF-16LE line to UTF-8, dropping a byte order
+// mark and a trailing carriage return. Unpaired surrogates become U+FFFD.
+func decodeUTF16LE(text string) string {
+	text = strings.TrimPrefix(text, "\xff\xfe")
+	u := make([]uint16, len(text)/2)
+	for i := range u {
+		u[i] = uint16(text[2*i]) | uint16(text[2*i+1])<<8
+	}
+	return strings.TrimSuffix(string(utf16.Decode(u)), "\r")
+}
+
+// newScanner returns a line scanner for a (rotated or backfill) log.
+// With max_line_bytes, the part of a line beyond the limit is discarded
+// as it is read, so a long line does not fail the scan.
+func (w *Watcher) newScanner(r io.Reader) *bufio.Scanner {
+	max := backfillMaxLineSize
+	if w.cfg.MaxLineBytes >= max {
+		max = w.cfg.MaxLineBytes + 1
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, backfillBufSize), max)
+	scanner.Split(scanLines(w.cfg.MaxLineBytes, w.cfg.Encoding == configs.EncodingUTF16LE))
+	return scanner
+}
+
+// scanLines is bufio.ScanLines, except a line longer than maxBytes is
+// returned as its first maxBytes+1 bytes (so it is still seen as too
+// long) and the rest of the line is skipped. With utf16le lines end with
+// the code unit 0x0A 0x00 at an even offset from the start of the line,
+// not a 0x0A byte which may be part of another character, and carriage
+// returns are left for decodeUTF16LE.
+func scanLines(maxBytes int, utf16le bool) bufio.SplitFunc {
+	long := false // skipping the rest of a long line
+	odd := false  // an odd number of bytes of the line have been skipped
+	line := func(data []byte) []byte {
+		if !utf16le && len(data) > 0 && data[len(data)-1] == '\r' {
+			return data[:len(data)-1]
+		}
+		return data
+	}
+	newline := func(data []byte) (int, int) {
+		if !utf16le {
+			return bytes.IndexByte(data, '\n'), 1
+		}
+		i := 0
+		if odd {
+			i = 1
+		}
+		for ; i+1 < len(data); i += 2 {
+			if data[i] == '\n' && data[i+1] == 0 {
+				return i, 2
+			}
+		}
+		return -1, 0
+	}
+	// skip returns how much of data without a newline can be skipped, a
+	// final 0x0A which may start a UTF-16LE newline is kept
+	skip := func(data []byte, atEOF bool) int {
+		n := len(data)
+		if utf16le && !atEOF && data[n-1] == '\n' && ((n-1)%2 == 1) == odd {
+			n--
+		}
+		return n
+	}
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i, n := newline(data); i >= 0 {
+			odd = false
+			if long {
+				long = false
+				return i + n, nil, nil
+			}
+			return i + n, line(data[:i]), nil
+		}
+		if long {
+			n := skip(data, atEOF)
+			odd = odd != (n%2 == 1)
+			return n, nil, nil
+		}
+		if maxBytes > 0 && len(data) > maxBytes {
+			long = true
+			n := skip(data, atEOF)
+			odd = n%2 == 1
+			return n, data[:maxBytes+1], nil
+		}
+		if atEOF {
+			return len(data), line(data), nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// utf16Lines joins the lines read by the tailer, which splits a log on
+// the byte 0x0A, into UTF-16LE lines ending with the code unit 0x0A 0x00
+// at an even offset from the start of the line.
+type utf16Lines struct {
+	line []byte // the line so far
+	end  int64  // offset after the last part read, -1 if none
+	nl   bool   // the last part read was followed by 0x0A
+}
+
+func newUTF16Lines() *utf16Lines {
+	return &utf16Lines{end: -1}
+}
+
+// add adds a part of the log read by the tailer, offset is the offset
+// after the part as reported by the tailer. The tailer drops the 0x0A
+// ending a part, or the part was the end of the log if it does not
+// account for the offset. When the part completes the previous line it
+// is returned with the offset after it.
+func (u *utf16Lines) add(part string, offset int64) (string, int64, bool) {
+	var text string
+	end, ok := u.end, false
+	size := int64(len(part))
+	nl := offset-size-1 == u.end
+	switch {
+	case u.end < 0 || (!nl && offset-size != u.end):
+		// first part, or the log was reopened
+		if len(u.line) > 0 {
+			text, ok = string(u.line), true
+		}
+		u.line = append(u.line[:0], part...)
+		nl = true
+	case u.nl && len(u.line)%2 == 0 && part != "" && part[0] == 0:
+		text, ok = string(u.line), true
+		end = u.end + 1
+		u.line = append(u.line[:0], part[1:]...)
+	case u.nl:
+		u.line = append(u.line, '\n')
+		u.line = append(u.line, part...)
+	default:
+		u.line = append(u.line, part...)
+	}
+	u.end = offset
+	u.nl = nl
+	return text, end, ok
+}
+
+// logLine returns a line shortened for log messages.
+func logLine(text string) string {
+	if len(text) > logLineMax {
+		return text[:logLineMax] + "..."
+	}
+	return text
+}
+
+// lineTooLong records a line longer than max_line_bytes.
+func (w *Watcher) lineTooLong() {
+	_ = appstats.IncrementInt(w.statTooLong)
+	atomic.AddUint64(&w.stats.tooLong, 1)
+}
+
+// lineInvalid records a line which is not valid UTF-8.
+func (w *Watcher) lineInvalid() {
+	_ = appstats.IncrementInt(w.statInvalid)
+	atomic.AddUint64(&w.stats.invalid, 1)
+}
+
+// lineError records a line the tailer returned with an error.
+func (w *Watcher) lineError(text string, err error) {
+	_ = appstats.IncrementInt(w.statLineErrors)
+	atomic.AddUint64(&w.stats.lineErrors, 1)
+	w.logger.Warn().
+		Err(err).
+		Str("log_line", logLine(text)).
+		Msg("tail line error -- ignoring line")
+}
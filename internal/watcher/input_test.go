@@ -0,0 +1,235 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
+	"github.com/nxadm/tail"
+	"github.com/rs/zerolog"
+)
+
+func newInputWatcher(t *testing.T, cfg configs.Config) *Watcher {
+	t.Helper()
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	cfg.ID = "input"
+	w, err := New(context.Background(), dest, &cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	return w
+}
+
+// utf16le encodes s as UTF-16LE.
+func utf16le(s string) string {
+	var sb strings.Builder
+	for _, u := range utf16.Encode([]rune(s)) {
+		sb.WriteByte(byte(u))
+		sb.WriteByte(byte(u >> 8))
+	}
+	return sb.String()
+}
+
+func TestDecodeLine(t *testing.T) {
+	t.Log("Testing decodeLine")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	tests := []struct {
+		desc     string
+		cfg      configs.Config
+		line     string
+		expected string
+		ok       bool
+	}{
+		{"unchanged", configs.Config{}, "foo bar", "foo bar", true},
+		{"truncate", configs.Config{MaxLineBytes: 3, LongLines: configs.LongLinesTruncate}, "foo bar", "foo", true},
+		{"truncate utf-8", configs.Config{MaxLineBytes: 4, LongLines: configs.LongLinesTruncate}, "cafés", "caf", true},
+		{"skip long", configs.Config{MaxLineBytes: 3, LongLines: configs.LongLinesSkip}, "foo bar", "", false},
+		{"not long", configs.Config{MaxLineBytes: 7, LongLines: configs.LongLinesSkip}, "foo bar", "foo bar", true},
+		{"pass invalid", configs.Config{InvalidUTF8: configs.InvalidUTF8Pass}, "foo\xffbar", "foo\xffbar", true},
+		{"replace invalid", configs.Config{InvalidUTF8: configs.InvalidUTF8Replace}, "foo\xffbar", "foo�bar", true},
+		{"skip invalid", configs.Config{InvalidUTF8: configs.InvalidUTF8Skip}, "foo\xffbar", "", false},
+		{"latin1", configs.Config{Encoding: configs.EncodingLatin1}, "caf\xe9", "café", true},
+		{"latin1 ascii", configs.Config{Encoding: configs.EncodingLatin1}, "cafe", "cafe", true},
+		{"utf-16le bom", configs.Config{Encoding: configs.EncodingUTF16LE}, "\xff\xfe" + utf16le("café"), "café", true},
+		{"utf-16le carriage return", configs.Config{Encoding: configs.EncodingUTF16LE}, utf16le("café \U0001F600\r"), "café \U0001F600", true},
+		{"utf-16le truncate", configs.Config{Encoding: configs.EncodingUTF16LE, MaxLineBytes: 7}, utf16le("foo bar"), "foo", true},
+	}
+
+	for _, tst := range tests {
+		w := newInputWatcher(t, tst.cfg)
+		text, ok := w.decodeLine(tst.line)
+		if ok != tst.ok || text != tst.expected {
+			t.Fatalf("%s: expected %q %v, got %q %v", tst.desc, tst.expected, tst.ok, text, ok)
+		}
+	}
+
+	t.Log("counters")
+	{
+		w := newInputWatcher(t, configs.Config{MaxLineBytes: 3, InvalidUTF8: configs.InvalidUTF8Replace})
+		for _, line := range []string{"foo", "foo bar", "\xff", "fo\xff\xff"} {
+			_, _ = w.decodeLine(line)
+		}
+		w.lineError("Too much log activity", errors.New("Too much log activity"))
+		st := w.Status()
+		if st.TooLong != 2 || st.Invalid != 2 || st.LineErrors != 1 {
+			t.Fatalf("expected 2 too long, 2 invalid and 1 line error, got %d %d %d", st.TooLong, st.Invalid, st.LineErrors)
+		}
+	}
+}
+
+func TestNewScanner(t *testing.T) {
+	t.Log("Testing newScanner")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	scan := func(w *Watcher, data string) []string {
+		var lines []string
+		scanner := w.newScanner(strings.NewReader(data))
+		for scanner.Scan() {
+			if text, ok := w.decodeLine(scanner.Text()); ok {
+				lines = append(lines, text)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		return lines
+	}
+
+	t.Log("long lines")
+	{
+		long := strings.Repeat("x", backfillMaxLineSize*2)
+		data := "foo\r\n" + long + "\nbar\n" + long
+
+		w := newInputWatcher(t, configs.Config{MaxLineBytes: 10, LongLines: configs.LongLinesTruncate})
+		lines := scan(w, data)
+		expected := []string{"foo", "xxxxxxxxxx", "bar", "xxxxxxxxxx"}
+		if strings.Join(lines, ",") != strings.Join(expected, ",") {
+			t.Fatalf("expected %v, got %v", expected, lines)
+		}
+		if st := w.Status(); st.TooLong != 2 {
+			t.Fatalf("expected 2 too long, got %d", st.TooLong)
+		}
+
+		w = newInputWatcher(t, configs.Config{MaxLineBytes: 10, LongLines: configs.LongLinesSkip})
+		if lines := scan(w, data); strings.Join(lines, ",") != "foo,bar" {
+			t.Fatalf("expected [foo bar], got %v", lines)
+		}
+	}
+
+	t.Log("utf-16le")
+	{
+		w := newInputWatcher(t, configs.Config{Encoding: configs.EncodingUTF16LE})
+		// U+010A and U+0A00 contain the byte 0x0A
+		data := "\xff\xfe" + utf16le("café 1\r\nfoo \u010a\u0a00 2\n\u0a0a")
+		lines := scan(w, data)
+		if len(lines) != 3 || lines[0] != "café 1" || lines[1] != "foo \u010a\u0a00 2" || lines[2] != "\u0a0a" {
+			t.Fatalf("unexpected lines %q", lines)
+		}
+
+		long := strings.Repeat("\u0a0a", backfillMaxLineSize)
+		w = newInputWatcher(t, configs.Config{Encoding: configs.EncodingUTF16LE, MaxLineBytes: 8, LongLines: configs.LongLinesTruncate})
+		lines = scan(w, utf16le("x"+long+"\nfoo\n"+long+"\nbar"))
+		expected := []string{"x\u0a0a\u0a0a\u0a0a", "foo", "\u0a0a\u0a0a\u0a0a\u0a0a", "bar"}
+		if strings.Join(lines, ",") != strings.Join(expected, ",") {
+			t.Fatalf("expected %q, got %q", expected, lines)
+		}
+	}
+}
+
+func TestUTF16Lines(t *testing.T) {
+	t.Log("Testing utf16Lines")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	file := filepath.Join(t.TempDir(), "utf16.log")
+	first := utf16le("foo \u010a\u0a00\r\n")
+	second := utf16le("bar\u0a0a\r\n")
+	third := utf16le("baz\r\n")
+	if err := ioutil.WriteFile(file, []byte(first+second), 0644); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	tailer, err := tail.TailFile(file, tail.Config{
+		Follow:    true,
+		MustExist: true,
+		Logger:    tail.DiscardingLogger,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	defer tailer.Cleanup()
+	defer func() { _ = tailer.Stop() }()
+
+	u := newUTF16Lines()
+	next := func() (string, int64) {
+		t.Helper()
+		for {
+			select {
+			case line := <-tailer.Lines:
+				if line.Err != nil {
+					t.Fatalf("expected no error, got (%s)", line.Err)
+				}
+				if text, offset, ok := u.add(line.Text, line.SeekInfo.Offset); ok {
+					return decodeUTF16LE(text), offset
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for a line")
+			}
+		}
+	}
+
+	expect := []struct {
+		text   string
+		offset int64
+	}{
+		{"foo \u010a\u0a00", int64(len(first))},
+		{"bar\u0a0a", int64(len(first + second))},
+	}
+	for _, e := range expect {
+		if text, offset := next(); text != e.text || offset != e.offset {
+			t.Fatalf("expected %q at %d, got %q at %d", e.text, e.offset, text, offset)
+		}
+	}
+
+	t.Log("appended")
+	{
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		// the line is written in two parts, split after its 0x0A
+		half := len(third) - 1
+		if _, err := f.WriteString(third[:half]); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		time.Sleep(250 * time.Millisecond)
+		if _, err := f.WriteString(third[half:]); err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		f.Close()
+
+		want := int64(len(first + second + third))
+		if text, offset := next(); text != "baz" || offset != want {
+			t.Fatalf("expected %q at %d, got %q at %d", "baz", want, text, offset)
+		}
+	}
+}
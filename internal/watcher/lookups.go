@@ -0,0 +1,89 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"time"
+
+	"github.com/maier/go-appstats"
+)
+
+// reloadable is a lookup table or IP classifier, whose files are reloaded
+// when they change.
+type reloadable interface {
+	Load(force bool) (bool, error)
+	Period() time.Duration
+	Len() int
+	String() string
+}
+
+// newReloadables returns the lookup tables and IP classifiers of the log
+// config, nil if there are none.
+func (w *Watcher) newReloadables() []reloadable {
+	var rs []reloadable
+	for _, lt := range w.cfg.Lookups {
+		rs = append(rs, lt)
+	}
+	for _, ic := range w.cfg.IPClassify {
+		rs = append(rs, ic)
+	}
+	return rs
+}
+
+// reloadLookups reloads the lookup tables and IP classifiers of the log
+// config when their files change, each is checked every reload interval.
+func (w *Watcher) reloadLookups() error {
+	period := w.reloadables[0].Period()
+	for _, r := range w.reloadables[1:] {
+		if p := r.Period(); p < period {
+			period = p
+		}
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	checked := make([]time.Time, len(w.reloadables))
+	for i := range checked {
+		checked[i] = time.Now()
+	}
+	for {
+		select {
+		case <-w.groupCtx.Done():
+			return nil
+		case now := <-ticker.C:
+			for i, r := range w.reloadables {
+				if now.Sub(checked[i]) < r.Period() {
+					continue
+				}
+				checked[i] = now
+				w.reloadLookup(i)
+			}
+		}
+	}
+}
+
+// reloadLookup reloads a lookup table or IP classifier if its files
+// changed, the previous version is kept if they cannot be read.
+func (w *Watcher) reloadLookup(id int) {
+	r := w.reloadables[id]
+	loaded, err := r.Load(false)
+	if err != nil {
+		_ = appstats.IncrementInt(w.statLookupErrors)
+		w.logger.Warn().
+			Err(err).
+			Str("lookup", r.String()).
+			Msg("reloading lookup, keeping previous version")
+		return
+	}
+	if !loaded {
+		return
+	}
+	_ = appstats.IncrementInt(w.statLookupReload)
+	w.logger.Info().
+		Str("lookup", r.String()).
+		Int("entries", r.Len()).
+		Msg("lookup reloaded")
+}
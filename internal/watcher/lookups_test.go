@@ -0,0 +1,182 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestLookups(t *testing.T) {
+	t.Log("Testing lookup tables")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := t.TempDir()
+	table := filepath.Join(dir, "customers.csv")
+	if err := ioutil.WriteFile(table, []byte("customer_id,tier\nc1,gold\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	cfg := fmt.Sprintf(`id: web
+log_file: /var/log/web.log
+metrics:
+    - match: 'customer=(?P<customer>\S+)'
+      name: requests
+      tags: 'tier:{{.tier}}'
+    - match: 'customer=(?P<customer>\S+)'
+      name: requests_by_customer
+      tags: 'customer:{{.customer}}'
+lookups:
+    - name: tier
+      file: %s
+      field: customer
+      default: free
+`, table)
+	if err := ioutil.WriteFile(filepath.Join(dir, "web.yaml"), []byte(cfg), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	viper.Set(config.KeyLogConfDir, dir)
+	cfgs, err := configs.Load()
+	viper.Reset()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	w, err := New(context.Background(), dest, cfgs[0])
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	tags := func(line string) []string {
+		var all []string
+		for _, ml := range w.matchLine(line) {
+			m, ok := w.parseLine(ml)
+			if !ok {
+				t.Fatalf("expected metric for %q", line)
+			}
+			all = append(all, m.Tags[1:]...)
+		}
+		return all
+	}
+
+	expected := "[tier:gold customer:c1]"
+	if tg := tags("customer=c1"); fmt.Sprint(tg) != expected {
+		t.Fatalf("expected %s, got %v", expected, tg)
+	}
+	expected = "[tier:free customer:c2]"
+	if tg := tags("customer=c2"); fmt.Sprint(tg) != expected {
+		t.Fatalf("expected %s, got %v", expected, tg)
+	}
+
+	t.Log("reloaded")
+	if err := ioutil.WriteFile(table, []byte("customer_id,tier\nc1,gold\nc2,silver\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	w.reloadLookup(0)
+	expected = "[tier:silver customer:c2]"
+	if tg := tags("customer=c2"); fmt.Sprint(tg) != expected {
+		t.Fatalf("expected %s, got %v", expected, tg)
+	}
+
+	t.Log("invalid, previous table kept")
+	if err := ioutil.WriteFile(table, []byte("customer_id\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	w.reloadLookup(0)
+	if tg := tags("customer=c2"); fmt.Sprint(tg) != expected {
+		t.Fatalf("expected %s, got %v", expected, tg)
+	}
+}
+
+func TestIPClassify(t *testing.T) {
+	t.Log("Testing IP classification")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := t.TempDir()
+	// outside the log config directory, it would be loaded as a log config
+	networks := filepath.Join(t.TempDir(), "networks.yaml")
+	if err := ioutil.WriteFile(networks, []byte("internal: [10.0.0.0/8]\noffice: [10.1.0.0/16]\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	cfg := fmt.Sprintf(`id: web
+log_file: /var/log/web.log
+metrics:
+    - match: '^(?P<client>\S+) (?P<status>\d+)'
+      name: 'requests_{{.client_class}}'
+      tags: 'country:{{or .client_country "unknown"}}'
+ip_classify:
+    - field: client
+      networks: %s
+      default: external
+`, networks)
+	if err := ioutil.WriteFile(filepath.Join(dir, "web.yaml"), []byte(cfg), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	viper.Set(config.KeyLogConfDir, dir)
+	cfgs, err := configs.Load()
+	viper.Reset()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	w, err := New(context.Background(), dest, cfgs[0])
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if len(w.reloadables) != 1 {
+		t.Fatalf("expected 1 reloadable, got %d", len(w.reloadables))
+	}
+
+	metricFor := func(line string) string {
+		mls := w.matchLine(line)
+		if len(mls) != 1 {
+			t.Fatalf("expected 1 match for %q, got %d", line, len(mls))
+		}
+		m, ok := w.parseLine(mls[0])
+		if !ok {
+			t.Fatalf("expected metric for %q", line)
+		}
+		return fmt.Sprint(m.Name, m.Tags[1:])
+	}
+
+	tests := map[string]string{
+		"10.2.0.1 200":     "requests_internal[country:unknown]",
+		"10.1.0.1 200":     "requests_office[country:unknown]",
+		"198.51.100.1 200": "requests_external[country:unknown]",
+	}
+	for line, expected := range tests {
+		if v := metricFor(line); v != expected {
+			t.Fatalf("%q: expected %s, got %s", line, expected, v)
+		}
+	}
+
+	t.Log("reloaded")
+	if err := ioutil.WriteFile(networks, []byte("internal: [10.0.0.0/8]\npartner: [198.51.100.0/24]\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	w.reloadLookup(0)
+	if v := metricFor("198.51.100.1 200"); v != "requests_partner[country:unknown]" {
+		t.Fatalf("expected requests_partner, got %s", v)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"sync/atomic"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/maier/go-appstats"
+)
+
+// Watcher queue names.
+const (
+	QueueLines   = "lines"   // lines (matched lines, or lines for workers) waiting to be parsed
+	QueueMetrics = "metrics" // metrics waiting to be sent to the destination
+)
+
+// QueueStatus is a snapshot of a watcher queue.
+type QueueStatus struct {
+	Name      string `json:"name"`
+	Size      int    `json:"size"`
+	Depth     int    `json:"depth"`
+	HighWater int64  `json:"high_water"`
+	Dropped   uint64 `json:"dropped"`
+}
+
+// queueStats are the counters for a queue, updated atomically.
+type queueStats struct {
+	highWater int64
+	dropped   uint64
+}
+
+// queued records the queue depth after an item was queued.
+func (q *queueStats) queued(depth int) {
+	d := int64(depth)
+	for {
+		hw := atomic.LoadInt64(&q.highWater)
+		if d <= hw || atomic.CompareAndSwapInt64(&q.highWater, hw, d) {
+			return
+		}
+	}
+}
+
+// drop records an item dropped from, or not added to, a full queue.
+func (w *Watcher) drop(q *queueStats) {
+	atomic.AddUint64(&q.dropped, 1)
+	_ = appstats.IncrementInt(w.statQueueDropped)
+}
+
+// queueLine queues a matched line for parse, applying the queue policy
+// if the queue is full. Returns false if the watcher is stopping.
+func (w *Watcher) queueLine(ml metricLine) bool {
+	for {
+		select {
+		case w.metricLines <- ml:
+			w.lineQueue.queued(len(w.metricLines))
+			return true
+		default:
+		}
+		switch w.queuePolicy {
+		case config.QueueDropNewest:
+			w.drop(&w.lineQueue)
+			return true
+		case config.QueueDropOldest:
+			select {
+			case <-w.metricLines:
+				w.drop(&w.lineQueue)
+			default:
+			}
+			continue
+		}
+		select {
+		case w.metricLines <- ml:
+			w.lineQueue.queued(len(w.metricLines))
+			return true
+		case <-w.groupCtx.Done():
+			return false
+		}
+	}
+}
+
+// queueWork queues a line for the workers. Lines in progress are limited
+// to the queue size, when reached the queue policy is applied. A dropped
+// queued line is passed to sequence as an empty result so the order of
+// the following lines is kept, the line queued takes its window slot.
+// If no line is queued, all lines in progress are with the workers, the
+// new line is dropped instead. Returns false if the watcher is stopping.
+func (w *Watcher) queueWork(text string) bool {
+	select {
+	case w.window <- struct{}{}:
+	default:
+		switch w.queuePolicy {
+		case config.QueueDropNewest:
+			w.drop(&w.lineQueue)
+			return true
+		case config.QueueDropOldest:
+			select {
+			case item := <-w.work:
+				w.drop(&w.lineQueue)
+				select {
+				case w.results <- workResult{seq: item.seq, dropped: true}:
+				case <-w.groupCtx.Done():
+					return false
+				}
+			default:
+				w.drop(&w.lineQueue)
+				return true
+			}
+		default:
+			select {
+			case w.window <- struct{}{}:
+			case <-w.groupCtx.Done():
+				return false
+			}
+		}
+	}
+
+	// the window limits lines in progress to the size of the work queue
+	w.seq++
+	select {
+	case w.work <- workItem{text: text, seq: w.seq}:
+		w.lineQueue.queued(len(w.work))
+		return true
+	case <-w.groupCtx.Done():
+		return false
+	}
+}
+
+// queueMetric queues a metric for save, applying the queue policy if the
+// queue is full. Returns false if the watcher is stopping.
+func (w *Watcher) queueMetric(m metric) bool {
+	for {
+		select {
+		case w.metrics <- m:
+			w.metricQueue.queued(len(w.metrics))
+			return true
+		default:
+		}
+		switch w.queuePolicy {
+		case config.QueueDropNewest:
+			w.drop(&w.metricQueue)
+			return true
+		case config.QueueDropOldest:
+			select {
+			case <-w.metrics:
+				w.drop(&w.metricQueue)
+			default:
+			}
+			continue
+		}
+		select {
+		case w.metrics <- m:
+			w.metricQueue.queued(len(w.metrics))
+			return true
+		case <-w.groupCtx.Done():
+			return false
+		}
+	}
+}
+
+// queueDepth returns the number of lines and metrics waiting in the
+// watcher queues.
+func (w *Watcher) queueDepth() int {
+	return len(w.work) + len(w.metricLines) + len(w.metrics)
+}
+
+// queues returns a snapshot of the watcher queues.
+func (w *Watcher) queues() []QueueStatus {
+	lines := QueueStatus{
+		Name:      QueueLines,
+		Size:      cap(w.metricLines),
+		Depth:     len(w.metricLines),
+		HighWater: atomic.LoadInt64(&w.lineQueue.highWater),
+		Dropped:   atomic.LoadUint64(&w.lineQueue.dropped),
+	}
+	if w.workers > 1 {
+		lines.Size = cap(w.work)
+		lines.Depth = len(w.work)
+	}
+	return []QueueStatus{
+		lines,
+		{
+			Name:      QueueMetrics,
+			Size:      cap(w.metrics),
+			Depth:     len(w.metrics),
+			HighWater: atomic.LoadInt64(&w.metricQueue.highWater),
+			Dropped:   atomic.LoadUint64(&w.metricQueue.dropped),
+		},
+	}
+}
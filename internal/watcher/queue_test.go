@@ -0,0 +1,227 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
+	"github.com/rs/zerolog"
+)
+
+func newQueueWatcher(t *testing.T, policy string, workers int) *Watcher {
+	t.Helper()
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	w, err := New(context.Background(), dest, &configs.Config{
+		ID:          "queue",
+		LogFile:     "queue.log",
+		QueueSize:   2,
+		QueuePolicy: policy,
+		Workers:     workers,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	return w
+}
+
+func TestQueueMetric(t *testing.T) {
+	t.Log("Testing queueMetric")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	queued := func(w *Watcher) []string {
+		var names []string
+		for len(w.metrics) > 0 {
+			names = append(names, (<-w.metrics).Name)
+		}
+		return names
+	}
+
+	t.Log("block")
+	{
+		w := newQueueWatcher(t, config.QueueBlock, 1)
+		for _, name := range []string{"a", "b"} {
+			if !w.queueMetric(metric{Name: name}) {
+				t.Fatal("expected true")
+			}
+		}
+		time.AfterFunc(50*time.Millisecond, func() { _ = w.Stop() })
+		if w.queueMetric(metric{Name: "c"}) {
+			t.Fatal("expected false, watcher stopped while blocked")
+		}
+		q := w.queues()[1]
+		if q.Name != QueueMetrics || q.Size != 2 || q.Depth != 2 || q.HighWater != 2 || q.Dropped != 0 {
+			t.Fatalf("unexpected queue status %#v", q)
+		}
+	}
+
+	t.Log("drop-newest")
+	{
+		w := newQueueWatcher(t, config.QueueDropNewest, 1)
+		for _, name := range []string{"a", "b", "c"} {
+			if !w.queueMetric(metric{Name: name}) {
+				t.Fatal("expected true")
+			}
+		}
+		if q := w.queues()[1]; q.Dropped != 1 || q.HighWater != 2 {
+			t.Fatalf("unexpected queue status %#v", q)
+		}
+		if names := queued(w); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+			t.Fatalf("expected [a b], got %v", names)
+		}
+	}
+
+	t.Log("drop-oldest")
+	{
+		w := newQueueWatcher(t, config.QueueDropOldest, 1)
+		for _, name := range []string{"a", "b", "c", "d"} {
+			if !w.queueMetric(metric{Name: name}) {
+				t.Fatal("expected true")
+			}
+		}
+		if q := w.queues()[1]; q.Dropped != 2 {
+			t.Fatalf("unexpected queue status %#v", q)
+		}
+		if names := queued(w); len(names) != 2 || names[0] != "c" || names[1] != "d" {
+			t.Fatalf("expected [c d], got %v", names)
+		}
+	}
+}
+
+func TestQueueLine(t *testing.T) {
+	t.Log("Testing queueLine")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	w := newQueueWatcher(t, config.QueueDropOldest, 1)
+	for _, line := range []string{"a", "b", "c"} {
+		if !w.queueLine(metricLine{line: line}) {
+			t.Fatal("expected true")
+		}
+	}
+	q := w.queues()[0]
+	if q.Name != QueueLines || q.Depth != 2 || q.Dropped != 1 {
+		t.Fatalf("unexpected queue status %#v", q)
+	}
+	if l := <-w.metricLines; l.line != "b" {
+		t.Fatalf("expected b, got %s", l.line)
+	}
+}
+
+func TestQueueWork(t *testing.T) {
+	t.Log("Testing queueWork")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("drop-newest")
+	{
+		w := newQueueWatcher(t, config.QueueDropNewest, 2)
+		for _, line := range []string{"a", "b", "c"} {
+			if !w.queueWork(line) {
+				t.Fatal("expected true")
+			}
+		}
+		q := w.queues()[0]
+		if q.Size != 2 || q.Depth != 2 || q.Dropped != 1 {
+			t.Fatalf("unexpected queue status %#v", q)
+		}
+	}
+
+	t.Log("drop-oldest, dropped line is sequenced")
+	{
+		w := newQueueWatcher(t, config.QueueDropOldest, 2)
+		defer func() {
+			_ = w.Stop()
+			_ = w.group.Wait()
+		}()
+		w.group.Go(w.sequence)
+		for _, line := range []string{"a", "b", "c"} {
+			if !w.queueWork(line) {
+				t.Fatal("expected true")
+			}
+		}
+		if q := w.queues()[0]; q.Depth != 2 || q.Dropped != 1 {
+			t.Fatalf("unexpected queue status %#v", q)
+		}
+		for _, expected := range []string{"b", "c"} {
+			if item := <-w.work; item.text != expected {
+				t.Fatalf("expected %s, got %s", expected, item.text)
+			}
+		}
+	}
+}
+
+func TestQueueWorkDropOldestNonBlocking(t *testing.T) {
+	t.Log("Testing queueWork drop-oldest never blocks")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	w := newQueueWatcher(t, config.QueueDropOldest, 2)
+	defer func() {
+		_ = w.Stop()
+		_ = w.group.Wait()
+	}()
+	w.group.Go(w.sequence)
+
+	queue := func(line string) {
+		t.Helper()
+		done := make(chan bool, 1)
+		go func() { done <- w.queueWork(line) }()
+		select {
+		case ok := <-done:
+			if !ok {
+				t.Fatal("expected true")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("queueWork(%s) blocked", line)
+		}
+	}
+
+	queue("a")
+	queue("b")
+	// a worker holds a, it is not sequenced until the worker finishes
+	if item := <-w.work; item.text != "a" {
+		t.Fatalf("expected a, got %s", item.text)
+	}
+	queue("c") // drops b
+	queue("d") // drops c
+	if q := w.queues()[0]; q.Depth != 1 || q.Dropped != 2 {
+		t.Fatalf("unexpected queue status %#v", q)
+	}
+	// a second worker holds d, nothing is queued to drop
+	if item := <-w.work; item.text != "d" {
+		t.Fatalf("expected d, got %s", item.text)
+	}
+	queue("e") // dropped
+	if q := w.queues()[0]; q.Depth != 0 || q.Dropped != 3 {
+		t.Fatalf("unexpected queue status %#v", q)
+	}
+
+	// once the workers finish, the window is free again
+	w.results <- workResult{seq: 1}
+	w.results <- workResult{seq: 4}
+	for i := 0; len(w.window) > 0; i++ {
+		if i == 100 {
+			t.Fatalf("expected empty window, got %d", len(w.window))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	queue("f")
+	queue("g")
+	for _, expected := range []string{"f", "g"} {
+		if item := <-w.work; item.text != expected {
+			t.Fatalf("expected %s, got %s", expected, item.text)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+)
+
+const (
+	// setReportInterval is how often set series are checked for the end
+	// of their interval.
+	setReportInterval = time.Second
+
+	// hllPrecision is the number of hash bits selecting a HyperLogLog
+	// register, 2^14 registers (16KB per series) give a standard error
+	// of about 0.8%.
+	hllPrecision = 14
+	hllRegisters = 1 << hllPrecision
+
+	// topKFactor is the number of values tracked for each of the top_k
+	// reported, the more tracked the more accurate the counts.
+	topKFactor = 4
+)
+
+// distinctCounter counts the distinct values added to it.
+type distinctCounter interface {
+	add(value string)
+	count() uint64
+}
+
+// exactSet counts distinct values exactly.
+type exactSet map[string]struct{}
+
+func (s exactSet) add(value string) {
+	s[value] = struct{}{}
+}
+
+func (s exactSet) count() uint64 {
+	return uint64(len(s))
+}
+
+// hyperLogLog estimates the number of distinct values in fixed memory.
+type hyperLogLog struct {
+	registers [hllRegisters]uint8
+}
+
+func (h *hyperLogLog) add(value string) {
+	x := hash64(value)
+	idx := x >> (64 - hllPrecision)
+	w := x<<hllPrecision | 1<<(hllPrecision-1) // bound the run of zeros
+	if rho := uint8(bits.LeadingZeros64(w)) + 1; rho > h.registers[idx] {
+		h.registers[idx] = rho
+	}
+}
+
+func (h *hyperLogLog) count() uint64 {
+	m := float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	est := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if est <= 2.5*m && zeros > 0 { // small range, linear counting
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// hash64 is FNV-1a with a final mix, so that all bits of the hash are
+// well distributed for short values.
+func hash64(value string) uint64 {
+	x := uint64(14695981039346656037)
+	for i := 0; i < len(value); i++ {
+		x ^= uint64(value[i])
+		x *= 1099511628211
+	}
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// topValues tracks the most frequent values in bounded memory (space
+// saving), when full a new value replaces the least frequent one and
+// inherits its count.
+type topValues struct {
+	counts map[string]uint64
+	size   int
+}
+
+// valueCount is a value and the number of times it was seen.
+type valueCount struct {
+	value string
+	count uint64
+}
+
+func newTopValues(k int) *topValues {
+	return &topValues{
+		counts: make(map[string]uint64, k*topKFactor),
+		size:   k * topKFactor,
+	}
+}
+
+func (t *topValues) add(value string) {
+	if c, ok := t.counts[value]; ok {
+		t.counts[value] = c + 1
+		return
+	}
+	if len(t.counts) < t.size {
+		t.counts[value] = 1
+		return
+	}
+	var minValue string
+	minCount := uint64(math.MaxUint64)
+	for v, c := range t.counts {
+		if c < minCount || (c == minCount && v < minValue) {
+			minValue, minCount = v, c
+		}
+	}
+	delete(t.counts, minValue)
+	t.counts[value] = minCount + 1
+}
+
+// top returns up to k values, most frequent first.
+func (t *topValues) top(k int) []valueCount {
+	vcs := make([]valueCount, 0, len(t.counts))
+	for v, c := range t.counts {
+		vcs = append(vcs, valueCount{value: v, count: c})
+	}
+	sort.Slice(vcs, func(i, j int) bool {
+		if vcs[i].count != vcs[j].count {
+			return vcs[i].count > vcs[j].count
+		}
+		return vcs[i].value < vcs[j].value
+	})
+	if len(vcs) > k {
+		vcs = vcs[:k]
+	}
+	return vcs
+}
+
+// setSeries counts the distinct values of a set metric (name and tags)
+// over an interval.
+type setSeries struct {
+	start    time.Time
+	distinct distinctCounter
+	top      *topValues
+	set      *configs.Set
+	name     string
+	tags     []string
+}
+
+func newSetSeries(m metric, set *configs.Set, start time.Time) *setSeries {
+	s := &setSeries{
+		start: start,
+		set:   set,
+		name:  m.Name,
+		tags:  m.Tags,
+	}
+	if set.Mode == configs.SetHLL {
+		s.distinct = &hyperLogLog{}
+	} else {
+		s.distinct = exactSet{}
+	}
+	if set.TopK > 0 {
+		s.top = newTopValues(set.TopK)
+	}
+	return s
+}
+
+// addSetValue adds the value of a set metric to its series if the rule
+// counts distinct values. Returns false if the metric should be sent to
+// the destination as a set. Event times are not used, values are counted
+// over intervals of the time they are processed.
+func (w *Watcher) addSetValue(m metric) bool {
+	set := w.cfg.Metrics[m.ruleID].Set
+	if !set.Cardinality() {
+		return false
+	}
+	key := seriesKey(m.Name, m.Tags)
+
+	w.setsMu.Lock()
+	defer w.setsMu.Unlock()
+
+	s, ok := w.sets[key]
+	if !ok {
+		s = newSetSeries(m, set, time.Now())
+		w.sets[key] = s
+	}
+	s.distinct.add(m.Value)
+	if s.top != nil {
+		s.top.add(m.Value)
+	}
+	return true
+}
+
+// reportSets sends the set series whose interval has ended, and all of
+// them when the watcher stops.
+func (w *Watcher) reportSets() error {
+	ticker := time.NewTicker(setReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.groupCtx.Done():
+			w.flushSets(time.Time{})
+			return nil
+		case now := <-ticker.C:
+			w.flushSets(now)
+		}
+	}
+}
+
+// flushSets sends and removes the set series whose interval ended by
+// now, or all of them if now is zero.
+func (w *Watcher) flushSets(now time.Time) {
+	var done []*setSeries
+
+	w.setsMu.Lock()
+	for key, s := range w.sets {
+		if now.IsZero() || now.Sub(s.start) >= s.set.Period() {
+			done = append(done, s)
+			delete(w.sets, key)
+		}
+	}
+	w.setsMu.Unlock()
+
+	for _, s := range done {
+		w.sendSet(s)
+	}
+}
+
+// sendSet sends the number of distinct values of a series as a gauge,
+// name`cardinality, and the counts of its top values as counters,
+// name`value.
+func (w *Watcher) sendSet(s *setSeries) {
+	name := s.name + "`cardinality"
+	if len(s.tags) > 0 {
+		_ = w.dest.SetGaugeValueWithTags(name, s.tags, s.distinct.count())
+	} else {
+		_ = w.dest.SetGaugeValue(name, s.distinct.count())
+	}
+	if s.top == nil {
+		return
+	}
+	for _, vc := range s.top.top(s.set.TopK) {
+		name := s.name + "`" + vc.value
+		if len(s.tags) > 0 {
+			_ = w.dest.IncrementCounterByValueWithTags(name, s.tags, vc.count)
+		} else {
+			_ = w.dest.IncrementCounterByValue(name, vc.count)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
+	"github.com/rs/zerolog"
+)
+
+// setDest records set, gauge and counter metrics.
+type setDest struct {
+	metrics.Destination
+	sent []string
+}
+
+func (d *setDest) AddSetValue(name, value string) error {
+	d.sent = append(d.sent, fmt.Sprintf("%s:%s|s", name, value))
+	return nil
+}
+
+func (d *setDest) SetGaugeValueWithTags(name string, tags []string, value interface{}) error {
+	d.sent = append(d.sent, fmt.Sprintf("%s:%v|g|%v", name, value, tags))
+	return nil
+}
+
+func (d *setDest) IncrementCounterByValueWithTags(name string, tags []string, value uint64) error {
+	d.sent = append(d.sent, fmt.Sprintf("%s:%d|c|%v", name, value, tags))
+	return nil
+}
+
+func TestHyperLogLog(t *testing.T) {
+	t.Log("Testing hyperLogLog")
+
+	for _, n := range []int{0, 10, 1000, 100000} {
+		h := &hyperLogLog{}
+		for i := 0; i < n; i++ {
+			h.add(fmt.Sprintf("user-%d", i))
+			h.add(fmt.Sprintf("user-%d", i))
+		}
+		est := float64(h.count())
+		if math.Abs(est-float64(n)) > float64(n)*0.02 {
+			t.Fatalf("expected about %d, got %.0f", n, est)
+		}
+	}
+}
+
+func TestTopValues(t *testing.T) {
+	t.Log("Testing topValues")
+
+	tv := newTopValues(2)
+	for i := 0; i < 100; i++ {
+		tv.add("a")
+		if i%2 == 0 {
+			tv.add("b")
+		}
+		tv.add(fmt.Sprintf("rare-%d", i))
+	}
+	if len(tv.counts) > 2*topKFactor {
+		t.Fatalf("expected at most %d values tracked, got %d", 2*topKFactor, len(tv.counts))
+	}
+	top := tv.top(2)
+	if len(top) != 2 || top[0] != (valueCount{"a", 100}) || top[1] != (valueCount{"b", 50}) {
+		t.Fatalf("expected [a:100 b:50], got %v", top)
+	}
+}
+
+func TestSets(t *testing.T) {
+	t.Log("Testing set cardinality")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	sd := &setDest{Destination: dest}
+	cfg := &configs.Config{
+		ID: "sets",
+		Metrics: []*configs.Metric{
+			{Type: "s", Matcher: regexp.MustCompile(`values`)},
+			{Type: "s", Matcher: regexp.MustCompile(`exact`), Set: &configs.Set{Mode: configs.SetExact, TopK: 1}},
+			{Type: "s", Matcher: regexp.MustCompile(`hll`), Set: &configs.Set{Mode: configs.SetHLL, Interval: "1m"}},
+		},
+	}
+	w, err := New(context.Background(), sd, cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if w.sets == nil {
+		t.Fatal("expected set series")
+	}
+
+	for _, v := range []string{"x", "y", "x"} {
+		w.saveMetric(metric{Name: "values", Type: "s", Value: v, ruleID: 0})
+		w.saveMetric(metric{Name: "exact", Type: "s", Value: v, Tags: []string{"a:b"}, ruleID: 1})
+		w.saveMetric(metric{Name: "hll", Type: "s", Value: v, Tags: []string{"a:b"}, ruleID: 2})
+	}
+	expected := []string{"values:x|s", "values:y|s", "values:x|s"}
+	if fmt.Sprint(sd.sent) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, sd.sent)
+	}
+
+	t.Log("interval not ended")
+	sd.sent = nil
+	w.flushSets(time.Now())
+	if len(sd.sent) != 0 || len(w.sets) != 2 {
+		t.Fatalf("expected nothing sent, got %v", sd.sent)
+	}
+
+	t.Log("interval ended")
+	w.flushSets(time.Now().Add(time.Minute))
+	sort.Strings(sd.sent)
+	expected = []string{
+		"exact`cardinality:2|g|[a:b]",
+		"exact`x:2|c|[a:b]",
+		"hll`cardinality:2|g|[a:b]",
+	}
+	if fmt.Sprint(sd.sent) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, sd.sent)
+	}
+	if len(w.sets) != 0 {
+		t.Fatalf("expected series removed, got %d", len(w.sets))
+	}
+
+	t.Log("no cardinality rules")
+	w, err = New(context.Background(), sd, &configs.Config{ID: "sets", Metrics: []*configs.Metric{{Type: "s", Matcher: regexp.MustCompile(`values`)}}})
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if w.sets != nil {
+		t.Fatal("expected no set series")
+	}
+}
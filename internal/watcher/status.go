@@ -0,0 +1,173 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"math"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/maier/go-appstats"
+)
+
+// LogStatus is a snapshot of the runtime state of a watcher.
+type LogStatus struct {
+	LastLine     *time.Time    `json:"last_line,omitempty"`
+	ID           string        `json:"id"`
+	File         string        `json:"file"`
+	State        string        `json:"state,omitempty"`
+	Rules        []RuleStatus  `json:"rules"`
+	Queues       []QueueStatus `json:"queues"`
+	Inode        uint64        `json:"inode,omitempty"`
+	Tailing      bool          `json:"tailing"`
+	Offset       int64         `json:"offset"`
+	Size         int64         `json:"size"`
+	Lag          int64         `json:"lag"`
+	LinesTotal   uint64        `json:"lines_total"`
+	LinesMatched uint64        `json:"lines_matched"`
+	Unmatched    uint64        `json:"lines_unmatched"`
+	RateLimited  uint64        `json:"lines_rate_limited"` // dropped by max_lines_per_second
+	SampledOut   uint64        `json:"lines_sampled_out"`  // not in the sample
+	TooLong      uint64        `json:"lines_too_long"`     // longer than max_line_bytes
+	Invalid      uint64        `json:"lines_invalid"`      // invalid UTF-8, replaced or skipped
+	LineErrors   uint64        `json:"line_errors"`        // returned by the tailer with an error
+	LinesPerSec  float64       `json:"lines_per_sec"`      // over the last 10s
+	QueueDepth   int           `json:"queue_depth"`        // lines and metrics waiting to be processed
+	Workers      int           `json:"workers"`
+}
+
+// RuleStatus is a snapshot of the runtime state of a metric rule.
+type RuleStatus struct {
+	LastMatch      *time.Time `json:"last_match,omitempty"`
+	Match          string     `json:"match"`
+	Name           string     `json:"name"`
+	ID             int        `json:"id"`
+	Matches        uint64     `json:"matches"`
+	ParseErrors    uint64     `json:"parse_errors"`
+	TemplateErrors uint64     `json:"template_errors"`
+	SeriesFolded   uint64     `json:"series_folded"` // folded by max_series
+}
+
+// logStats are the runtime counters for a watcher, updated atomically.
+type logStats struct {
+	rules        []ruleStats
+	lastLine     int64 // unix nano
+	offset       int64 // after the last line read from the live log, -1 if none
+	tailing      int32 // 1 while the live log is being tailed
+	linesTotal   uint64
+	linesMatched uint64
+	unmatched    uint64
+	rateLimited  uint64
+	sampledOut   uint64
+	tooLong      uint64
+	invalid      uint64
+	lineErrors   uint64
+	linesPerSec  uint64 // float64 bits
+}
+
+type ruleStats struct {
+	lastMatch      int64 // unix nano
+	matches        uint64
+	parseErrors    uint64
+	templateErrors uint64
+}
+
+func newLogStats(numRules int) *logStats {
+	return &logStats{
+		rules:  make([]ruleStats, numRules),
+		offset: -1,
+	}
+}
+
+// lineRead records a line read from the log.
+func (w *Watcher) lineRead() {
+	_ = appstats.IncrementInt(w.statTotalLines)
+	atomic.AddUint64(&w.stats.linesTotal, 1)
+	atomic.StoreInt64(&w.stats.lastLine, time.Now().UnixNano())
+}
+
+// lineUnmatched records a line which did not match any rule.
+func (w *Watcher) lineUnmatched(text string) {
+	_ = appstats.IncrementInt(w.statUnmatched)
+	atomic.AddUint64(&w.stats.unmatched, 1)
+	w.unmatched.add(text)
+}
+
+// ruleMatched records a line matching a rule.
+func (w *Watcher) ruleMatched(ruleID int) {
+	rs := &w.stats.rules[ruleID]
+	atomic.AddUint64(&rs.matches, 1)
+	atomic.StoreInt64(&rs.lastMatch, time.Now().UnixNano())
+}
+
+// parseError records a failure to extract or parse a rule value.
+func (w *Watcher) parseError(ruleID int) {
+	atomic.AddUint64(&w.stats.rules[ruleID].parseErrors, 1)
+}
+
+// templateError records a failure executing a rule name or tags template.
+func (w *Watcher) templateError(ruleID int) {
+	atomic.AddUint64(&w.stats.rules[ruleID].templateErrors, 1)
+}
+
+// Status returns a snapshot of the watcher runtime state.
+func (w *Watcher) Status() LogStatus {
+	st := LogStatus{
+		ID:           w.cfg.ID,
+		File:         w.cfg.LogFile,
+		Offset:       atomic.LoadInt64(&w.stats.offset),
+		LinesTotal:   atomic.LoadUint64(&w.stats.linesTotal),
+		LinesMatched: atomic.LoadUint64(&w.stats.linesMatched),
+		Unmatched:    atomic.LoadUint64(&w.stats.unmatched),
+		RateLimited:  atomic.LoadUint64(&w.stats.rateLimited),
+		SampledOut:   atomic.LoadUint64(&w.stats.sampledOut),
+		TooLong:      atomic.LoadUint64(&w.stats.tooLong),
+		Invalid:      atomic.LoadUint64(&w.stats.invalid),
+		LineErrors:   atomic.LoadUint64(&w.stats.lineErrors),
+		Tailing:      atomic.LoadInt32(&w.stats.tailing) == 1,
+		LinesPerSec:  math.Float64frombits(atomic.LoadUint64(&w.stats.linesPerSec)),
+		QueueDepth:   w.queueDepth(),
+		Queues:       w.queues(),
+		Workers:      w.workers,
+		Rules:        make([]RuleStatus, len(w.cfg.Metrics)),
+	}
+	st.LastLine = unixNanoTime(atomic.LoadInt64(&w.stats.lastLine))
+
+	if fi, err := os.Stat(w.cfg.LogFile); err == nil {
+		st.Inode = inode(fi)
+		st.Size = fi.Size()
+		if st.Offset >= 0 && st.Offset <= st.Size {
+			st.Lag = st.Size - st.Offset
+		}
+	}
+
+	for i, r := range w.cfg.Metrics {
+		rs := &w.stats.rules[i]
+		st.Rules[i] = RuleStatus{
+			ID:             i,
+			Match:          r.Match,
+			Name:           r.Name,
+			Matches:        atomic.LoadUint64(&rs.matches),
+			LastMatch:      unixNanoTime(atomic.LoadInt64(&rs.lastMatch)),
+			ParseErrors:    atomic.LoadUint64(&rs.parseErrors),
+			TemplateErrors: atomic.LoadUint64(&rs.templateErrors),
+		}
+		if sl := w.series[i]; sl != nil {
+			st.Rules[i].SeriesFolded = atomic.LoadUint64(&sl.folded)
+		}
+	}
+
+	return st
+}
+
+func unixNanoTime(ns int64) *time.Time {
+	if ns == 0 {
+		return nil
+	}
+	t := time.Unix(0, ns)
+	return &t
+}
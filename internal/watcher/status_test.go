@@ -0,0 +1,105 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/report"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestStatus(t *testing.T) {
+	t.Log("Testing Status")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyLogConfDir, "testdata")
+	defer viper.Reset()
+	cfgs, err := configs.Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	if err := ioutil.WriteFile(logFile, []byte("testcounter\ntestcounter\nhist 1.2.3\nnomatch\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	dest, err := report.New(&bytes.Buffer{}, report.FormatJSON, time.Minute)
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	w, err := New(context.Background(), dest, cfgs[0])
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	t.Log("before processing")
+	{
+		st := w.Status()
+		if st.ID != "test" {
+			t.Fatalf("expected id test, got %s", st.ID)
+		}
+		if st.LinesTotal != 0 || st.LastLine != nil {
+			t.Fatalf("expected no lines, got %#v", st)
+		}
+		if st.Offset != -1 {
+			t.Fatalf("expected offset -1, got %d", st.Offset)
+		}
+		if len(st.Rules) != len(cfgs[0].Metrics) {
+			t.Fatalf("expected %d rules, got %d", len(cfgs[0].Metrics), len(st.Rules))
+		}
+	}
+
+	if err := w.Backfill([]string{logFile}); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	t.Log("after processing")
+	{
+		st := w.Status()
+		if st.LinesTotal != 4 {
+			t.Fatalf("expected 4 lines, got %d", st.LinesTotal)
+		}
+		if st.LinesMatched != 3 {
+			t.Fatalf("expected 3 matched lines, got %d", st.LinesMatched)
+		}
+		if st.LastLine == nil {
+			t.Fatal("expected last line time")
+		}
+		counter := st.Rules[0]
+		if counter.Matches != 2 || counter.LastMatch == nil || counter.ParseErrors != 0 {
+			t.Fatalf("expected 2 matches, got %#v", counter)
+		}
+		hist := st.Rules[5]
+		if hist.Name != "{{.Name}}" || hist.Matches != 1 || hist.ParseErrors != 1 {
+			t.Fatalf("expected 1 match with a parse error, got %#v", hist)
+		}
+		if st.Rules[1].Matches != 0 || st.Rules[1].LastMatch != nil {
+			t.Fatalf("expected no matches, got %#v", st.Rules[1])
+		}
+	}
+
+	t.Log("series folded")
+	{
+		w.series[0] = newSeriesLimiter(1, "", nil)
+		for _, tag := range []string{"path:/a", "path:/b", "path:/c"} {
+			_, _, _, _ = w.series[0].limit("testcounter", []string{"log_id:test", tag}, 1)
+		}
+		if folded := w.Status().Rules[0].SeriesFolded; folded != 2 {
+			t.Fatalf("expected 2 series folded, got %d", folded)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/nxadm/tail"
+)
+
+// tailState tracks the position in the live log across tail restarts.
+type tailState struct {
+	checkpoints <-chan time.Time
+	file        os.FileInfo // log file the last line was read from
+	offset      int64       // offset after the last line read, -1 if none
+}
+
+// stat records the identity of the log file currently being tailed.
+func (ts *tailState) stat(logFile string) {
+	fi, err := os.Stat(logFile)
+	if err != nil {
+		ts.file = nil
+		return
+	}
+	ts.file = fi
+}
+
+// read records the offset of a line, the log file is identified again
+// if it had not been created yet or has been reopened (offset went back).
+func (ts *tailState) read(logFile string, offset int64) {
+	if ts.file == nil || offset < ts.offset {
+		ts.stat(logFile)
+	}
+	ts.offset = offset
+}
+
+// restartLocation returns where a restarted tail should start. If the
+// log is the same file it continues from the last line read (or the end,
+// if no lines were read). Otherwise the log was rotated, truncated or
+// (re)created while the tailer was down and it starts at the beginning.
+func (ts *tailState) restartLocation(logFile string) *tail.SeekInfo {
+	fi, err := os.Stat(logFile)
+	if err == nil && ts.file != nil && os.SameFile(ts.file, fi) {
+		if ts.offset < 0 {
+			return &tail.SeekInfo{Offset: 0, Whence: io.SeekEnd}
+		}
+		if fi.Size() >= ts.offset {
+			return &tail.SeekInfo{Offset: ts.offset, Whence: io.SeekStart}
+		}
+	}
+	ts.file = nil
+	ts.offset = -1
+	return &tail.SeekInfo{Offset: 0, Whence: io.SeekStart}
+}
+
+// pollMode reports whether the log should be polled for changes rather
+// than using inotify. auto uses inotify on Linux and polling elsewhere.
+func (w *Watcher) pollMode() bool {
+	switch w.cfg.Watch {
+	case configs.WatchPoll:
+		return true
+	case configs.WatchInotify:
+		return false
+	}
+	return runtime.GOOS != "linux"
+}
+
+// watchError reports whether a tailer error was caused by the inotify
+// file watcher (e.g. the per-user watch or instance limit was reached).
+func watchError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"inotify", "no space left on device", "too many open files"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+)
+
+func TestRestartLocation(t *testing.T) {
+	t.Log("Testing restartLocation")
+
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "test.log")
+	if err := ioutil.WriteFile(logFile, []byte("line 1\nline 2\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	t.Log("no lines read")
+	{
+		ts := &tailState{offset: -1}
+		ts.stat(logFile)
+		loc := ts.restartLocation(logFile)
+		if loc.Whence != io.SeekEnd {
+			t.Fatalf("expected end, got %#v", loc)
+		}
+	}
+
+	t.Log("same file")
+	{
+		ts := &tailState{offset: -1}
+		ts.read(logFile, 7)
+		loc := ts.restartLocation(logFile)
+		if loc.Whence != io.SeekStart || loc.Offset != 7 {
+			t.Fatalf("expected offset 7, got %#v", loc)
+		}
+	}
+
+	t.Log("truncated")
+	{
+		ts := &tailState{offset: -1}
+		ts.read(logFile, 100)
+		loc := ts.restartLocation(logFile)
+		if loc.Whence != io.SeekStart || loc.Offset != 0 {
+			t.Fatalf("expected beginning, got %#v", loc)
+		}
+	}
+
+	t.Log("rotated")
+	{
+		ts := &tailState{offset: -1}
+		ts.read(logFile, 7)
+		if err := os.Rename(logFile, logFile+".1"); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if err := ioutil.WriteFile(logFile, []byte("line 3\nline 4\nline 5\n"), 0600); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		loc := ts.restartLocation(logFile)
+		if loc.Whence != io.SeekStart || loc.Offset != 0 {
+			t.Fatalf("expected beginning, got %#v", loc)
+		}
+		if ts.offset != -1 || ts.file != nil {
+			t.Fatalf("expected state reset, got %#v", ts)
+		}
+	}
+
+	t.Log("missing")
+	{
+		ts := &tailState{offset: -1}
+		ts.read(logFile, 7)
+		loc := ts.restartLocation(filepath.Join(dir, "missing.log"))
+		if loc.Whence != io.SeekStart || loc.Offset != 0 {
+			t.Fatalf("expected beginning, got %#v", loc)
+		}
+	}
+}
+
+func TestPollMode(t *testing.T) {
+	t.Log("Testing pollMode")
+
+	w := &Watcher{cfg: &configs.Config{}}
+
+	w.cfg.Watch = configs.WatchPoll
+	if !w.pollMode() {
+		t.Fatal("expected poll")
+	}
+
+	w.cfg.Watch = configs.WatchInotify
+	if w.pollMode() {
+		t.Fatal("expected inotify")
+	}
+
+	w.cfg.Watch = configs.WatchAuto
+	if w.pollMode() != (runtime.GOOS != "linux") {
+		t.Fatalf("expected inotify on linux only (%s)", runtime.GOOS)
+	}
+}
+
+func TestWatchError(t *testing.T) {
+	t.Log("Testing watchError")
+
+	tests := []struct {
+		err    error
+		expect bool
+	}{
+		{nil, false},
+		{errors.New("file already closed"), false},
+		{errors.New("inotify watcher closed"), true},
+		{errors.New("no space left on device"), true},
+		{errors.New("too many open files"), true},
+	}
+
+	for _, tst := range tests {
+		if got := watchError(tst.err); got != tst.expect {
+			t.Fatalf("%v expected %v, got %v", tst.err, tst.expect, got)
+		}
+	}
+}
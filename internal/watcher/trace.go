@@ -0,0 +1,187 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Trace event types.
+const (
+	TraceLine   = "line"   // line read from the log
+	TraceMetric = "metric" // metric extracted from a line matching a rule
+	TraceDrop   = "drop"   // line matched a rule but no metric was produced
+)
+
+const (
+	traceQueueSize     = 100
+	traceDefaultRate   = 10
+	traceDefaultSample = 1
+)
+
+// TraceOptions select the events sent to a trace subscriber.
+type TraceOptions struct {
+	Rule   int     // rule id, -1 for all lines and rules
+	Rate   float64 // maximum events per second
+	Sample int     // send 1 in Sample events
+}
+
+// TraceEvent is a line or rule evaluation sent to trace subscribers.
+type TraceEvent struct {
+	Time    time.Time    `json:"time"`
+	Rule    *int         `json:"rule,omitempty"`
+	Metric  *TracedValue `json:"metric,omitempty"`
+	Type    string       `json:"type"`
+	Line    string       `json:"line"`
+	Dropped uint64       `json:"dropped,omitempty"` // events not sent since the previous event
+}
+
+// TracedValue is the metric extracted from a traced line.
+type TracedValue struct {
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	Value     string     `json:"value"`
+	Tags      []string   `json:"tags"`
+}
+
+// traceSub is a trace subscriber, events are rate limited with a token
+// bucket (burst of one second) and sampled before being queued.
+type traceSub struct {
+	events  chan TraceEvent
+	last    time.Time
+	tokens  float64
+	opts    TraceOptions
+	seen    uint64
+	dropped uint64
+	sync.Mutex
+}
+
+// offer queues the event if it passes sampling and rate limiting and the
+// subscriber is keeping up.
+func (s *traceSub) offer(ev TraceEvent) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.seen++
+	if s.seen%uint64(s.opts.Sample) != 0 {
+		return
+	}
+
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * s.opts.Rate
+	if s.tokens > s.opts.Rate {
+		s.tokens = s.opts.Rate
+	}
+	s.last = now
+	if s.tokens < 1 {
+		s.dropped++
+		return
+	}
+
+	ev.Dropped = s.dropped
+	select {
+	case s.events <- ev:
+		s.tokens--
+		s.dropped = 0
+	default:
+		s.dropped++
+	}
+}
+
+// Trace subscribes to live trace events for the log until ctx is done or
+// the watcher stops, at which point the returned channel is closed.
+// Tracing has no cost while there are no subscribers.
+func (w *Watcher) Trace(ctx context.Context, opts TraceOptions) (<-chan TraceEvent, error) {
+	if opts.Rule < -1 || opts.Rule >= len(w.cfg.Metrics) {
+		return nil, fmt.Errorf("invalid rule id (%d)", opts.Rule)
+	}
+	if opts.Rate <= 0 {
+		opts.Rate = traceDefaultRate
+	}
+	if opts.Sample <= 0 {
+		opts.Sample = traceDefaultSample
+	}
+
+	sub := &traceSub{
+		events: make(chan TraceEvent, traceQueueSize),
+		opts:   opts,
+		tokens: opts.Rate,
+		last:   time.Now(),
+	}
+
+	w.traceMu.Lock()
+	w.traceSubs = append(w.traceSubs, sub)
+	atomic.StoreInt32(&w.tracing, int32(len(w.traceSubs)))
+	w.traceMu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.ctx.Done():
+		}
+		w.traceMu.Lock()
+		for i, s := range w.traceSubs {
+			if s == sub {
+				w.traceSubs = append(w.traceSubs[:i], w.traceSubs[i+1:]...)
+				break
+			}
+		}
+		atomic.StoreInt32(&w.tracing, int32(len(w.traceSubs)))
+		close(sub.events)
+		w.traceMu.Unlock()
+	}()
+
+	return sub.events, nil
+}
+
+// traceLine sends a line read from the log to subscribers of all rules.
+func (w *Watcher) traceLine(text string) {
+	if atomic.LoadInt32(&w.tracing) == 0 {
+		return
+	}
+	w.emit(-1, TraceEvent{Type: TraceLine, Line: text})
+}
+
+// traceParse sends the result of parsing a matched line to subscribers.
+func (w *Watcher) traceParse(l metricLine, m metric, ok bool) {
+	if atomic.LoadInt32(&w.tracing) == 0 {
+		return
+	}
+	rule := l.metricID
+	ev := TraceEvent{Type: TraceDrop, Line: l.line, Rule: &rule}
+	if ok {
+		ev.Type = TraceMetric
+		ev.Metric = &TracedValue{
+			Name:  m.Name,
+			Type:  m.Type,
+			Value: m.Value,
+			Tags:  m.Tags,
+		}
+		if !m.Timestamp.IsZero() {
+			ts := m.Timestamp
+			ev.Metric.Timestamp = &ts
+		}
+	}
+	w.emit(rule, ev)
+}
+
+// emit offers the event to subscribers of the rule (-1 for line events,
+// which are only sent to subscribers of all rules).
+func (w *Watcher) emit(rule int, ev TraceEvent) {
+	ev.Time = time.Now()
+	w.traceMu.Lock()
+	defer w.traceMu.Unlock()
+	for _, s := range w.traceSubs {
+		if s.opts.Rule == -1 || (rule != -1 && s.opts.Rule == rule) {
+			s.offer(ev)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestTrace(t *testing.T) {
+	t.Log("Testing Trace")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyLogConfDir, "testdata")
+	defer viper.Reset()
+	cfgs, err := configs.Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	w, err := New(context.Background(), dest, cfgs[0])
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	ml := metricLine{line: "testcounter", metricID: 0}
+
+	t.Log("invalid rule")
+	{
+		if _, err := w.Trace(context.Background(), TraceOptions{Rule: len(cfgs[0].Metrics)}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("all rules")
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		events, err := w.Trace(ctx, TraceOptions{Rule: -1})
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		w.traceLine("testcounter")
+		m, ok := w.parseLine(ml)
+		w.traceParse(ml, m, ok)
+		w.traceParse(metricLine{line: "hist 1.2.3", metricID: 5}, metric{}, false)
+
+		ev := <-events
+		if ev.Type != TraceLine || ev.Line != "testcounter" || ev.Rule != nil {
+			t.Fatalf("unexpected event %#v", ev)
+		}
+		ev = <-events
+		if ev.Type != TraceMetric || *ev.Rule != 0 || ev.Metric == nil || ev.Metric.Name != "counter1" || ev.Metric.Value != "1" {
+			t.Fatalf("unexpected event %#v", ev)
+		}
+		ev = <-events
+		if ev.Type != TraceDrop || *ev.Rule != 5 || ev.Metric != nil {
+			t.Fatalf("unexpected event %#v", ev)
+		}
+
+		cancel()
+		select {
+		case _, ok := <-events:
+			if ok {
+				t.Fatal("expected closed channel")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("trace not stopped")
+		}
+		if n := atomic.LoadInt32(&w.tracing); n != 0 {
+			t.Fatalf("expected tracing disabled, got %d", n)
+		}
+	}
+
+	t.Log("single rule, sampled")
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := w.Trace(ctx, TraceOptions{Rule: 0, Sample: 2})
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		w.traceLine("testcounter")
+		w.traceParse(metricLine{line: "hist 1.2.3", metricID: 5}, metric{}, false)
+		for i := 0; i < 4; i++ {
+			w.traceParse(ml, metric{Name: "counter1"}, true)
+		}
+
+		if n := len(events); n != 2 {
+			t.Fatalf("expected 2 events, got %d", n)
+		}
+	}
+
+	t.Log("rate limited")
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := w.Trace(ctx, TraceOptions{Rule: -1, Rate: 2})
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		for i := 0; i < 5; i++ {
+			w.traceLine("testcounter")
+		}
+
+		if n := len(events); n != 2 {
+			t.Fatalf("expected 2 events, got %d", n)
+		}
+	}
+}
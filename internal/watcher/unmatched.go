@@ -0,0 +1,138 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	unmatchedSampleSize  = 100  // reservoir sample of unmatched lines
+	unmatchedMaxPatterns = 1000 // distinct patterns tracked per log
+	unmatchedMaxLineLen  = 1024 // longer lines are truncated in the sample and patterns
+)
+
+var (
+	hexRe   = regexp.MustCompile(`\b(?:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|0[xX][0-9a-fA-F]+|[0-9a-fA-F]{8,})\b`)
+	digitRe = regexp.MustCompile(`[0-9]+`)
+)
+
+// UnmatchedReport describes the lines which did not match any rule.
+type UnmatchedReport struct {
+	Samples  []string           `json:"samples"`  // random sample of unmatched lines
+	Patterns []UnmatchedPattern `json:"patterns"` // most common line shapes, most frequent first
+	Total    uint64             `json:"total"`    // lines which did not match any rule
+	Lines    uint64             `json:"lines"`    // lines read
+	Other    uint64             `json:"other"`    // unmatched lines with a shape not tracked (pattern limit reached)
+}
+
+// UnmatchedPattern is a line shape, with hex and digits masked.
+type UnmatchedPattern struct {
+	Pattern string `json:"pattern"`
+	Example string `json:"example"`
+	Count   uint64 `json:"count"`
+}
+
+// unmatched tracks lines which did not match any rule.
+type unmatched struct {
+	patterns map[string]*UnmatchedPattern
+	samples  []string
+	total    uint64
+	other    uint64
+	sync.Mutex
+}
+
+func newUnmatched() *unmatched {
+	return &unmatched{
+		patterns: make(map[string]*UnmatchedPattern),
+		samples:  make([]string, 0, unmatchedSampleSize),
+	}
+}
+
+// add records an unmatched line in the reservoir sample and its pattern.
+func (u *unmatched) add(line string) {
+	if len(line) > unmatchedMaxLineLen {
+		line = line[:unmatchedMaxLineLen]
+	}
+	pattern := maskLine(line)
+
+	u.Lock()
+	defer u.Unlock()
+
+	u.total++
+	if len(u.samples) < unmatchedSampleSize {
+		u.samples = append(u.samples, line)
+	} else if i := rand.Int63n(int64(u.total)); i < unmatchedSampleSize { //nolint:gosec
+		u.samples[i] = line
+	}
+
+	if p, ok := u.patterns[pattern]; ok {
+		p.Count++
+		return
+	}
+	if len(u.patterns) >= unmatchedMaxPatterns {
+		u.other++
+		return
+	}
+	u.patterns[pattern] = &UnmatchedPattern{Pattern: pattern, Example: line, Count: 1}
+}
+
+// report returns the sample and the top (all if 0) most common patterns.
+func (u *unmatched) report(top int) UnmatchedReport {
+	u.Lock()
+	defer u.Unlock()
+
+	r := UnmatchedReport{
+		Total:    u.total,
+		Other:    u.other,
+		Samples:  make([]string, len(u.samples)),
+		Patterns: make([]UnmatchedPattern, 0, len(u.patterns)),
+	}
+	copy(r.Samples, u.samples)
+	for _, p := range u.patterns {
+		r.Patterns = append(r.Patterns, *p)
+	}
+	sort.Slice(r.Patterns, func(i, j int) bool {
+		if r.Patterns[i].Count != r.Patterns[j].Count {
+			return r.Patterns[i].Count > r.Patterns[j].Count
+		}
+		return r.Patterns[i].Pattern < r.Patterns[j].Pattern
+	})
+	if top > 0 && len(r.Patterns) > top {
+		r.Patterns = r.Patterns[:top]
+	}
+	return r
+}
+
+// maskLine replaces hex values (0x prefixed, 8+ hex digits and UUIDs)
+// with <hex> and runs of digits with <n>, so lines differing only in
+// ids, counts, times, addresses, etc. share a pattern.
+func maskLine(line string) string {
+	line = hexRe.ReplaceAllStringFunc(line, func(s string) string {
+		if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") || strings.Contains(s, "-") {
+			return "<hex>"
+		}
+		// a word (e.g. "deadbeef") or a number, masked below
+		if strings.IndexAny(s, "0123456789") < 0 || strings.IndexAny(s, "abcdefABCDEF") < 0 {
+			return s
+		}
+		return "<hex>"
+	})
+	return digitRe.ReplaceAllString(line, "<n>")
+}
+
+// Unmatched returns a report of the lines which did not match any rule,
+// with the top (all if 0) most common patterns.
+func (w *Watcher) Unmatched(top int) UnmatchedReport {
+	r := w.unmatched.report(top)
+	r.Lines = atomic.LoadUint64(&w.stats.linesTotal)
+	return r
+}
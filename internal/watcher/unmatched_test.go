@@ -0,0 +1,125 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestMaskLine(t *testing.T) {
+	t.Log("Testing maskLine")
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"GET /health 200 3ms", "GET /health <n> <n>ms"},
+		{"request 6f1c2b9a-1d2e-4f3a-9b8c-7d6e5f4a3b2c done", "request <hex> done"},
+		{"ptr 0x7ffe3a2b freed", "ptr <hex> freed"},
+		{"commit 3f2a9c1d8e7b pushed", "commit <hex> pushed"},
+		{"id 12345678 deadbeef facade", "id <n> deadbeef facade"},
+		{"client 10.1.2.3:5432 connected", "client <n>.<n>.<n>.<n>:<n> connected"},
+		{"no variables here", "no variables here"},
+	}
+
+	for _, tst := range tests {
+		if got := maskLine(tst.line); got != tst.expected {
+			t.Errorf("%q: expected %q, got %q", tst.line, tst.expected, got)
+		}
+	}
+}
+
+func TestUnmatched(t *testing.T) {
+	t.Log("Testing unmatched")
+
+	t.Log("reservoir sample and top patterns")
+	{
+		u := newUnmatched()
+		for i := 0; i < 1000; i++ {
+			u.add(fmt.Sprintf("connection %d closed", i))
+		}
+		for i := 0; i < 10; i++ {
+			u.add(fmt.Sprintf("cache miss key=%x", 0xabcdef00+i))
+		}
+		u.add("shutting down")
+
+		r := u.report(2)
+		if r.Total != 1011 {
+			t.Fatalf("expected 1011 unmatched, got %d", r.Total)
+		}
+		if len(r.Samples) != unmatchedSampleSize {
+			t.Fatalf("expected %d samples, got %d", unmatchedSampleSize, len(r.Samples))
+		}
+		if len(r.Patterns) != 2 {
+			t.Fatalf("expected 2 patterns, got %d", len(r.Patterns))
+		}
+		if p := r.Patterns[0]; p.Pattern != "connection <n> closed" || p.Count != 1000 || p.Example != "connection 0 closed" {
+			t.Fatalf("unexpected pattern %#v", p)
+		}
+		if p := r.Patterns[1]; p.Pattern != "cache miss key=<hex>" || p.Count != 10 {
+			t.Fatalf("unexpected pattern %#v", p)
+		}
+		if n := len(u.report(0).Patterns); n != 3 {
+			t.Fatalf("expected 3 patterns, got %d", n)
+		}
+	}
+
+	t.Log("pattern limit")
+	{
+		u := newUnmatched()
+		for i := 0; i < unmatchedMaxPatterns+5; i++ {
+			u.add("line " + strings.Repeat("x", i+1))
+		}
+		r := u.report(0)
+		if len(r.Patterns) != unmatchedMaxPatterns || r.Other != 5 {
+			t.Fatalf("expected %d patterns and 5 other, got %d and %d", unmatchedMaxPatterns, len(r.Patterns), r.Other)
+		}
+	}
+
+	t.Log("watcher")
+	{
+		zerolog.SetGlobalLevel(zerolog.Disabled)
+		viper.Set(config.KeyLogConfDir, "testdata")
+		defer viper.Reset()
+		cfgs, err := configs.Load()
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		dest, err := logonly.New()
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		w, err := New(context.Background(), dest, cfgs[0])
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+
+		for _, line := range []string{"testcounter", "gaugeint 0", "nomatch 1", "nomatch 2"} {
+			w.lineRead()
+			w.matchLine(line)
+		}
+
+		r := w.Unmatched(0)
+		if r.Lines != 4 || r.Total != 2 {
+			t.Fatalf("expected 2 of 4 lines unmatched, got %d of %d", r.Total, r.Lines)
+		}
+		if len(r.Patterns) != 1 || r.Patterns[0].Pattern != "nomatch <n>" {
+			t.Fatalf("unexpected patterns %#v", r.Patterns)
+		}
+		if n := w.Status().Unmatched; n != 2 {
+			t.Fatalf("expected 2 unmatched in status, got %d", n)
+		}
+	}
+}
@@ -13,11 +13,16 @@ import (
 	"io"
 	"io/ioutil"
 	stdlog "log"
+	"math"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/config/defaults"
 	"github.com/circonus-labs/circonus-logwatch/internal/configs"
 	"github.com/circonus-labs/circonus-logwatch/internal/metrics"
 	"github.com/maier/go-appstats"
@@ -29,16 +34,21 @@ import (
 )
 
 type metric struct {
-	Name  string
-	Type  string
-	Value string
-	Tags  []string
+	Timestamp  time.Time
+	Name       string
+	Type       string
+	Value      string
+	Tags       []string
+	ruleID     int
+	sampleRate int // 1 in sampleRate lines were processed (0 or 1 not sampled)
 }
 
 type metricLine struct {
-	matches  *map[string]string
-	line     string
-	metricID int
+	ts         time.Time
+	line       string
+	loc        []int // submatch index pairs, nil if the rule has no named subexpressions
+	metricID   int
+	sampleRate int
 }
 
 // Watcher defines a new log watcher.
@@ -46,20 +56,64 @@ type Watcher struct {
 	ctx              context.Context
 	groupCtx         context.Context
 	dest             metrics.Destination
+	tsDest           metrics.TimestampDestination
+	tsSetDest        metrics.TimestampSetDestination
+	sampledDest      metrics.SampledDestination
+	limiter          *rateLimiter
 	ctxCancel        context.CancelFunc
 	group            *errgroup.Group
 	cfg              *configs.Config
 	metricLines      chan metricLine
 	metrics          chan metric
+	series           []*seriesLimiter
+	stats            *logStats
+	unmatched        *unmatched
+	engine           *engine
+	work             chan workItem
+	results          chan workResult
+	window           chan struct{} // lines dispatched to workers and not yet sequenced
+	lineQueue        queueStats
+	metricQueue      queueStats
+	traceSubs        []*traceSub
+	sets             map[string]*setSeries // series of rules counting distinct set values, nil if none
+	derived          []*derivedWindow      // nil if the log config has no derived metrics
+	derivedRefs      [][]*derivedWindow    // derived metrics referencing each rule
+	reloadables      []reloadable          // lookup tables and IP classifiers
 	statMatchedLines string
 	statTotalLines   string
+	statFoldedSeries string
+	statStaleLines   string
+	statUnmatched    string
+	statTSErrors     string
+	statTailRestarts string
+	statLinesPerSec  string
+	statQueueDepth   string
+	statQueueHigh    string
+	statQueueDropped string
+	statRateLimited  string
+	statSampledOut   string
+	statTooLong      string
+	statInvalid      string
+	statLineErrors   string
+	statLookupReload string
+	statLookupErrors string
+	queuePolicy      string
+	stateFile        string
 	logger           zerolog.Logger
+	traceMu          sync.Mutex
+	setsMu           sync.Mutex
+	derivedMu        sync.Mutex
+	seq              uint64 // last line dispatched to workers
+	sampleCount      uint64 // lines considered for line sampling
+	workers          int
+	tracing          int32 // number of trace subscribers
 	trace            bool
+	backfill         bool
 }
 
 const (
-	metricLineQueueSize = 1000
-	metricQueueSize     = 1000
+	checkpointInterval = 10 * time.Second
+	tailRestartDelay   = time.Second
 )
 
 // New creates a new watcher instance.
@@ -70,6 +124,10 @@ func New(ctx context.Context, metricDest metrics.Destination, logConfig *configs
 	if logConfig == nil {
 		return nil, errors.New("invalid log config (nil)")
 	}
+	queueSize := logConfig.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaults.QueueSize
+	}
 	tctx, cancel := context.WithCancel(ctx)
 	g, gctx := errgroup.WithContext(tctx)
 	w := Watcher{
@@ -80,15 +138,96 @@ func New(ctx context.Context, metricDest metrics.Destination, logConfig *configs
 		logger:           log.With().Str("pkg", "watcher").Str("log_id", logConfig.ID).Logger(),
 		cfg:              logConfig,
 		dest:             metricDest,
-		metricLines:      make(chan metricLine, metricLineQueueSize),
-		metrics:          make(chan metric, metricQueueSize),
+		metricLines:      make(chan metricLine, queueSize),
+		metrics:          make(chan metric, queueSize),
+		queuePolicy:      logConfig.QueuePolicy,
 		trace:            viper.GetBool(config.KeyDebugMetric),
 		statMatchedLines: logConfig.ID + "_lines_matched",
 		statTotalLines:   logConfig.ID + "_lines_total",
+		statFoldedSeries: logConfig.ID + "_series_folded",
+		statStaleLines:   logConfig.ID + "_lines_stale",
+		statUnmatched:    logConfig.ID + "_lines_unmatched",
+		statTSErrors:     logConfig.ID + "_timestamp_errors",
+		statTailRestarts: logConfig.ID + "_tail_restarts",
+		statLinesPerSec:  logConfig.ID + "_lines_per_sec",
+		statQueueDepth:   logConfig.ID + "_queue_depth",
+		statQueueHigh:    logConfig.ID + "_queue_high_water",
+		statQueueDropped: logConfig.ID + "_queue_dropped",
+		statRateLimited:  logConfig.ID + "_lines_rate_limited",
+		statSampledOut:   logConfig.ID + "_lines_sampled_out",
+		statTooLong:      logConfig.ID + "_lines_too_long",
+		statInvalid:      logConfig.ID + "_lines_invalid",
+		statLineErrors:   logConfig.ID + "_line_errors",
+		statLookupReload: logConfig.ID + "_lookup_reloads",
+		statLookupErrors: logConfig.ID + "_lookup_errors",
+		series:           make([]*seriesLimiter, len(logConfig.Metrics)),
+		stats:            newLogStats(len(logConfig.Metrics)),
+		unmatched:        newUnmatched(),
+		engine:           newEngine(logConfig.Metrics),
+		workers:          logConfig.Workers,
+	}
+
+	if w.queuePolicy == "" {
+		w.queuePolicy = defaults.QueuePolicy
+	}
+
+	if w.workers > 1 {
+		w.work = make(chan workItem, queueSize)
+		w.results = make(chan workResult, queueSize)
+		w.window = make(chan struct{}, queueSize)
+	}
+
+	if dir := viper.GetString(config.KeyStateDir); dir != "" {
+		w.stateFile = filepath.Join(dir, logConfig.ID+".json")
 	}
 
+	if td, ok := metricDest.(metrics.TimestampDestination); ok {
+		w.tsDest = td
+		if sd, ok := metricDest.(metrics.TimestampSetDestination); ok {
+			w.tsSetDest = sd
+		}
+	}
+
+	if sd, ok := metricDest.(metrics.SampledDestination); ok {
+		w.sampledDest = sd
+	}
+
+	if logConfig.MaxLinesPerSecond > 0 {
+		w.limiter = newRateLimiter(float64(logConfig.MaxLinesPerSecond))
+	}
+
+	for id, r := range logConfig.Metrics {
+		if r.MaxSeries > 0 {
+			w.series[id] = newSeriesLimiter(r.MaxSeries, overflowName(r), overflowTags(r))
+		}
+		if r.Set.Cardinality() && w.sets == nil {
+			w.sets = make(map[string]*setSeries)
+		}
+	}
+
+	w.derived, w.derivedRefs = newDerived(logConfig, time.Now())
+	w.reloadables = w.newReloadables()
+
 	_ = appstats.NewInt(w.statMatchedLines)
 	_ = appstats.NewInt(w.statTotalLines)
+	_ = appstats.NewInt(w.statFoldedSeries)
+	_ = appstats.NewInt(w.statStaleLines)
+	_ = appstats.NewInt(w.statUnmatched)
+	_ = appstats.NewInt(w.statTSErrors)
+	_ = appstats.NewInt(w.statTailRestarts)
+	_ = appstats.NewFloat(w.statLinesPerSec)
+	_ = appstats.NewInt(w.statQueueDepth)
+	_ = appstats.NewInt(w.statQueueHigh)
+	_ = appstats.NewInt(w.statQueueDropped)
+	_ = appstats.NewInt(w.statRateLimited)
+	_ = appstats.NewInt(w.statSampledOut)
+	_ = appstats.NewInt(w.statTooLong)
+	_ = appstats.NewInt(w.statInvalid)
+	_ = appstats.NewInt(w.statLineErrors)
+	if len(w.reloadables) > 0 {
+		_ = appstats.NewInt(w.statLookupReload)
+		_ = appstats.NewInt(w.statLookupErrors)
+	}
 
 	return &w, nil
 }
@@ -96,7 +235,24 @@ func New(ctx context.Context, metricDest metrics.Destination, logConfig *configs
 // Start the watcher.
 func (w *Watcher) Start() error {
 	w.group.Go(w.save)
-	w.group.Go(w.parse)
+	if w.workers > 1 {
+		for i := 0; i < w.workers; i++ {
+			w.group.Go(w.match)
+		}
+		w.group.Go(w.sequence)
+	} else {
+		w.group.Go(w.parse)
+	}
+	w.group.Go(w.throughput)
+	if w.sets != nil {
+		w.group.Go(w.reportSets)
+	}
+	if w.derived != nil {
+		w.group.Go(w.reportDerived)
+	}
+	if len(w.reloadables) > 0 {
+		w.group.Go(w.reloadLookups)
+	}
 	w.group.Go(w.process)
 
 	go func() {
@@ -121,7 +277,7 @@ func (w *Watcher) process() error {
 	cfg := tail.Config{
 		Follow:    true,
 		ReOpen:    true,
-		Poll:      true,
+		Poll:      w.pollMode(),
 		MustExist: false,
 		Location: &tail.SeekInfo{
 			Offset: 0,
@@ -134,28 +290,85 @@ func (w *Watcher) process() error {
 		cfg.Logger = stdlog.New(w.logger.With().Str("pkg", "tail").Logger(), "", 0)
 	}
 
-START_TAIL:
-	w.logger.Debug().Msg("starting tail")
-	tailer, err := tail.TailFile(w.cfg.LogFile, cfg)
-	if err != nil {
-		w.logger.Error().Err(err).Msg("starting tailer")
-		return err
+	ts := &tailState{offset: -1}
+
+	// with checkpoints enabled, finish any unread lines (including those
+	// in rotated files) before resuming the live log
+	if w.stateFile != "" {
+		if loc := w.resume(); loc != nil {
+			cfg.Location = loc
+		}
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+		ts.checkpoints = ticker.C
+		defer func() {
+			if ts.offset >= 0 {
+				if err := w.saveCheckpoint(ts.offset); err != nil {
+					w.logger.Warn().Err(err).Msg("saving checkpoint")
+				}
+			}
+		}()
 	}
 
-	w.logger.Debug().Msg("tail started, waiting for lines")
+	for {
+		w.logger.Debug().Bool("poll", cfg.Poll).Msg("starting tail")
+		tailer, err := tail.TailFile(w.cfg.LogFile, cfg)
+		if err != nil {
+			w.logger.Error().Err(err).Msg("starting tailer")
+			return err
+		}
+		ts.stat(w.cfg.LogFile)
+
+		w.logger.Debug().Msg("tail started, waiting for lines")
+		atomic.StoreInt32(&w.stats.tailing, 1)
+		restart, err := w.follow(tailer, ts)
+		atomic.StoreInt32(&w.stats.tailing, 0)
+		if !restart {
+			return err
+		}
+
+		// the tailer died, most often the file watcher was closed while
+		// the reopener was waiting for the log to be (re)created
+		_ = appstats.IncrementInt(w.statTailRestarts)
+		if !cfg.Poll && w.cfg.Watch == configs.WatchAuto && watchError(err) {
+			w.logger.Warn().Err(err).Msg("inotify unavailable, falling back to polling")
+			cfg.Poll = true
+		} else {
+			w.logger.Warn().Err(err).Msg("tailer died, restarting")
+		}
+		cfg.Location = ts.restartLocation(w.cfg.LogFile)
+
+		select {
+		case <-w.groupCtx.Done():
+			return nil
+		case <-time.After(tailRestartDelay):
+		}
+	}
+}
+
+// follow reads lines from the tailer until the context is done (restart
+// false) or the tailer dies (restart true, with the reason).
+func (w *Watcher) follow(tailer *tail.Tail, ts *tailState) (bool, error) {
+	var u16 *utf16Lines
+	if w.cfg.Encoding == configs.EncodingUTF16LE {
+		u16 = newUTF16Lines()
+	}
 	for {
 		select {
 		case <-w.groupCtx.Done():
 			w.logger.Debug().Msg("ctx done, stopping process tail")
 			tailer.Cleanup()
-			return nil
+			return false, nil
+		case <-ts.checkpoints:
+			if ts.offset >= 0 {
+				if err := w.saveCheckpoint(ts.offset); err != nil {
+					w.logger.Warn().Err(err).Msg("saving checkpoint")
+				}
+			}
 		case <-tailer.Dying():
-			w.logger.Debug().Err(tailer.Err()).Msg("tailer dying, restarting tailer")
-			// there is a not well handled scenario in tail where
-			// the inotify watcher is closed while the log reopener
-			// is waiting for log file creation events
+			err := tailer.Err()
 			tailer.Cleanup()
-			goto START_TAIL
+			return true, err
 		case line := <-tailer.Lines:
 			if line == nil {
 				_, err := tailer.Tell()
@@ -164,52 +377,182 @@ START_TAIL:
 					if !strings.Contains(err.Error(), "file already closed") {
 						w.logger.Debug().Msg("!file already closed error, stopping tail")
 						tailer.Cleanup()
-						// w.t.Kill(err)
-						return err
+						return false, err
 					}
 				}
 				w.logger.Warn().Msg("nil line, ignoring")
 				continue
 			}
-			_ = appstats.IncrementInt(w.statTotalLines)
 			if line.Err != nil {
-				w.logger.Error().
-					Err(line.Err).
-					Str("log_line", line.Text).
-					Msg("tail line error -- ignoring line")
+				w.lineRead()
+				w.lineError(line.Text, line.Err)
 				continue
 			}
-			for id, def := range w.cfg.Metrics {
-				if w.trace {
-					w.logger.Log().
-						Int("metric_id", id).
-						Str("metric_match", def.Matcher.String()).
-						Str("log_line", line.Text).
-						Msg("checking rule")
-				}
-				matches := def.Matcher.FindAllStringSubmatch(line.Text, -1)
-				if matches != nil {
-					ml := metricLine{
-						line:     line.Text,
-						metricID: id,
-					}
-					if len(def.MatchParts) > 0 {
-						m := map[string]string{}
-						for i, val := range matches[0] {
-							if def.MatchParts[i] != "" {
-								m[def.MatchParts[i]] = val
-							}
-						}
-						ml.matches = &m
-					}
-					w.metricLines <- ml
-					// NOTE: do not 'break' on match, a single log
-					//       line may generate multiple metrics by
-					//       matching multiple config rules.
+			raw, offset := line.Text, line.SeekInfo.Offset
+			if u16 != nil {
+				var ok bool
+				if raw, offset, ok = u16.add(raw, offset); !ok {
+					continue
 				}
 			}
+			w.lineRead()
+			ts.read(w.cfg.LogFile, offset)
+			atomic.StoreInt64(&w.stats.offset, offset)
+			text, ok := w.decodeLine(raw)
+			if !ok {
+				continue
+			}
+			w.traceLine(text)
+			if !w.dispatch(text) {
+				tailer.Cleanup()
+				return false, nil
+			}
+		}
+	}
+}
+
+// matchLine checks a log line against the metric rules, returning a
+// metric line for each rule the line matches.
+func (w *Watcher) matchLine(text string) []metricLine {
+	var lineTS time.Time
+	if w.cfg.Timestamp != nil {
+		if raw, ok := w.cfg.Timestamp.Extract(text); ok {
+			ts, stale := w.eventTime(raw)
+			if stale {
+				return nil
+			}
+			lineTS = ts
+		}
+	}
+	var mls []metricLine
+	matched := false
+	sampledOut := false
+	found := w.engine.scratch()
+	defer w.engine.release(found)
+	for id, def := range w.cfg.Metrics {
+		if !w.engine.candidate(id, text, *found) {
+			continue
+		}
+		if w.trace {
+			w.logger.Log().
+				Int("metric_id", id).
+				Str("metric_match", def.Matcher.String()).
+				Str("log_line", text).
+				Msg("checking rule")
+		}
+		loc, ok := w.engine.match(id, text)
+		if !ok {
+			continue
+		}
+		matched = true
+		if excluded(def, text) {
+			if w.trace {
+				w.logger.Log().
+					Int("metric_id", id).
+					Str("log_line", text).
+					Msg("excluded")
+			}
+			continue
+		}
+		ml := metricLine{
+			line:     text,
+			metricID: id,
+			ts:       lineTS,
+			loc:      loc,
+		}
+		if def.Condition != nil && !def.Condition.Eval(func(name string) (string, bool) { return ml.submatch(def.MatchParts, name) }) {
+			if w.trace {
+				w.logger.Log().
+					Int("metric_id", id).
+					Str("where", def.Condition.String()).
+					Str("log_line", text).
+					Msg("where condition not met")
+			}
+			continue
+		}
+		if !w.sampleLine(def, &ml) {
+			sampledOut = true
+			continue
+		}
+		// NOTE: do not 'break' on match, a single log
+		//       line may generate multiple metrics by
+		//       matching multiple config rules.
+		w.ruleMatched(id)
+		mls = append(mls, ml)
+	}
+	if !matched {
+		w.lineUnmatched(text)
+	}
+	if sampledOut && len(mls) == 0 {
+		w.lineSampledOut()
+	}
+	return mls
+}
+
+// submatch returns the value of the named subexpression, an empty
+// string if it did not participate in the match.
+func (l metricLine) submatch(names []string, name string) (string, bool) {
+	val, found := "", false
+	for i := len(names) - 1; i > 0; i-- {
+		if names[i] != name {
+			continue
+		}
+		found = true
+		if 2*i+1 < len(l.loc) && l.loc[2*i] >= 0 {
+			val = l.line[l.loc[2*i]:l.loc[2*i+1]]
 		}
+		break
 	}
+	return val, found
+}
+
+// submatches returns the named subexpression values.
+func (l metricLine) submatches(names []string) map[string]string {
+	m := make(map[string]string, len(names))
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		val := ""
+		if 2*i+1 < len(l.loc) && l.loc[2*i] >= 0 {
+			val = l.line[l.loc[2*i]:l.loc[2*i+1]]
+		}
+		m[name] = val
+	}
+	return m
+}
+
+// eventTime parses the raw event timestamp from a log line. A zero time
+// is returned if the timestamp cannot be parsed (the metric will be sent
+// without an explicit timestamp). stale indicates the event is older than
+// the configured max_age and should be dropped.
+func (w *Watcher) eventTime(raw string) (ts time.Time, stale bool) {
+	t, err := w.cfg.Timestamp.Parse(raw)
+	if err != nil {
+		_ = appstats.IncrementInt(w.statTSErrors)
+		if w.trace {
+			w.logger.Log().Err(err).Str("timestamp", raw).Msg("parsing timestamp")
+		}
+		return time.Time{}, false
+	}
+	if !w.backfill && w.cfg.Timestamp.Stale(t) {
+		_ = appstats.IncrementInt(w.statStaleLines)
+		if w.trace {
+			w.logger.Log().Time("timestamp", t).Msg("stale, dropping")
+		}
+		return t, true
+	}
+	return t, false
+}
+
+// excluded reports whether the line matches any of the rule exclude patterns.
+func excluded(def *configs.Metric, line string) bool {
+	for _, re := range def.Excluders {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
 }
 
 // parse log line to extract metric.
@@ -220,66 +563,177 @@ func (w *Watcher) parse() error {
 			w.logger.Debug().Msg("ctx done, stopping parse")
 			return nil
 		case l := <-w.metricLines:
-			_ = appstats.IncrementInt(w.statMatchedLines)
-			if w.trace {
-				w.logger.Log().
-					Int("metric_id", l.metricID).
-					Str("line", l.line).
-					Interface("matches", l.matches).
-					Msg("matched, parsing metric line")
+			m, ok := w.parseLine(l)
+			w.traceParse(l, m, ok)
+			if ok {
+				if !w.queueMetric(m) {
+					return nil
+				}
 			}
+		}
+	}
+}
 
-			r := w.cfg.Metrics[l.metricID]
-			m := metric{
-				Name: r.Name,
-				Tags: []string{"log_id:" + w.cfg.ID},
-				Type: r.Type,
-			}
+// parseLine extracts the metric from a matched log line, ok is false
+// if the line did not produce a metric.
+func (w *Watcher) parseLine(l metricLine) (metric, bool) {
+	_ = appstats.IncrementInt(w.statMatchedLines)
+	atomic.AddUint64(&w.stats.linesMatched, 1)
 
-			if m.Type == "c" {
-				m.Value = "1" // default to simple incrment by 1
-			}
+	r := w.cfg.Metrics[l.metricID]
+	if w.trace {
+		w.logger.Log().
+			Int("metric_id", l.metricID).
+			Str("line", l.line).
+			Interface("matches", l.submatches(r.MatchParts)).
+			Msg("matched, parsing metric line")
+	}
 
-			if l.matches == nil {
-				if r.Tags != "" {
-					m.Tags = append(m.Tags, strings.Split(r.Tags, ",")...)
-				}
-				w.metrics <- m
-				continue
-			}
+	m := metric{
+		Name:       r.Name,
+		Tags:       []string{"log_id:" + w.cfg.ID},
+		Type:       r.Type,
+		Timestamp:  l.ts,
+		ruleID:     l.metricID,
+		sampleRate: l.sampleRate,
+	}
 
-			if r.ValueKey != "" {
-				v, ok := (*l.matches)[r.ValueKey]
-				if !ok {
-					w.logger.Warn().
-						Str("value_key", r.ValueKey).
-						Str("line", l.line).
-						Interface("matches", *l.matches).
-						Msg("'Value' key defined but not found in matches")
-					continue
-				}
-				m.Value = v
-			}
-			if r.Namer != nil {
-				var b bytes.Buffer
-				if err := r.Namer.Execute(&b, *l.matches); err != nil {
-					w.logger.Warn().Err(err).Msg("namer exec")
-				}
-				m.Name = b.String()
+	if m.Type == "c" {
+		m.Value = "1" // default to simple incrment by 1
+	}
+
+	if l.loc == nil {
+		if r.Tags != "" {
+			m.Tags = append(m.Tags, strings.Split(r.Tags, ",")...)
+		}
+		if sl := w.series[l.metricID]; sl != nil {
+			w.limitSeries(sl, l.metricID, &m, len(m.Tags))
+		}
+		return m, true
+	}
+
+	if m.Timestamp.IsZero() && w.cfg.Timestamp != nil && w.cfg.Timestamp.Field != "" {
+		if raw, ok := l.submatch(r.MatchParts, w.cfg.Timestamp.Field); ok {
+			ts, stale := w.eventTime(raw)
+			if stale {
+				return m, false
 			}
-			if r.Tagger != nil {
-				var b bytes.Buffer
-				if err := r.Tagger.Execute(&b, *l.matches); err != nil {
-					w.logger.Warn().Err(err).Msg("tagger exec")
-				}
-				m.Tags = append(m.Tags, strings.Split(b.String(), ",")...)
-			} else if r.Tags != "" {
-				m.Tags = append(m.Tags, strings.Split(r.Tags, ",")...)
+			m.Timestamp = ts
+		}
+	}
+
+	// the map is only built for rules which need it (templates, normalize)
+	var matches map[string]string
+	if r.Normalize != nil || r.Namer != nil || r.Tagger != nil {
+		matches = l.submatches(r.MatchParts)
+		if r.Normalize != nil {
+			r.Normalize.Apply(matches)
+		}
+		for _, lt := range r.Lookups {
+			matches[lt.Name] = lt.Find(matches[lt.Field])
+		}
+		for _, ic := range r.Classify {
+			ic.Apply(matches)
+		}
+	}
+
+	if r.ValueKey != "" {
+		var v string
+		var ok bool
+		if matches != nil {
+			v, ok = matches[r.ValueKey]
+		} else {
+			v, ok = l.submatch(r.MatchParts, r.ValueKey)
+		}
+		if !ok {
+			w.logger.Warn().
+				Str("value_key", r.ValueKey).
+				Str("line", l.line).
+				Interface("matches", l.submatches(r.MatchParts)).
+				Msg("'Value' key defined but not found in matches")
+			w.parseError(l.metricID)
+			return m, false
+		}
+		m.Value = v
+		if r.Transform != nil {
+			tv, err := transformValue(r.Transform, m.Type, v)
+			if err != nil {
+				w.logger.Warn().
+					Err(err).
+					Int("metric_id", l.metricID).
+					Str("line", l.line).
+					Msg("value transform")
+				w.parseError(l.metricID)
+				return m, false
 			}
+			m.Value = tv
+		}
+	}
+	if r.Namer != nil {
+		var b bytes.Buffer
+		if err := r.Namer.Execute(&b, matches); err != nil {
+			w.logger.Warn().Err(err).Msg("namer exec")
+			w.templateError(l.metricID)
+		}
+		m.Name = b.String()
+	}
+	numFixed := 1 // log_id
+	if r.Tagger != nil {
+		var b bytes.Buffer
+		if err := r.Tagger.Execute(&b, matches); err != nil {
+			w.logger.Warn().Err(err).Msg("tagger exec")
+			w.templateError(l.metricID)
+		}
+		m.Tags = append(m.Tags, strings.Split(b.String(), ",")...)
+	} else if r.Tags != "" {
+		m.Tags = append(m.Tags, strings.Split(r.Tags, ",")...)
+		numFixed = len(m.Tags)
+	}
+
+	if sl := w.series[l.metricID]; sl != nil {
+		w.limitSeries(sl, l.metricID, &m, numFixed)
+	}
 
-			w.metrics <- m
+	return m, true
+}
+
+// transformValue applies the rule value transform and formats the
+// result for the metric type (counters must be unsigned integers).
+func transformValue(vt *configs.ValueTransform, metricType, value string) (string, error) {
+	v, err := vt.Apply(value)
+	if err != nil {
+		return "", err
+	}
+	if metricType == "c" {
+		if v < 0 {
+			return "", fmt.Errorf("counter value (%f) is negative", v)
 		}
+		return strconv.FormatUint(uint64(math.Round(v)), 10), nil
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64), nil
+}
+
+// limitSeries folds the metric into the overflow series when the rule
+// has reached its max_series limit, the first numFixed tags are kept.
+func (w *Watcher) limitSeries(sl *seriesLimiter, ruleID int, m *metric, numFixed int) {
+	name, tags, folded, first := sl.limit(m.Name, m.Tags, numFixed)
+	if !folded {
+		return
+	}
+	if first {
+		w.logger.Warn().
+			Int("metric_id", ruleID).
+			Int("max_series", sl.max).
+			Str("name", m.Name).
+			Msg("max_series reached, folding new tag values into " + overflowTagValue)
 	}
+	m.Name = name
+	m.Tags = tags
+	_ = appstats.IncrementInt(w.statFoldedSeries)
+	_ = w.dest.IncrementCounterWithTags(foldedMetricName, []string{
+		"log_id:" + w.cfg.ID,
+		"rule_id:" + strconv.Itoa(ruleID),
+	})
 }
 
 // save metrics to configured destination.
@@ -290,81 +744,157 @@ func (w *Watcher) save() error {
 			w.logger.Debug().Msg("ctx done, stopping save")
 			return nil
 		case m := <-w.metrics:
-			w.logger.Debug().
-				Str("metric", fmt.Sprintf("%#v", m)).
-				Msg("processing")
+			w.saveMetric(m)
+		}
+	}
+}
 
-			switch m.Type {
-			case "c":
-				v, err := strconv.ParseUint(m.Value, 10, 64)
-				if err != nil {
-					w.logger.Warn().Err(err).Msg(m.Name)
-				} else {
-					if len(m.Tags) > 0 {
-						_ = w.dest.IncrementCounterByValueWithTags(m.Name, m.Tags, v)
-					} else {
-						_ = w.dest.IncrementCounterByValue(m.Name, v)
-					}
-				}
-			case "g":
-				if len(m.Tags) > 0 {
-					_ = w.dest.SetGaugeValueWithTags(m.Name, m.Tags, m.Value)
-				} else {
-					_ = w.dest.SetGaugeValue(m.Name, m.Value)
-				}
-			case "h":
-				v, err := strconv.ParseFloat(m.Value, 64)
-				if err != nil {
-					w.logger.Warn().Err(err).Msg(m.Name)
-				} else {
-					if len(m.Tags) > 0 {
-						_ = w.dest.SetHistogramValueWithTags(m.Name, m.Tags, v)
-					} else {
-						_ = w.dest.SetHistogramValue(m.Name, v)
-					}
-				}
-			case "ms":
-				// parse as float
-				v, errFloat := strconv.ParseFloat(m.Value, 64)
-				if errFloat == nil {
-					if len(m.Tags) > 0 {
-						_ = w.dest.SetTimingValueWithTags(m.Name, m.Tags, v)
-					} else {
-						_ = w.dest.SetTimingValue(m.Name, v)
-					}
-					continue
-				}
-				// try parsing as a duration (e.g. 60ms, 1m, 3s)
-				dur, errDuration := time.ParseDuration(m.Value)
-				if errDuration != nil {
-					w.logger.Warn().Err(errFloat).Err(errDuration).Str("metric", m.Name).Msg("failed to parse timing as float or duration")
-					continue
-				}
-				if len(m.Tags) > 0 {
-					_ = w.dest.SetTimingValueWithTags(m.Name, m.Tags, float64(dur/time.Millisecond))
-				} else {
-					_ = w.dest.SetTimingValue(m.Name, float64(dur/time.Millisecond))
-				}
-			case "s":
-				if len(m.Tags) > 0 {
-					_ = w.dest.AddSetValueWithTags(m.Name, m.Tags, m.Value)
-				} else {
-					_ = w.dest.AddSetValue(m.Name, m.Value)
-				}
-			case "t":
-				if len(m.Tags) > 0 {
-					_ = w.dest.SetTextValueWithTags(m.Name, m.Tags, m.Value)
-				} else {
-					_ = w.dest.SetTextValue(m.Name, m.Value)
-				}
-			default:
-				w.logger.Warn().
-					Str("type", m.Type).
-					Str("name", m.Name).
-					Strs("tags", m.Tags).
-					Interface("val", m.Value).
-					Msg("metric, unknown type")
+// saveMetric sends a metric to the destination.
+func (w *Watcher) saveMetric(m metric) {
+	w.logger.Debug().
+		Str("metric", fmt.Sprintf("%#v", m)).
+		Msg("processing")
+
+	if w.derived != nil {
+		w.recordDerived(m)
+	}
+
+	if m.sampleRate > 1 && w.saveSampled(&m) {
+		return
+	}
+
+	if m.Type == "s" && w.sets != nil && w.addSetValue(m) {
+		return
+	}
+
+	if w.tsDest != nil && !m.Timestamp.IsZero() {
+		w.saveWithTime(m)
+		return
+	}
+
+	switch m.Type {
+	case "c":
+		v, err := strconv.ParseUint(m.Value, 10, 64)
+		if err != nil {
+			w.logger.Warn().Err(err).Msg(m.Name)
+			w.parseError(m.ruleID)
+		} else {
+			if len(m.Tags) > 0 {
+				_ = w.dest.IncrementCounterByValueWithTags(m.Name, m.Tags, v)
+			} else {
+				_ = w.dest.IncrementCounterByValue(m.Name, v)
 			}
 		}
+	case "g":
+		if len(m.Tags) > 0 {
+			_ = w.dest.SetGaugeValueWithTags(m.Name, m.Tags, m.Value)
+		} else {
+			_ = w.dest.SetGaugeValue(m.Name, m.Value)
+		}
+	case "h":
+		v, err := strconv.ParseFloat(m.Value, 64)
+		if err != nil {
+			w.logger.Warn().Err(err).Msg(m.Name)
+			w.parseError(m.ruleID)
+		} else {
+			if len(m.Tags) > 0 {
+				_ = w.dest.SetHistogramValueWithTags(m.Name, m.Tags, v)
+			} else {
+				_ = w.dest.SetHistogramValue(m.Name, v)
+			}
+		}
+	case "ms":
+		v, err := parseTiming(m.Value)
+		if err != nil {
+			w.logger.Warn().Err(err).Str("metric", m.Name).Msg("parsing timing")
+			w.parseError(m.ruleID)
+			return
+		}
+		if len(m.Tags) > 0 {
+			_ = w.dest.SetTimingValueWithTags(m.Name, m.Tags, v)
+		} else {
+			_ = w.dest.SetTimingValue(m.Name, v)
+		}
+	case "s":
+		if len(m.Tags) > 0 {
+			_ = w.dest.AddSetValueWithTags(m.Name, m.Tags, m.Value)
+		} else {
+			_ = w.dest.AddSetValue(m.Name, m.Value)
+		}
+	case "t":
+		if len(m.Tags) > 0 {
+			_ = w.dest.SetTextValueWithTags(m.Name, m.Tags, m.Value)
+		} else {
+			_ = w.dest.SetTextValue(m.Name, m.Value)
+		}
+	default:
+		w.logger.Warn().
+			Str("type", m.Type).
+			Str("name", m.Name).
+			Strs("tags", m.Tags).
+			Interface("val", m.Value).
+			Msg("metric, unknown type")
+	}
+}
+
+// saveWithTime sends a metric carrying an explicit event time to a
+// destination supporting timestamps.
+func (w *Watcher) saveWithTime(m metric) {
+	var err error
+	switch m.Type {
+	case "c":
+		var v uint64
+		v, err = strconv.ParseUint(m.Value, 10, 64)
+		if err == nil {
+			err = w.tsDest.IncrementCounterByValueWithTagsAndTime(m.Name, m.Tags, v, m.Timestamp)
+		}
+	case "g":
+		err = w.tsDest.SetGaugeValueWithTagsAndTime(m.Name, m.Tags, m.Value, m.Timestamp)
+	case "h":
+		var v float64
+		v, err = strconv.ParseFloat(m.Value, 64)
+		if err == nil {
+			err = w.tsDest.SetHistogramValueWithTagsAndTime(m.Name, m.Tags, v, m.Timestamp)
+		}
+	case "ms":
+		var v float64
+		v, err = parseTiming(m.Value)
+		if err == nil {
+			err = w.tsDest.SetHistogramValueWithTagsAndTime(m.Name, m.Tags, v, m.Timestamp)
+		}
+	case "s":
+		if w.tsSetDest != nil {
+			err = w.tsSetDest.AddSetValueWithTagsAndTime(m.Name, m.Tags, m.Value, m.Timestamp)
+		} else {
+			err = w.tsDest.IncrementCounterByValueWithTagsAndTime(m.Name+"`"+m.Value, m.Tags, 1, m.Timestamp)
+		}
+	case "t":
+		err = w.tsDest.SetTextValueWithTagsAndTime(m.Name, m.Tags, m.Value, m.Timestamp)
+	default:
+		w.logger.Warn().
+			Str("type", m.Type).
+			Str("name", m.Name).
+			Strs("tags", m.Tags).
+			Interface("val", m.Value).
+			Msg("metric, unknown type")
+		return
+	}
+	if err != nil {
+		w.logger.Warn().Err(err).Str("metric", m.Name).Time("timestamp", m.Timestamp).Msg("sending timestamped metric")
+		w.parseError(m.ruleID)
+	}
+}
+
+// parseTiming parses a timing value as a float (milliseconds) or
+// a duration (e.g. 60ms, 1m, 3s) which is converted to milliseconds.
+func parseTiming(value string) (float64, error) {
+	v, errFloat := strconv.ParseFloat(value, 64)
+	if errFloat == nil {
+		return v, nil
+	}
+	dur, errDuration := time.ParseDuration(value)
+	if errDuration != nil {
+		return 0, fmt.Errorf("failed to parse timing as float (%s) or duration (%s)", errFloat, errDuration) //nolint:errorlint
 	}
+	return float64(dur / time.Millisecond), nil
 }
@@ -6,15 +6,19 @@
 package watcher
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/circonus-labs/circonus-logwatch/internal/config"
 	"github.com/circonus-labs/circonus-logwatch/internal/configs"
 	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/report"
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
 )
@@ -32,6 +36,7 @@ func fakeLog() {
 		"hist 3.86\n",
 		"timing 124.9\n",
 		"set foo\n",
+		"event " + strconv.FormatInt(time.Now().Unix(), 10) + " 3\n",
 		"text|foo bar baz\n",
 		"bad_type\n",
 	}
@@ -174,3 +179,139 @@ func TestFull(t *testing.T) {
 	}
 	viper.Reset()
 }
+
+func TestTransformValue(t *testing.T) {
+	t.Log("Testing transformValue")
+
+	vt := &configs.ValueTransform{Scale: 0.5}
+
+	t.Log("counter")
+	{
+		v, err := transformValue(vt, "c", "5")
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if v != "3" {
+			t.Fatalf("expected 3 got %s", v)
+		}
+	}
+
+	t.Log("counter, negative")
+	{
+		if _, err := transformValue(vt, "c", "-5"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("histogram")
+	{
+		v, err := transformValue(vt, "h", "5")
+		if err != nil {
+			t.Fatalf("expected no error, got (%s)", err)
+		}
+		if v != "2.5" {
+			t.Fatalf("expected 2.5 got %s", v)
+		}
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	t.Log("Testing eventTime")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyDestType, "log")
+	viper.Set(config.KeyLogConfDir, "testdata")
+	defer viper.Reset()
+	cfgs, err := configs.Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	lc := cfgs[0]
+	if lc.Timestamp == nil {
+		t.Fatal("expected timestamp config")
+	}
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	w, err := New(context.Background(), dest, lc)
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if w.tsDest == nil {
+		t.Fatal("expected timestamp destination")
+	}
+
+	t.Log("valid")
+	{
+		now := time.Now().Truncate(time.Second)
+		ts, stale := w.eventTime(strconv.FormatInt(now.Unix(), 10))
+		if stale {
+			t.Fatal("expected not stale")
+		}
+		if !ts.Equal(now) {
+			t.Fatalf("expected %s got %s", now, ts)
+		}
+	}
+
+	t.Log("stale")
+	{
+		_, stale := w.eventTime(strconv.FormatInt(time.Now().Add(-48*time.Hour).Unix(), 10))
+		if !stale {
+			t.Fatal("expected stale")
+		}
+	}
+
+	t.Log("invalid")
+	{
+		ts, stale := w.eventTime("yesterday")
+		if stale {
+			t.Fatal("expected not stale")
+		}
+		if !ts.IsZero() {
+			t.Fatalf("expected zero time, got %s", ts)
+		}
+	}
+}
+
+func TestSaveWithTimeSet(t *testing.T) {
+	t.Log("Testing saveWithTime, set")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyLogConfDir, "testdata")
+	defer viper.Reset()
+	cfgs, err := configs.Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	var buf bytes.Buffer
+	dest, err := report.New(&buf, report.FormatJSON, time.Minute)
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	w, err := New(context.Background(), dest, cfgs[0])
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if w.tsSetDest == nil {
+		t.Fatal("expected timestamp set destination")
+	}
+
+	t0 := time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC)
+	for i, v := range []string{"a", "b", "a"} {
+		w.saveWithTime(metric{Name: "users", Type: "s", Value: v, Tags: []string{"log_id:test"}, Timestamp: t0.Add(time.Duration(i) * time.Second)})
+	}
+	if err := dest.Stop(); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+
+	var rows []report.Row
+	if err := json.Unmarshal(buf.Bytes(), &rows); err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	if len(rows) != 1 || rows[0].Name != "users" || rows[0].Value.(float64) != 2 {
+		t.Fatalf("expected one set of 2 unique values, got %s", buf.String())
+	}
+}
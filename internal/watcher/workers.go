@@ -0,0 +1,152 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/maier/go-appstats"
+)
+
+const throughputInterval = 10 * time.Second
+
+// workItem is a line queued for a matcher.
+type workItem struct {
+	text string
+	seq  uint64
+}
+
+// workResult holds the order sensitive metrics produced by a line.
+// dropped is set for a line dropped from the work queue, its window
+// slot was passed to the line queued in its place.
+type workResult struct {
+	metrics []metric
+	seq     uint64
+	dropped bool
+}
+
+// orderedType reports whether the order of the metric values matters,
+// the last value of a gauge or text metric is the one reported.
+func orderedType(metricType string) bool {
+	return metricType == "g" || metricType == "t"
+}
+
+// dispatch evaluates the rules for a line read from the log, unless it
+// is rate limited or sampled out, on the calling goroutine or, with
+// workers, by queueing it for a matcher.
+// Returns false if the watcher is stopping.
+func (w *Watcher) dispatch(text string) bool {
+	if !w.admit() {
+		return true
+	}
+	if w.workers > 1 {
+		return w.queueWork(text)
+	}
+	for _, ml := range w.matchLine(text) {
+		if !w.queueLine(ml) {
+			return false
+		}
+	}
+	return true
+}
+
+// match is a worker, matching and parsing queued lines. Metrics which
+// are not order sensitive are sent directly to save, the others are
+// passed to sequence.
+func (w *Watcher) match() error {
+	for {
+		select {
+		case <-w.groupCtx.Done():
+			return nil
+		case item := <-w.work:
+			res := workResult{seq: item.seq}
+			for _, l := range w.matchLine(item.text) {
+				m, ok := w.parseLine(l)
+				w.traceParse(l, m, ok)
+				if !ok {
+					continue
+				}
+				if orderedType(m.Type) {
+					res.metrics = append(res.metrics, m)
+					continue
+				}
+				if !w.queueMetric(m) {
+					return nil
+				}
+			}
+			select {
+			case w.results <- res:
+			case <-w.groupCtx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// sequence sends order sensitive metrics to save in the order their
+// lines were read from the log.
+func (w *Watcher) sequence() error {
+	pending := make(map[uint64]workResult)
+	next := uint64(1)
+	for {
+		select {
+		case <-w.groupCtx.Done():
+			return nil
+		case res := <-w.results:
+			if res.seq != next {
+				pending[res.seq] = res
+				continue
+			}
+			for {
+				if !res.dropped {
+					<-w.window
+				}
+				for _, m := range res.metrics {
+					if !w.queueMetric(m) {
+						return nil
+					}
+				}
+				next++
+				var ok bool
+				res, ok = pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+			}
+		}
+	}
+}
+
+// throughput periodically records the rate lines are read from the log,
+// the queue depth and the highest queue high water mark.
+func (w *Watcher) throughput() error {
+	ticker := time.NewTicker(throughputInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	prev := atomic.LoadUint64(&w.stats.linesTotal)
+	for {
+		select {
+		case <-w.groupCtx.Done():
+			return nil
+		case now := <-ticker.C:
+			lines := atomic.LoadUint64(&w.stats.linesTotal)
+			rate := float64(lines-prev) / now.Sub(last).Seconds()
+			last, prev = now, lines
+			atomic.StoreUint64(&w.stats.linesPerSec, math.Float64bits(rate))
+			_ = appstats.SetFloat(w.statLinesPerSec, rate)
+			_ = appstats.SetInt(w.statQueueDepth, int64(w.queueDepth()))
+			hw := atomic.LoadInt64(&w.lineQueue.highWater)
+			if mhw := atomic.LoadInt64(&w.metricQueue.highWater); mhw > hw {
+				hw = mhw
+			}
+			_ = appstats.SetInt(w.statQueueHigh, hw)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-logwatch/internal/config"
+	"github.com/circonus-labs/circonus-logwatch/internal/configs"
+	"github.com/circonus-labs/circonus-logwatch/internal/metrics/logonly"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestWorkers(t *testing.T) {
+	t.Log("Testing workers")
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyLogConfDir, "testdata")
+	defer viper.Reset()
+	cfgs, err := configs.Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	cfg := *cfgs[0]
+	cfg.Workers = 4
+
+	dest, err := logonly.New()
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	w, err := New(context.Background(), dest, &cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got (%s)", err)
+	}
+	defer func() {
+		_ = w.Stop()
+		_ = w.group.Wait()
+	}()
+
+	for i := 0; i < w.workers; i++ {
+		w.group.Go(w.match)
+	}
+	w.group.Go(w.sequence)
+
+	const lines = 2000
+	go func() {
+		for i := 1; i <= lines; i++ {
+			line := "testcounter"
+			if i%2 == 1 {
+				line = fmt.Sprintf("gaugeint %d", i)
+			}
+			if !w.dispatch(line) {
+				return
+			}
+		}
+	}()
+
+	// gaugeint produces gaugeint and, over 10, gaugeint_large
+	expected := lines/2 + lines/2 + (lines/2 - 5)
+	last := map[string]int{}
+	counters := 0
+	timeout := time.After(10 * time.Second)
+	for n := 0; n < expected; n++ {
+		select {
+		case m := <-w.metrics:
+			switch m.Type {
+			case "c":
+				counters++
+			case "g":
+				v, err := strconv.Atoi(m.Value)
+				if err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+				if v <= last[m.Name] {
+					t.Fatalf("%s out of order, %d after %d", m.Name, v, last[m.Name])
+				}
+				last[m.Name] = v
+			default:
+				t.Fatalf("unexpected metric %#v", m)
+			}
+		case <-timeout:
+			t.Fatalf("timed out after %d of %d metrics", n, expected)
+		}
+	}
+
+	if counters != lines/2 {
+		t.Fatalf("expected %d counters, got %d", lines/2, counters)
+	}
+	if last["gaugeint"] != lines-1 || last["gaugeint_large"] != lines-1 {
+		t.Fatalf("expected last gauges %d, got %v", lines-1, last)
+	}
+	// the result of the last line may still be in flight
+	for i := 0; len(w.window) > 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(w.window) != 0 {
+		t.Fatalf("expected empty window, got %d", len(w.window))
+	}
+
+	st := w.Status()
+	if st.Workers != 4 || st.QueueDepth != 0 {
+		t.Fatalf("unexpected status %#v", st)
+	}
+}